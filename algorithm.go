@@ -1,19 +1,28 @@
 package httpsignatures
 
 import (
-	"errors"
+	"sort"
+	"strings"
+	"sync"
 )
 
 var (
-	AlgorithmHmacSha1   = "hmac-sha1"
-	AlgorithmHmacSha256 = "hmac-sha256"
-	AlgorithmEd25519    = "ed25519"
+	AlgorithmHmacSha1     = "hmac-sha1"
+	AlgorithmHmacSha256   = "hmac-sha256"
+	AlgorithmEd25519      = "ed25519"
+	AlgorithmEcdsaSha256  = "ecdsa-sha256"
+	AlgorithmEcdsaSha512  = "ecdsa-sha512"
+	AlgorithmRsaSha256    = "rsa-sha256"
+	AlgorithmRsaPssSha256 = "rsa-pss-sha256"
+	AlgorithmRsaPssSha512 = "rsa-pss-sha512"
+	// AlgorithmHs2019 hides the algorithm, the verifier derives it from the
+	// key of the keyId, see Signer.Hs2019
+	AlgorithmHs2019 = "hs2019"
 
 	algorithmHmacSha1   = &Algorithm{"hmac-sha1", Hmac1Sign, Hmac1Verify}
 	algorithmHmacSha256 = &Algorithm{"hmac-sha256", Hmac256Sign, Hmac256Verify}
 	algorithmEd25519    = &Algorithm{"ed25519", Ed25519Sign, Ed25519Verify}
-
-	errorUnknownAlgorithm = errors.New("Unknown signature algorithm provided")
+	algorithmHs2019     = &Algorithm{"hs2019", hs2019Sign, hs2019Verify}
 )
 
 // Algorithm exports the main algorithm properties: name, sign, verify
@@ -23,15 +32,94 @@ type Algorithm struct {
 	Verify func(key *[]byte, message []byte, signature *[]byte) (bool, error)
 }
 
+// deterministicSigners are the deterministic sign functions of the
+// algorithms which have one, eg RFC 6979 ECDSA, see Signer.DeterministicECDSA.
+// They are registered by init functions and read-only afterwards.
+var deterministicSigners = map[*Algorithm]func(privateKey *[]byte, message []byte) (*[]byte, error){}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[string]*Algorithm{}
+	// allowSHA1 is guarded by algorithmsMu, see AllowSHA1
+	allowSHA1 bool
+)
+
+// init registers the algorithms every build has. The RSA and ECDSA
+// algorithms register themselves in their files, which the httpsig_minimal
+// build tag leaves out, eg for tinygo and WebAssembly builds signing with
+// HMAC or Ed25519 only.
+func init() {
+	for _, alg := range []*Algorithm{
+		algorithmHmacSha1,
+		algorithmHmacSha256,
+		algorithmEd25519,
+	} {
+		RegisterAlgorithm(alg.Name, alg)
+	}
+}
+
+// RegisterAlgorithm makes the algorithm available for signing and
+// verification under name, eg a custom or proprietary algorithm. It replaces
+// an algorithm registered earlier with the same name.
+func RegisterAlgorithm(name string, alg *Algorithm) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	algorithms[name] = alg
+}
+
+// LookupAlgorithm returns the algorithm registered under name
+func LookupAlgorithm(name string) (*Algorithm, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	alg, ok := algorithms[name]
+	return alg, ok
+}
+
+// AllowSHA1 enables or disables the algorithms based on the broken SHA-1
+// hash, like hmac-sha1. They are rejected for signing and verification by
+// default.
+func AllowSHA1(allow bool) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	allowSHA1 = allow
+}
+
+// SHA1Allowed reports whether the algorithms based on SHA-1 are enabled,
+// see AllowSHA1
+func SHA1Allowed() bool {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return allowSHA1
+}
+
+// Algorithms returns the names of the registered algorithms in alphabetical
+// order
+func Algorithms() []string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func algorithmFromString(name string) (*Algorithm, error) {
-	switch name {
-	case AlgorithmHmacSha1:
-		return algorithmHmacSha1, nil
-	case AlgorithmHmacSha256:
-		return algorithmHmacSha256, nil
-	case AlgorithmEd25519:
-		return algorithmEd25519, nil
+	if isSHA1Algorithm(name) && !SHA1Allowed() {
+		return nil, ErrSHA1AlgorithmNotAllowed
+	}
+
+	if alg, ok := LookupAlgorithm(name); ok {
+		return alg, nil
 	}
+	if name == AlgorithmHs2019 {
+		return algorithmHs2019, nil
+	}
+
+	return nil, ErrUnknownAlgorithm
+}
 
-	return nil, errorUnknownAlgorithm
+func isSHA1Algorithm(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), "-sha1")
 }
@@ -0,0 +1,102 @@
+//go:build !httpsig_minimal
+
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+
+	// register the hashes used by the ECDSA algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	algorithmEcdsaSha256 = &Algorithm{"ecdsa-sha256", EcdsaSha256Sign, EcdsaSha256Verify}
+	algorithmEcdsaSha512 = &Algorithm{"ecdsa-sha512", EcdsaSha512Sign, EcdsaSha512Verify}
+)
+
+func init() {
+	for _, alg := range []*Algorithm{algorithmEcdsaSha256, algorithmEcdsaSha512} {
+		RegisterAlgorithm(alg.Name, alg)
+	}
+}
+
+// EcdsaSha256Sign signs the SHA-256 hash of the message with the PEM or DER
+// encoded EC private key, SEC 1 or PKCS #8. The signature is the ASN.1 DER
+// encoded (r, s) pair.
+func EcdsaSha256Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return ecdsaSign(privateKey, message, crypto.SHA256)
+}
+
+// EcdsaSha256Verify verifies the ASN.1 DER encoded signature of the SHA-256
+// hash of the message with the PEM or DER encoded PKIX EC public key
+func EcdsaSha256Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return ecdsaVerify(publicKey, message, signature, crypto.SHA256)
+}
+
+// EcdsaSha512Sign signs the SHA-512 hash of the message, like
+// EcdsaSha256Sign
+func EcdsaSha512Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return ecdsaSign(privateKey, message, crypto.SHA512)
+}
+
+// EcdsaSha512Verify verifies the signature of the SHA-512 hash of the
+// message, like EcdsaSha256Verify
+func EcdsaSha512Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return ecdsaVerify(publicKey, message, signature, crypto.SHA512)
+}
+
+func ecdsaSign(privateKey *[]byte, message []byte, hash crypto.Hash) (*[]byte, error) {
+	key, err := parseEcdsaPrivateKey(*privateKey)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+func ecdsaVerify(publicKey *[]byte, message []byte, signature *[]byte, hash crypto.Hash) (bool, error) {
+	key, err := parseEcdsaPublicKey(*publicKey)
+	if err != nil {
+		return false, err
+	}
+	h := hash.New()
+	h.Write(message)
+	if ecdsa.VerifyASN1(key, h.Sum(nil), *signature) {
+		return true, nil
+	}
+	return false, ErrSignatureMismatch
+}
+
+func parseEcdsaPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	der = pemBytes(der)
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+			return ecKey, nil
+		}
+	}
+	return nil, ErrInvalidEcdsaPrivateKey
+}
+
+func parseEcdsaPublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(pemBytes(der))
+	if err != nil {
+		return nil, ErrInvalidEcdsaPublicKey
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidEcdsaPublicKey
+	}
+	return ecKey, nil
+}
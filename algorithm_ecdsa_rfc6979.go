@@ -0,0 +1,142 @@
+//go:build !httpsig_minimal
+
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"encoding/asn1"
+	"math/big"
+)
+
+func init() {
+	deterministicSigners[algorithmEcdsaSha256] = EcdsaSha256SignDeterministic
+	deterministicSigners[algorithmEcdsaSha512] = EcdsaSha512SignDeterministic
+}
+
+// EcdsaSha256SignDeterministic signs like EcdsaSha256Sign, with the nonce
+// derived from the key and the message (RFC 6979) instead of a random one:
+// the same message and key always give the same signature
+func EcdsaSha256SignDeterministic(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return ecdsaSignDeterministic(privateKey, message, crypto.SHA256)
+}
+
+// EcdsaSha512SignDeterministic signs the SHA-512 hash of the message, like
+// EcdsaSha256SignDeterministic
+func EcdsaSha512SignDeterministic(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return ecdsaSignDeterministic(privateKey, message, crypto.SHA512)
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func ecdsaSignDeterministic(privateKey *[]byte, message []byte, hash crypto.Hash) (*[]byte, error) {
+	key, err := parseEcdsaPrivateKey(*privateKey)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(message)
+	digest := h.Sum(nil)
+
+	n := key.Curve.Params().N
+	e := bitsToInt(digest, n.BitLen())
+	nonces := newRFC6979Nonces(key, digest, hash)
+	for {
+		k := nonces.next()
+		x, _ := key.Curve.ScalarBaseMult(k.Bytes())
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = k^-1 (e + r d) mod n
+		s := new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		sig, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+		if err != nil {
+			return nil, err
+		}
+		return &sig, nil
+	}
+}
+
+// rfc6979Nonces generates the nonces of a signature with HMAC_DRBG, RFC
+// 6979 section 3.2
+type rfc6979Nonces struct {
+	hash    crypto.Hash
+	n       *big.Int
+	k, v    []byte
+	started bool
+}
+
+func newRFC6979Nonces(key *ecdsa.PrivateKey, digest []byte, hash crypto.Hash) *rfc6979Nonces {
+	n := key.Curve.Params().N
+	size := (n.BitLen() + 7) / 8
+	x := intToOctets(key.D, size)
+	// bits2octets: the digest reduced modulo n
+	h1 := intToOctets(new(big.Int).Mod(bitsToInt(digest, n.BitLen()), n), size)
+
+	g := &rfc6979Nonces{hash: hash, n: n}
+	g.v = make([]byte, hash.Size())
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+	g.k = make([]byte, hash.Size())
+	for _, b := range []byte{0x00, 0x01} {
+		g.k = g.mac(g.k, g.v, []byte{b}, x, h1)
+		g.v = g.mac(g.k, g.v)
+	}
+	return g
+}
+
+// next returns the next candidate nonce in [1, n-1]
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		if g.started {
+			g.k = g.mac(g.k, g.v, []byte{0x00})
+			g.v = g.mac(g.k, g.v)
+		}
+		g.started = true
+
+		var t []byte
+		for len(t)*8 < g.n.BitLen() {
+			g.v = g.mac(g.k, g.v)
+			t = append(t, g.v...)
+		}
+		k := bitsToInt(t, g.n.BitLen())
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *rfc6979Nonces) mac(key []byte, data ...[]byte) []byte {
+	m := hmac.New(g.hash.New, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// bitsToInt returns the leftmost bitLen bits of b as integer, RFC 6979
+// section 2.3.2
+func bitsToInt(b []byte, bitLen int) *big.Int {
+	i := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - bitLen; excess > 0 {
+		i.Rsh(i, uint(excess))
+	}
+	return i
+}
+
+// intToOctets returns i as size bytes big-endian, RFC 6979 section 2.3.3
+func intToOctets(i *big.Int, size int) []byte {
+	out := make([]byte, size)
+	return i.FillBytes(out)
+}
@@ -0,0 +1,191 @@
+//go:build !httpsig_minimal
+
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"testing"
+)
+
+func generateEcdsaKeys(t *testing.T, curve elliptic.Curve) (privateKey string, publicKey string) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	assert.Nil(t, err)
+	priv, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(priv), base64.StdEncoding.EncodeToString(pub)
+}
+
+func TestEcdsaSha256SignVerify(t *testing.T) {
+	privateKey, publicKey := generateEcdsaKeys(t, elliptic.P256())
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	err := NewSigner(AlgorithmEcdsaSha256).SignRequest(r, testKeyID, privateKey)
+	assert.Nil(t, err)
+
+	res, err := VerifyRequest(r, func(string) (string, error) { return publicKey, nil }, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// tampered signing string
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	res, err = VerifyRequest(r, func(string) (string, error) { return publicKey, nil }, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestEcdsaCurves(t *testing.T) {
+	message := []byte("date: " + testDate)
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		privateKey, publicKey := generateEcdsaKeys(t, curve)
+		priv, _ := base64.StdEncoding.DecodeString(privateKey)
+		pub, _ := base64.StdEncoding.DecodeString(publicKey)
+
+		for _, algorithm := range []*Algorithm{algorithmEcdsaSha256, algorithmEcdsaSha512} {
+			sig, err := algorithm.Sign(&priv, message)
+			assert.Nil(t, err)
+			res, err := algorithm.Verify(&pub, message, sig)
+			assert.True(t, res, curve.Params().Name+" "+algorithm.Name)
+			assert.Nil(t, err)
+		}
+
+		// the hash is part of the algorithm
+		sig, err := EcdsaSha512Sign(&priv, message)
+		assert.Nil(t, err)
+		res, err := EcdsaSha256Verify(&pub, message, sig)
+		assert.False(t, res)
+		assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+	}
+}
+
+func TestEcdsaSha256PEMKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv})
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+
+	message := []byte("date: " + testDate)
+	sig, err := EcdsaSha256Sign(&privPEM, message)
+	assert.Nil(t, err)
+
+	res, err := EcdsaSha256Verify(&pubPEM, message, sig)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestEcdsaSha256InvalidKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Nil(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(pub)
+	assert.Nil(t, err)
+	garbage := []byte("not a key")
+	message := []byte("date: " + testDate)
+
+	// keys of another type are rejected, not asserted
+	_, err = EcdsaSha256Sign(&pkcs8, message)
+	assert.EqualError(t, err, ErrorInvalidEcdsaPrivateKey)
+	_, err = EcdsaSha256Sign(&garbage, message)
+	assert.EqualError(t, err, ErrorInvalidEcdsaPrivateKey)
+
+	sig := []byte("AAAA")
+	res, err := EcdsaSha256Verify(&pkix, message, &sig)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorInvalidEcdsaPublicKey)
+	res, err = EcdsaSha256Verify(&garbage, message, &sig)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorInvalidEcdsaPublicKey)
+}
+
+// rfc6979Key returns the SEC 1 DER encoded private key d of the RFC 6979
+// appendix A.2 examples
+func rfc6979Key(t *testing.T, curve elliptic.Curve, d string) []byte {
+	key := &ecdsa.PrivateKey{D: new(big.Int)}
+	key.D.SetString(d, 16)
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(key.D.Bytes())
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return der
+}
+
+func TestEcdsaDeterministicRFC6979(t *testing.T) {
+	p256 := rfc6979Key(t, elliptic.P256(), "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+	p384 := rfc6979Key(t, elliptic.P384(), "6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5")
+
+	// RFC 6979 appendix A.2.5 and A.2.6
+	for _, test := range []struct {
+		key     []byte
+		sign    func(*[]byte, []byte) (*[]byte, error)
+		message string
+		r, s    string
+	}{
+		{p256, EcdsaSha256SignDeterministic, "sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"},
+		{p256, EcdsaSha256SignDeterministic, "test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083"},
+		{p256, EcdsaSha512SignDeterministic, "sample",
+			"8496A60B5E9B47C825488827E0495B0E3FA109EC4568FD3F8D1097678EB97F00",
+			"2362AB1ADBE2B8ADF9CB9EDAB740EA6049C028114F2460F96554F61FAE3302FE"},
+		{p384, EcdsaSha256SignDeterministic, "sample",
+			"21B13D1E013C7FA1392D03C5F99AF8B30C570C6F98D4EA8E354B63A21D3DAA33BDE1E888E63355D92FA2B3C36D8FB2CD",
+			"F3AA443FB107745BF4BD77CB3891674632068A10CA67E3D45DB2266FA7D1FEEBEFDC63ECCD1AC42EC0CB8668A4FA0AB0"},
+		{p384, EcdsaSha512SignDeterministic, "sample",
+			"ED0959D5880AB2D869AE7F6C2915C6D60F96507F9CB3E047C0046861DA4A799CFE30F35CC900056D7C99CD7882433709",
+			"512C8CCEEE3890A84058CE1E22DBC2198F42323CE8ACA9135329F03C068E5112DC7CC3EF3446DEFCEB01A45C2667FDD5"},
+	} {
+		signature, err := test.sign(&test.key, []byte(test.message))
+		assert.Nil(t, err)
+		var rs ecdsaSignature
+		_, err = asn1.Unmarshal(*signature, &rs)
+		assert.Nil(t, err)
+		assert.Equal(t, test.r, fmt.Sprintf("%0*X", len(test.r), rs.R))
+		assert.Equal(t, test.s, fmt.Sprintf("%0*X", len(test.s), rs.S))
+	}
+}
+
+func TestSignerDeterministicECDSA(t *testing.T) {
+	privateKey, publicKey := generateEcdsaKeys(t, elliptic.P256())
+	sign := func(opts ...SignerOption) string {
+		r := &http.Request{
+			Header: http.Header{
+				"Date": []string{testDate},
+			},
+		}
+		key, err := base64.StdEncoding.DecodeString(privateKey)
+		assert.Nil(t, err)
+		assert.Nil(t, NewSignerWithOptions(testKeyID, key, AlgorithmEcdsaSha256, opts...).Sign(r))
+
+		res, err := VerifyRequest(r, func(string) (string, error) { return publicKey, nil }, -1)
+		assert.True(t, res)
+		assert.Nil(t, err)
+		return r.Header.Get("Signature")
+	}
+
+	assert.Equal(t, sign(WithDeterministicECDSA()), sign(WithDeterministicECDSA()))
+	assert.NotEqual(t, sign(), sign())
+}
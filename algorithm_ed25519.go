@@ -1,31 +1,61 @@
 package httpsignatures
 
 import (
-	"errors"
-
-	ed25519 "github.com/agl/ed25519"
+	"crypto/ed25519"
+	"crypto/x509"
 )
 
-// Ed25519Sign signs the message with the ed25519 ECDSA using the private Key
+// Ed25519Sign signs the message with the ed25519 ECDSA using the private Key:
+// the 64 byte key, its 32 byte seed, or a PEM or DER encoded PKCS #8 key
 func Ed25519Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
-	var pKey [ed25519.PrivateKeySize]byte
-	var libSig *[ed25519.SignatureSize]byte
-	copy(pKey[:], *privateKey)
-	libSig = ed25519.Sign(&pKey, message)
-	sig := make([]byte, len(libSig))
-	copy(sig, (*libSig)[:])
+	key, err := parseEd25519PrivateKey(*privateKey)
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(key, message)
 	return &sig, nil
 }
 
-// Ed25519Verify verifies the message with the ed25519 ECDSA using the public Key
+// Ed25519Verify verifies the message with the ed25519 ECDSA using the public
+// Key: the 32 byte key, or a PEM or DER encoded PKIX key
 func Ed25519Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
-	var pubKey [ed25519.PublicKeySize]byte
-	copy(pubKey[:], *publicKey)
-	var sig [ed25519.SignatureSize]byte
-	copy(sig[:], *signature)
-	if ed25519.Verify(&pubKey, message, &sig) {
+	key, err := parseEd25519PublicKey(*publicKey)
+	if err != nil {
+		return false, err
+	}
+	if len(*signature) != ed25519.SignatureSize {
+		return false, ErrSignatureMismatch
+	}
+	if ed25519.Verify(key, message, *signature) {
 		return true, nil
 	} else {
-		return false, errors.New(ErrorSignatureDdoNotMatch)
+		return false, ErrSignatureMismatch
+	}
+}
+
+func parseEd25519PrivateKey(key []byte) (ed25519.PrivateKey, error) {
+	switch len(key) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(pemBytes(key)); err == nil {
+		if edKey, ok := parsed.(ed25519.PrivateKey); ok {
+			return edKey, nil
+		}
+	}
+	return nil, ErrInvalidEd25519PrivateKey
+}
+
+func parseEd25519PublicKey(key []byte) (ed25519.PublicKey, error) {
+	if len(key) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(key), nil
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(pemBytes(key)); err == nil {
+		if edKey, ok := parsed.(ed25519.PublicKey); ok {
+			return edKey, nil
+		}
 	}
+	return nil, ErrInvalidEd25519PublicKey
 }
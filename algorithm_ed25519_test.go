@@ -0,0 +1,119 @@
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestEd25519GeneratedKeyPair(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	var s SignatureParameters
+	err = s.FromConfig("ed25519-key", "ed25519", nil)
+	assert.Nil(t, err)
+	err = s.ParseRequest(r)
+	assert.Nil(t, err)
+
+	signature, err := s.calculateSignature(base64.StdEncoding.EncodeToString(priv))
+	assert.Nil(t, err)
+	r.Header.Set("Signature", s.hTTPSignatureString(signature))
+
+	var parsed SignatureParameters
+	err = parsed.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, algorithmEd25519, parsed.Algorithm)
+
+	res, err := parsed.Verify(base64.StdEncoding.EncodeToString(pub))
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// a signature of another key doesn't verify
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	res, err = parsed.Verify(base64.StdEncoding.EncodeToString(otherPub))
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestEd25519InvalidKeyLength(t *testing.T) {
+	key := make([]byte, 16)
+
+	_, err := Ed25519Sign(&key, []byte(plainText))
+	assert.EqualError(t, err, ErrorInvalidEd25519PrivateKey)
+
+	signature := make([]byte, ed25519.SignatureSize)
+	res, err := Ed25519Verify(&key, []byte(plainText), &signature)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorInvalidEd25519PublicKey)
+
+	// a truncated signature is a mismatch
+	pub, _ := base64.StdEncoding.DecodeString(ed25519TestPublicKey)
+	signature = signature[:10]
+	res, err = Ed25519Verify(&pub, []byte(plainText), &signature)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestEd25519KeyFormats(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Nil(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(pub)
+	assert.Nil(t, err)
+	message := []byte(plainText)
+
+	raw := []byte(pub)
+	publicKeys := [][]byte{
+		raw,
+		pkix,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}),
+	}
+	for _, privateKey := range [][]byte{
+		priv,
+		priv.Seed(),
+		pkcs8,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	} {
+		sig, err := Ed25519Sign(&privateKey, message)
+		assert.Nil(t, err)
+
+		for _, publicKey := range publicKeys {
+			res, err := Ed25519Verify(&publicKey, message, sig)
+			assert.True(t, res)
+			assert.Nil(t, err)
+		}
+	}
+}
+
+func TestEd25519OtherKeyType(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+
+	_, err = Ed25519Sign(&pkcs8, []byte(plainText))
+	assert.EqualError(t, err, ErrorInvalidEd25519PrivateKey)
+
+	signature := make([]byte, ed25519.SignatureSize)
+	res, err := Ed25519Verify(&pkix, []byte(plainText), &signature)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorInvalidEd25519PublicKey)
+}
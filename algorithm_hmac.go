@@ -1,13 +1,12 @@
 package httpsignatures
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/pem"
 	"hash"
-
-	"errors"
+	"strings"
 )
 
 const (
@@ -15,6 +14,23 @@ const (
 	hmac256SignatureSize = 32
 )
 
+func isHmacAlgorithm(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "hmac-")
+}
+
+// isPublicKey reports whether key is the public key of one of the
+// asymmetric algorithms rather than an HMAC secret: a PEM encoded key or
+// certificate, or a DER encoded PKIX or PKCS #1 public key or certificate.
+// Raw Ed25519 public keys can't be told apart from 32 byte secrets, they
+// must be bound to ed25519 by a KeyStore.
+func isPublicKey(key []byte) bool {
+	if block, _ := pem.Decode(key); block != nil {
+		return true
+	}
+	_, err := parseEncodedPublicKey(key)
+	return err == nil
+}
+
 func Hmac1Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
 	return Sign(privateKey, message, sha1.New, hmac1SignatureSize)
 }
@@ -46,9 +62,10 @@ func Verify(privateKey *[]byte, message []byte, hashFunc func() hash.Hash, sig *
 		return false, err
 	}
 
-	if bytes.Equal(*calcSign, *sig) {
+	// constant time comparison, to not leak how much of the signature matches
+	if hmac.Equal(*calcSign, *sig) {
 		return true, nil
 	} else {
-		return false, errors.New(ErrorSignatureDdoNotMatch)
+		return false, ErrSignatureMismatch
 	}
 }
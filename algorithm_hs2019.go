@@ -0,0 +1,37 @@
+package httpsignatures
+
+// hs2019Sign and hs2019Verify fail, hs2019 names no algorithm: the signer
+// signs with the algorithm of its key and the verifier resolves the
+// algorithm of the key before verifying, see hs2019Algorithm
+func hs2019Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return nil, ErrUnknownAlgorithm
+}
+
+func hs2019Verify(key *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return false, ErrUnknownAlgorithm
+}
+
+// hs2019Algorithm returns the algorithm of an hs2019 signature: algorithm
+// when the key is bound to one, eg by a KeyStore, and otherwise the
+// algorithm draft-cavage recommends for the type of the key. RSA keys use
+// rsa-pss-sha512, ECDSA keys ecdsa-sha512 and Ed25519 keys ed25519, when the
+// key is a PEM or DER encoded public key or certificate. Other keys,
+// including raw Ed25519 keys, can't be told apart from HMAC secrets and
+// fail with ErrAlgorithmKeyMismatch, an hs2019 HMAC secret must be bound by
+// a KeyStore.
+func hs2019Algorithm(key []byte, algorithm string) (*Algorithm, error) {
+	if algorithm != "" {
+		return algorithmFromString(algorithm)
+	}
+	publicKey, err := parseEncodedPublicKey(key)
+	if err != nil {
+		return nil, ErrAlgorithmKeyMismatch
+	}
+
+	algorithms := keyTypeAlgorithms(publicKey)
+	if len(algorithms) == 0 {
+		return nil, ErrUnsupportedKeyType
+	}
+	// RSA and ECDSA are not registered in httpsig_minimal builds
+	return algorithmFromString(algorithms[0])
+}
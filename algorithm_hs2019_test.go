@@ -0,0 +1,133 @@
+package httpsignatures
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func hs2019Request(t *testing.T, signer *Signer) *http.Request {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	assert.Nil(t, signer.Sign(r))
+	assert.Contains(t, r.Header.Get("Signature"), `algorithm="hs2019"`)
+	return r
+}
+
+func TestHs2019Hmac(t *testing.T) {
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey)
+	signer.Hs2019 = true
+	r := hs2019Request(t, signer)
+
+	var sig SignatureParameters
+	err := sig.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, algorithmHs2019, sig.Algorithm)
+
+	// an unbound secret is refused, hs2019 never falls back to HMAC
+	res, err := NewVerifier(keyLookUp, -1).VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+
+	secret, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.Add(testKeyID, AlgorithmHmacSha256, secret))
+	v := NewVerifier(keyLookUp, -1)
+	v.KeyStore = store
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestHs2019RFC9421(t *testing.T) {
+	signer := rfc9421Signer()
+	signer.Hs2019 = true
+	r := rfc9421Request(t)
+	assert.Nil(t, signer.SignRequest(r, testKeyID, testKey))
+	assert.False(t, strings.Contains(r.Header.Get("Signature-Input"), ";alg="))
+
+	// as for hs2019, an unbound secret is refused
+	res, err := NewVerifier(keyLookUp, -1).VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+
+	secret, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.Add(testKeyID, AlgorithmHmacSha256, secret))
+	v := NewVerifier(keyLookUp, -1)
+	v.KeyStore = store
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestHs2019Ed25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	assert.Nil(t, err)
+
+	r := hs2019Request(t, NewSignerWithOptions(testKeyID, priv, AlgorithmEd25519, WithHs2019()))
+
+	v := NewKeyVerifier(func(keyID string) ([]byte, error) {
+		return der, nil
+	}, -1)
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// a raw Ed25519 key is ambiguous, it could be an HMAC secret
+	v = NewKeyVerifier(func(keyID string) ([]byte, error) {
+		return pub, nil
+	}, -1)
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+
+	// nor is an HMAC signature keyed with it accepted as hs2019
+	r = hs2019Request(t, NewSignerWithOptions(testKeyID, []byte(pub), AlgorithmHmacSha256, WithHs2019()))
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+}
+
+func TestHs2019KeyStore(t *testing.T) {
+	skipUnregistered(t, AlgorithmRsaSha256)
+	privateKey, publicKey := generateRsaKeys(t)
+	signer := NewKeySigner(testKeyID, AlgorithmRsaSha256, privateKey)
+	signer.Hs2019 = true
+	r := hs2019Request(t, signer)
+
+	// derived from the key, RSA keys use rsa-pss-sha512
+	res, err := NewVerifier(func(keyID string) (string, error) {
+		return publicKey, nil
+	}, -1).VerifyRequest(r)
+	assert.False(t, res)
+	assert.NotNil(t, err)
+
+	// bound by the key store
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	assert.Nil(t, err)
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.Add(testKeyID, AlgorithmRsaSha256, der))
+	v := NewVerifier(keyLookUp, -1)
+	v.KeyStore = store
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestHs2019KeyStoreAdd(t *testing.T) {
+	err := NewMemoryKeyStore().Add(testKeyID, AlgorithmHs2019, []byte(testKey))
+	assert.Equal(t, ErrUnknownAlgorithm, err)
+}
@@ -0,0 +1,125 @@
+//go:build !httpsig_minimal
+
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+
+	// register the hashes used by the RSA algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	algorithmRsaSha256    = &Algorithm{"rsa-sha256", RsaSha256Sign, RsaSha256Verify}
+	algorithmRsaPssSha256 = &Algorithm{"rsa-pss-sha256", RsaPssSha256Sign, RsaPssSha256Verify}
+	algorithmRsaPssSha512 = &Algorithm{"rsa-pss-sha512", RsaPssSha512Sign, RsaPssSha512Verify}
+)
+
+func init() {
+	for _, alg := range []*Algorithm{algorithmRsaSha256, algorithmRsaPssSha256, algorithmRsaPssSha512} {
+		RegisterAlgorithm(alg.Name, alg)
+	}
+}
+
+// RsaSha256Sign signs the message with RSASSA-PKCS1-v1_5 and SHA-256 using
+// the PEM or DER encoded RSA private key, PKCS #1 or PKCS #8
+func RsaSha256Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return rsaSign(privateKey, message, crypto.SHA256, nil)
+}
+
+// RsaSha256Verify verifies the RSASSA-PKCS1-v1_5 SHA-256 signature of the
+// message using the PEM or DER encoded RSA public key, PKIX or PKCS #1
+func RsaSha256Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return rsaVerify(publicKey, message, signature, crypto.SHA256, nil)
+}
+
+// RsaPssSha256Sign signs the message with RSASSA-PSS and SHA-256
+func RsaPssSha256Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return rsaSign(privateKey, message, crypto.SHA256, pssOptions(crypto.SHA256))
+}
+
+// RsaPssSha256Verify verifies the RSASSA-PSS SHA-256 signature of the message
+func RsaPssSha256Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return rsaVerify(publicKey, message, signature, crypto.SHA256, pssOptions(crypto.SHA256))
+}
+
+// RsaPssSha512Sign signs the message with RSASSA-PSS and SHA-512
+func RsaPssSha512Sign(privateKey *[]byte, message []byte) (*[]byte, error) {
+	return rsaSign(privateKey, message, crypto.SHA512, pssOptions(crypto.SHA512))
+}
+
+// RsaPssSha512Verify verifies the RSASSA-PSS SHA-512 signature of the message
+func RsaPssSha512Verify(publicKey *[]byte, message []byte, signature *[]byte) (bool, error) {
+	return rsaVerify(publicKey, message, signature, crypto.SHA512, pssOptions(crypto.SHA512))
+}
+
+// rsaSign signs with RSASSA-PSS when pss is set, RSASSA-PKCS1-v1_5 otherwise
+func rsaSign(privateKey *[]byte, message []byte, hash crypto.Hash, pss *rsa.PSSOptions) (*[]byte, error) {
+	key, err := parseRsaPrivateKey(*privateKey)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(message)
+
+	var sig []byte
+	if pss != nil {
+		sig, err = rsa.SignPSS(rand.Reader, key, hash, h.Sum(nil), pss)
+	} else {
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+func rsaVerify(publicKey *[]byte, message []byte, signature *[]byte, hash crypto.Hash, pss *rsa.PSSOptions) (bool, error) {
+	key, err := parseRsaPublicKey(*publicKey)
+	if err != nil {
+		return false, err
+	}
+	h := hash.New()
+	h.Write(message)
+
+	if pss != nil {
+		err = rsa.VerifyPSS(key, hash, h.Sum(nil), *signature, pss)
+	} else {
+		err = rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), *signature)
+	}
+	if err != nil {
+		return false, ErrSignatureMismatch
+	}
+	return true, nil
+}
+
+func parseRsaPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	der = pemBytes(der)
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+	}
+	return nil, ErrInvalidRsaPrivateKey
+}
+
+func parseRsaPublicKey(der []byte) (*rsa.PublicKey, error) {
+	der = pemBytes(der)
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, ErrInvalidRsaPublicKey
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	return nil, ErrInvalidRsaPublicKey
+}
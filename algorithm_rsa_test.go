@@ -0,0 +1,75 @@
+//go:build !httpsig_minimal
+
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestRsaSignVerify(t *testing.T) {
+	privateKey, publicKey := generateRsaKeys(t)
+	lookUp := func(string) (string, error) { return publicKey, nil }
+
+	for _, algorithm := range []string{AlgorithmRsaSha256, AlgorithmRsaPssSha256, AlgorithmRsaPssSha512} {
+		r := &http.Request{
+			Header: http.Header{
+				"Date": []string{testDate},
+			},
+		}
+		err := NewSigner(algorithm).SignRequest(r, testKeyID, privateKey)
+		assert.Nil(t, err, algorithm)
+
+		res, err := VerifyRequest(r, lookUp, -1)
+		assert.True(t, res, algorithm)
+		assert.Nil(t, err, algorithm)
+
+		// tampered signing string
+		r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+		res, err = VerifyRequest(r, lookUp, -1)
+		assert.False(t, res, algorithm)
+		assert.EqualError(t, err, ErrorSignatureDdoNotMatch, algorithm)
+	}
+}
+
+func TestRsaPssDoesNotVerifyAsPKCS1v15(t *testing.T) {
+	privateKey, publicKey := generateRsaKeys(t)
+	priv, _ := base64.StdEncoding.DecodeString(privateKey)
+	pub, _ := base64.StdEncoding.DecodeString(publicKey)
+	message := []byte("date: " + testDate)
+
+	sig, err := RsaPssSha256Sign(&priv, message)
+	assert.Nil(t, err)
+
+	res, err := RsaSha256Verify(&pub, message, sig)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+
+	res, err = RsaPssSha512Verify(&pub, message, sig)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestRsaInvalidKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	message := []byte("date: " + testDate)
+
+	_, err = RsaPssSha256Sign(&priv, message)
+	assert.EqualError(t, err, ErrorInvalidRsaPrivateKey)
+
+	sig := []byte("AAAA")
+	res, err := RsaPssSha256Verify(&pub, message, &sig)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorInvalidRsaPublicKey)
+}
@@ -3,6 +3,7 @@ package httpsignatures
 import (
 	"encoding/base64"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
@@ -40,11 +41,21 @@ func getTestAlgorithmDataFromString(name string) (*TestAlgorithmData, error) {
 		return TestEd25519, nil
 	}
 
-	return nil, errorUnknownAlgorithm
+	return nil, ErrUnknownAlgorithm
+}
+
+// enableSHA1 allows the SHA-1 based algorithms until the returned func is called
+func enableSHA1() func() {
+	AllowSHA1(true)
+	return func() {
+		AllowSHA1(false)
+	}
 }
 
 // Test
 func TestAllAlgorithms(t *testing.T) {
+	defer enableSHA1()()
+
 	algorithmList := []string{"hmac-sha1", "hmac-sha256", "ed25519"}
 
 	for _, a := range algorithmList {
@@ -67,3 +78,108 @@ func TestAllAlgorithms(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestSHA1AlgorithmsRejectedByDefault(t *testing.T) {
+	_, err := algorithmFromString("hmac-sha1")
+	assert.EqualError(t, err, ErrorSHA1AlgorithmNotAllowed)
+
+	_, err = algorithmFromString("rsa-sha1")
+	assert.EqualError(t, err, ErrorSHA1AlgorithmNotAllowed)
+
+	defer enableSHA1()()
+	assert.True(t, SHA1Allowed())
+	algorithm, err := algorithmFromString("hmac-sha1")
+	assert.Nil(t, err)
+	assert.Equal(t, algorithmHmacSha1, algorithm)
+}
+
+func TestAllowSHA1Concurrent(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			AllowSHA1(i%2 == 0)
+		}
+		AllowSHA1(false)
+	}()
+	for i := 0; i < 100; i++ {
+		algorithmFromString("hmac-sha1")
+	}
+	<-done
+	assert.False(t, SHA1Allowed())
+}
+
+func TestHmacVerifyMismatch(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString(hmacKey)
+	signature, _ := base64.StdEncoding.DecodeString(hmacSHA256Cypher)
+
+	// wrong length
+	short := signature[:len(signature)-1]
+	valid, err := Hmac256Verify(&key, []byte(plainText), &short)
+	assert.False(t, valid)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+
+	// single flipped byte
+	flipped := make([]byte, len(signature))
+	copy(flipped, signature)
+	flipped[len(flipped)-1] ^= 0x01
+	valid, err = Hmac256Verify(&key, []byte(plainText), &flipped)
+	assert.False(t, valid)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	// a toy algorithm which appends the key to the message
+	custom := &Algorithm{
+		Name: "x-concat",
+		Sign: func(key *[]byte, message []byte) (*[]byte, error) {
+			sig := append(append([]byte{}, message...), *key...)
+			return &sig, nil
+		},
+		Verify: func(key *[]byte, message []byte, sig *[]byte) (bool, error) {
+			if string(*sig) != string(message)+string(*key) {
+				return false, ErrSignatureMismatch
+			}
+			return true, nil
+		},
+	}
+	RegisterAlgorithm(custom.Name, custom)
+	defer func() {
+		algorithmsMu.Lock()
+		delete(algorithms, custom.Name)
+		algorithmsMu.Unlock()
+	}()
+
+	alg, ok := LookupAlgorithm("x-concat")
+	assert.True(t, ok)
+	assert.Equal(t, custom, alg)
+	assert.Contains(t, Algorithms(), "x-concat")
+	assert.Contains(t, Algorithms(), AlgorithmEd25519)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := NewSigner("x-concat").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestLookupUnknownAlgorithm(t *testing.T) {
+	_, ok := LookupAlgorithm("rot13")
+	assert.False(t, ok)
+
+	_, err := algorithmFromString("rot13")
+	assert.Equal(t, ErrUnknownAlgorithm, err)
+}
+
+// skipUnregistered skips the test when the algorithm is not in this build,
+// the RSA and ECDSA algorithms are not in httpsig_minimal builds
+func skipUnregistered(t *testing.T, algorithm string) {
+	if _, ok := LookupAlgorithm(algorithm); !ok {
+		t.Skipf("%s is not registered", algorithm)
+	}
+}
@@ -0,0 +1,37 @@
+package httpsignatures
+
+import (
+	"strings"
+)
+
+// Canonicalizer combines all values of a header into the value which is
+// signed
+type Canonicalizer func(values []string) string
+
+// CanonicalizeTrim is the canonicalization of the spec and the default:
+// leading and trailing whitespace is removed from every value and the
+// values are joined with ", "
+func CanonicalizeTrim(values []string) string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed = append(trimmed, strings.TrimSpace(value))
+	}
+	return strings.Join(trimmed, ", ")
+}
+
+// CanonicalizeCollapseWhitespace is CanonicalizeTrim which also replaces
+// every run of whitespace inside a value by a single space, for partners
+// which fold or reformat header values
+func CanonicalizeCollapseWhitespace(values []string) string {
+	collapsed := make([]string, 0, len(values))
+	for _, value := range values {
+		collapsed = append(collapsed, strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(collapsed, ", ")
+}
+
+// CanonicalizeLowercase is CanonicalizeTrim which also lowercases the
+// values, for case insensitive headers whose case is changed in transit
+func CanonicalizeLowercase(values []string) string {
+	return strings.ToLower(CanonicalizeTrim(values))
+}
@@ -0,0 +1,53 @@
+package httpsignatures
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinCanonicalizers(t *testing.T) {
+	values := []string{"  Max-Age=60 ", "must \t  revalidate"}
+
+	assert.Equal(t, "Max-Age=60, must \t  revalidate", CanonicalizeTrim(values))
+	assert.Equal(t, "Max-Age=60, must revalidate", CanonicalizeCollapseWhitespace(values))
+	assert.Equal(t, "max-age=60, must \t  revalidate", CanonicalizeLowercase(values))
+}
+
+func TestCustomCanonicalizer(t *testing.T) {
+	// a partner which only signs the last value of a header
+	last := func(values []string) string {
+		return strings.TrimSpace(values[len(values)-1])
+	}
+
+	r := &http.Request{
+		Header: http.Header{
+			"X-Forwarded-For": []string{"10.0.0.1", " 192.168.0.1 "},
+		},
+	}
+
+	signer := NewSigner("hmac-sha256", "x-forwarded-for")
+	signer.Canonicalizers = map[string]Canonicalizer{"x-forwarded-for": last}
+	err := signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	// the default canonicalization doesn't match
+	_, err = VerifyRequest(r, keyLookUp, -1)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Canonicalizers = map[string]Canonicalizer{"x-forwarded-for": last}
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the canonicalizer is used for both signing and verification
+	debug := DebugVerify(r, testKey)
+	assert.Equal(t, []string{"x-forwarded-for: 10.0.0.1, 192.168.0.1"}, debug.SigningString)
+
+	var s SignatureParameters
+	err = s.fromMessage(RequestMessage(r), v.requestOptions())
+	assert.Nil(t, err)
+	assert.Equal(t, HeaderList{{"x-forwarded-for", "192.168.0.1"}}, s.Headers)
+}
@@ -0,0 +1,33 @@
+package httpsignatures
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderFromCGI reconstructs the request headers from CGI meta-variables,
+// eg the environment of a CGI script or the parameters of a FastCGI
+// request: HTTP_X_REQUEST_ID becomes X-Request-Id, CONTENT_TYPE and
+// CONTENT_LENGTH become Content-Type and Content-Length. The result can be
+// used as the Header of a request to verify.
+//
+// CGI replaces the dashes in header names by underscores, so a header
+// which contains an underscore in its name can not be reconstructed.
+func HeaderFromCGI(env map[string]string) http.Header {
+	header := http.Header{}
+	for name, value := range env {
+		switch {
+		case strings.HasPrefix(name, "HTTP_"):
+			header.Add(cgiHeaderName(name[len("HTTP_"):]), value)
+		case name == "CONTENT_TYPE" || name == "CONTENT_LENGTH":
+			if len(value) > 0 {
+				header.Add(cgiHeaderName(name), value)
+			}
+		}
+	}
+	return header
+}
+
+func cgiHeaderName(name string) string {
+	return http.CanonicalHeaderKey(strings.Replace(name, "_", "-", -1))
+}
@@ -0,0 +1,63 @@
+package httpsignatures
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/cgi"
+	"testing"
+)
+
+func TestHeaderFromCGI(t *testing.T) {
+	header := HeaderFromCGI(map[string]string{
+		"HTTP_DATE":         testDate,
+		"HTTP_X_REQUEST_ID": "42",
+		"CONTENT_TYPE":      "application/json",
+		"CONTENT_LENGTH":    "",
+		"REQUEST_METHOD":    "GET",
+	})
+
+	assert.Equal(t, http.Header{
+		"Date":         []string{testDate},
+		"X-Request-Id": []string{"42"},
+		"Content-Type": []string{"application/json"},
+	}, header)
+}
+
+func TestVerifyCGIRequest(t *testing.T) {
+	signed, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	signed.Header.Set("Date", testDate)
+	signed.Header.Set("X-Request-Id", "42")
+
+	for _, header := range []string{"x-request-id", "(request-target)", "host"} {
+		signed.Header.Del("Signature")
+		signer := NewSigner("hmac-sha256", header)
+		err = signer.SignRequest(signed, testKeyID, testKey)
+		assert.Nil(t, err)
+
+		env := map[string]string{
+			"SERVER_PROTOCOL":   "HTTP/1.1",
+			"REQUEST_METHOD":    "GET",
+			"REQUEST_URI":       "/foo",
+			"HTTP_HOST":         "example.com",
+			"HTTP_DATE":         signed.Header.Get("Date"),
+			"HTTP_X_REQUEST_ID": signed.Header.Get("X-Request-Id"),
+			"HTTP_SIGNATURE":    signed.Header.Get("Signature"),
+		}
+
+		// request as reconstructed by net/http/cgi
+		r, err := cgi.RequestFromMap(env)
+		assert.Nil(t, err)
+		res, err := VerifyRequest(r, keyLookUp, -1, header)
+		assert.True(t, res, header)
+		assert.Nil(t, err, header)
+
+		// request with the headers reconstructed by HeaderFromCGI
+		r, err = http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		assert.Nil(t, err)
+		r.Header = HeaderFromCGI(env)
+		res, err = VerifyRequest(r, keyLookUp, -1, header)
+		assert.True(t, res, header)
+		assert.Nil(t, err, header)
+	}
+}
@@ -0,0 +1,282 @@
+// Command httpsig signs and verifies HTTP requests, eg to test this library
+// against other implementations.
+//
+// Sign a request described with curl style flags and print the signature
+// headers, or with -request the complete signed request:
+//
+//	httpsig sign -key-id my-key -key key.pem -algorithm rsa-sha256 \
+//		-headers "(request-target) host date" -X POST \
+//		-H "Content-Type: application/json" -d '{"hello": "world"}' \
+//		https://example.com/foo
+//
+// Without URL the request to sign is read from stdin in HTTP/1.1 wire
+// format. Verify a request read from stdin in wire format:
+//
+//	httpsig sign -request ... | httpsig verify -key public.pem
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+const usage = `usage: httpsig sign [flags] [URL]
+       httpsig verify [flags] < request
+
+Run httpsig sign -h or httpsig verify -h for the flags.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit code: 0 on success, 1 when
+// signing or verification fails, and 2 for invalid arguments
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "sign":
+		err = sign(args[1:], stdin, stdout, stderr)
+	case "verify":
+		err = verify(args[1:], stdin, stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errFlags):
+		// reported by the flag set
+		return 2
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(stderr, "httpsig:", err)
+		return 2
+	default:
+		fmt.Fprintln(stderr, "httpsig:", err)
+		return 1
+	}
+}
+
+// errFlags is returned for flags the flag set failed to parse
+var errFlags = errors.New("invalid flags")
+
+// usageError reports invalid arguments
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// headerFlags collects repeated -H flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %q is not \"Name: value\"", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// keyFlags are the flags selecting the key, shared by sign and verify
+type keyFlags struct {
+	file   string
+	base64 bool
+}
+
+func (k *keyFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&k.file, "key", "", "`file` holding the key: a PEM or DER key, or the raw HMAC secret")
+	flags.BoolVar(&k.base64, "base64", false, "the key file is base64 encoded")
+}
+
+func (k keyFlags) load() ([]byte, error) {
+	if k.file == "" {
+		return nil, usageError("-key is required")
+	}
+	key, err := ioutil.ReadFile(k.file)
+	if err != nil {
+		return nil, err
+	}
+	if k.base64 {
+		return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(key)))
+	}
+	return key, nil
+}
+
+// parseFormat returns the signature format named by the -format flag
+func parseFormat(name string) (httpsignatures.SignatureFormat, error) {
+	switch name {
+	case "", "auto":
+		return httpsignatures.FormatAuto, nil
+	case "cavage":
+		return httpsignatures.FormatCavage, nil
+	case "rfc9421":
+		return httpsignatures.FormatRFC9421, nil
+	}
+	return 0, usageError(fmt.Sprintf("unknown format %q", name))
+}
+
+func sign(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("httpsig sign", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var key keyFlags
+	key.register(flags)
+	keyID := flags.String("key-id", "", "the keyId of the signature")
+	algorithm := flags.String("algorithm", httpsignatures.AlgorithmHmacSha256, "the signature `algorithm`, one of "+strings.Join(httpsignatures.Algorithms(), ", "))
+	headers := flags.String("headers", "", "space separated `list` of the signed headers, \"date\" by default")
+	format := flags.String("format", "cavage", "signature `format`: cavage or rfc9421")
+	authorization := flags.Bool("authorization", false, "sign in the Authorization header instead of the Signature header")
+	digest := flags.Bool("digest", false, "add the Digest and Content-Digest headers of the body")
+	hs2019 := flags.Bool("hs2019", false, "send algorithm=\"hs2019\"")
+	method := flags.String("X", http.MethodGet, "the request `method`")
+	var requestHeaders headerFlags
+	flags.Var(&requestHeaders, "H", "request `header` \"Name: value\", may be repeated")
+	data := flags.String("d", "", "the request `body`")
+	printRequest := flags.Bool("request", false, "print the complete signed request instead of the signature headers")
+	if err := flags.Parse(args); err != nil {
+		return errFlags
+	}
+	if *keyID == "" {
+		return usageError("-key-id is required")
+	}
+	keyBytes, err := key.load()
+	if err != nil {
+		return err
+	}
+
+	var r *http.Request
+	switch flags.NArg() {
+	case 0:
+		if r, err = http.ReadRequest(bufio.NewReader(stdin)); err != nil {
+			return err
+		}
+		// the wire format carries the host in the Host header only
+		r.URL.Host = r.Host
+		r.RequestURI = ""
+	case 1:
+		if r, err = http.NewRequest(*method, flags.Arg(0), strings.NewReader(*data)); err != nil {
+			return err
+		}
+		for _, header := range requestHeaders {
+			parts := strings.SplitN(header, ":", 2)
+			r.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	default:
+		return usageError("at most one URL can be signed")
+	}
+
+	signer := httpsignatures.NewSignerWithOptions(*keyID, keyBytes, *algorithm,
+		httpsignatures.WithHeaders(strings.Fields(*headers)...), httpsignatures.WithDate())
+	if signer.Format, err = parseFormat(*format); err != nil {
+		return err
+	}
+	signer.UseAuthorization = *authorization
+	signer.Hs2019 = *hs2019
+	if *digest {
+		signer.DigestAlgorithms = []string{"SHA-256"}
+	}
+
+	before := r.Header.Clone()
+	if err := signer.Sign(r); err != nil {
+		return err
+	}
+
+	if *printRequest {
+		return r.Write(stdout)
+	}
+	// the headers the signer added
+	added := http.Header{}
+	for name, values := range r.Header {
+		if n := len(before[name]); len(values) > n {
+			added[name] = values[n:]
+		}
+	}
+	return added.Write(stdout)
+}
+
+func verify(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("httpsig verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var key keyFlags
+	key.register(flags)
+	keyID := flags.String("key-id", "", "only accept signatures with this keyId")
+	algorithm := flags.String("algorithm", "", "bind the key of -key-id to this `algorithm`, eg for hs2019 signatures")
+	headers := flags.String("headers", "", "space separated `list` of the headers the signature must cover")
+	format := flags.String("format", "auto", "accepted signature `format`: auto, cavage or rfc9421")
+	skew := flags.Int("skew", -1, "allowed clock skew of the Date header in `seconds`, -1 to disable the check")
+	checkDigest := flags.Bool("digest", false, "check the body against a signed digest header")
+	if err := flags.Parse(args); err != nil {
+		return errFlags
+	}
+	if flags.NArg() > 0 {
+		return usageError("the request is read from stdin")
+	}
+	if *algorithm != "" && *keyID == "" {
+		return usageError("-algorithm requires -key-id")
+	}
+	keyBytes, err := key.load()
+	if err != nil {
+		return err
+	}
+
+	r, err := http.ReadRequest(bufio.NewReader(stdin))
+	if err != nil {
+		return err
+	}
+	r.URL.Host = r.Host
+
+	v := httpsignatures.NewKeyVerifier(func(id string) ([]byte, error) {
+		if *keyID != "" && id != *keyID {
+			return nil, nil
+		}
+		return keyBytes, nil
+	}, *skew, strings.Fields(*headers)...)
+	if *algorithm != "" {
+		store := httpsignatures.NewMemoryKeyStore()
+		if err := store.Add(*keyID, *algorithm, keyBytes); err != nil {
+			return err
+		}
+		v.KeyStore = store
+	}
+	if v.Format, err = parseFormat(*format); err != nil {
+		return err
+	}
+	v.CheckDigest = *checkDigest
+
+	result, err := v.Verify(r)
+	if err != nil {
+		// the signing string helps to find the difference with the signer
+		var sig httpsignatures.SignatureParameters
+		if sig.FromRequest(r) == nil {
+			if signingString, sErr := sig.SigningString(); sErr == nil {
+				fmt.Fprintf(stderr, "signing string:\n%s\n", signingString)
+			}
+		}
+		return err
+	}
+	fmt.Fprintf(stdout, "OK keyId=%q algorithm=%q headers=%q\n", result.KeyID, result.Algorithm, strings.Join(result.Headers, " "))
+	return nil
+}
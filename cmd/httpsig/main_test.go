@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKey(t *testing.T, key string) string {
+	file := filepath.Join(t.TempDir(), "key")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(key), 0600))
+	return file
+}
+
+func TestSignVerify(t *testing.T) {
+	key := writeKey(t, "secret")
+
+	var request, stderr bytes.Buffer
+	code := run([]string{"sign", "-key-id", "Test", "-key", key, "-request", "-digest",
+		"-headers", "(request-target) host date", "-X", "POST",
+		"-H", "Content-Type: application/json", "-d", `{"hello": "world"}`,
+		"http://example.com/foo?param=value"}, nil, &request, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, request.String(), "POST /foo?param=value HTTP/1.1\r\n")
+	assert.Contains(t, request.String(), `headers="(request-target) host date digest"`)
+
+	var stdout bytes.Buffer
+	code = run([]string{"verify", "-key", key, "-key-id", "Test", "-digest", "-headers", "(request-target) host"},
+		bytes.NewReader(request.Bytes()), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, `OK keyId="Test" algorithm="hmac-sha256" headers="(request-target) host date digest"`+"\n", stdout.String())
+
+	// a tampered request prints the signing string
+	tampered := strings.Replace(request.String(), "/foo?", "/bar?", 1)
+	stderr.Reset()
+	code = run([]string{"verify", "-key", key}, strings.NewReader(tampered), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "(request-target): post /bar?param=value\n")
+}
+
+func TestSignHeaders(t *testing.T) {
+	key := writeKey(t, "c2VjcmV0")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"sign", "-key-id", "Test", "-key", key, "-base64", "-format", "rfc9421", "-headers", "@method @path"},
+		strings.NewReader("GET /foo HTTP/1.1\r\nHost: example.com\r\n\r\n"), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), `Signature-Input: sig1=("@method" "@path");`)
+	assert.Contains(t, stdout.String(), "Signature: sig1=:")
+	assert.NotContains(t, stdout.String(), "Host:")
+}
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"sign", "-key", "key"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"sign", "-unknown"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"verify", "-key", "key", "-algorithm", "hmac-sha256"}, strings.NewReader("GET / HTTP/1.1\r\n\r\n"), &stdout, &stderr))
+}
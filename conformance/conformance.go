@@ -0,0 +1,298 @@
+// Package conformance runs signing and verification test vectors against
+// httpsignatures: the examples of draft-cavage and RFC 9421, vectors
+// exported from another implementation, or vectors with your own keys.
+// testdata/vectors.json holds the examples of draft-cavage-http-signatures-12
+// appendix C and RFC 9421 appendix B.2.5 and B.2.6.
+//
+// Vectors are stored as a JSON array of Vector, eg
+//
+//	[{
+//		"name": "hmac date",
+//		"mode": "sign",
+//		"request": "GET /foo HTTP/1.1\nHost: example.com\nDate: Thu, 05 Jan 2014 21:31:40 GMT\n\n",
+//		"key": {"id": "test", "algorithm": "hmac-sha256", "private": "c2VjcmV0"},
+//		"headers": ["date"],
+//		"signingString": "date: Thu, 05 Jan 2014 21:31:40 GMT",
+//		"signature": "keyId=\"test\",algorithm=\"hmac-sha256\",headers=\"date\",signature=\"...\""
+//	}]
+//
+// and run from a test with
+//
+//	vectors, err := conformance.LoadFile("testdata/vectors.json")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	conformance.Run(t, vectors)
+package conformance
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+const (
+	// ModeSign signs the request and compares the result with the vector
+	ModeSign = "sign"
+	// ModeVerify verifies the signature the request carries
+	ModeVerify = "verify"
+)
+
+// Vector is a single test vector
+type Vector struct {
+	Name string `json:"name"`
+	// Mode is ModeSign or ModeVerify
+	Mode string `json:"mode"`
+	// Format is "cavage", the default, or "rfc9421"
+	Format string `json:"format,omitempty"`
+	// Request is the request in HTTP/1.1 wire format, lines may end with
+	// "\n" instead of "\r\n". For ModeVerify it carries the signature.
+	Request string `json:"request"`
+	Key     Key    `json:"key"`
+
+	// Headers are the headers or components the signature covers, for
+	// ModeSign
+	Headers []string `json:"headers,omitempty"`
+	// Created and Expires are the created and expires parameters, for
+	// ModeSign
+	Created int64 `json:"created,omitempty"`
+	Expires int64 `json:"expires,omitempty"`
+	// Label is the RFC 9421 signature label, "sig1" by default
+	Label string `json:"label,omitempty"`
+	// Hs2019 leaves the algorithm out of the signature, for ModeSign: it
+	// sends algorithm="hs2019", or no alg parameter for RFC 9421
+	Hs2019 bool `json:"hs2019,omitempty"`
+
+	// SigningString is the expected signing string or RFC 9421 signature
+	// base of the first signature of the request, not compared when empty
+	SigningString string `json:"signingString,omitempty"`
+	// Signature is the expected value of the Signature header for ModeSign.
+	// It is only stable for deterministic algorithms, eg HMAC, Ed25519 and
+	// rsa-sha256. Not compared when empty.
+	Signature string `json:"signature,omitempty"`
+	// SignatureInput is the expected value of the Signature-Input header
+	// for ModeSign, not compared when empty
+	SignatureInput string `json:"signatureInput,omitempty"`
+	// Valid is the expected outcome of ModeVerify, true when missing
+	Valid *bool `json:"valid,omitempty"`
+}
+
+// Key is the key of a vector. Keys are PEM encoded, or base64 encoded raw
+// keys, eg an HMAC secret or an Ed25519 seed.
+type Key struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// Private signs, for HMAC it is the secret
+	Private string `json:"private,omitempty"`
+	// Public verifies, for HMAC it is the secret as well. A signed vector is
+	// also verified with it when it is set.
+	Public string `json:"public,omitempty"`
+}
+
+// Load reads a JSON array of vectors
+func Load(r io.Reader) ([]Vector, error) {
+	var vectors []Vector
+	if err := json.NewDecoder(r).Decode(&vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// LoadFile reads a JSON array of vectors from the file path
+func LoadFile(path string) ([]Vector, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Run runs every vector as a subtest of t, vectors of algorithms which are
+// not registered, eg RSA in httpsig_minimal builds, are skipped
+func Run(t *testing.T, vectors []Vector) {
+	t.Helper()
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			if _, ok := httpsignatures.LookupAlgorithm(v.Key.Algorithm); !ok {
+				t.Skipf("algorithm %q is not registered", v.Key.Algorithm)
+			}
+			if err := v.Run(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Run runs the vector and returns the first difference with the expected
+// outcome
+func (v Vector) Run() error {
+	switch v.Mode {
+	case ModeSign:
+		return v.sign()
+	case ModeVerify:
+		return v.verify()
+	}
+	return fmt.Errorf("unknown mode %q", v.Mode)
+}
+
+func (v Vector) sign() error {
+	r, err := v.request()
+	if err != nil {
+		return err
+	}
+	key, err := decodeKey(v.Key.Private)
+	if err != nil {
+		return fmt.Errorf("private key: %w", err)
+	}
+
+	signer := httpsignatures.NewSignerWithOptions(v.Key.ID, key, v.Key.Algorithm, httpsignatures.WithHeaders(v.Headers...))
+	if signer.Format, err = v.format(); err != nil {
+		return err
+	}
+	signer.Label = v.Label
+	signer.Hs2019 = v.Hs2019
+	if v.Created != 0 {
+		created := time.Unix(v.Created, 0)
+		signer.Clock = func() time.Time { return created }
+	}
+	if v.Expires != 0 {
+		signer.ExpiresIn = time.Duration(v.Expires-v.Created) * time.Second
+	}
+	if err := signer.Sign(r); err != nil {
+		return fmt.Errorf("signing: %w", err)
+	}
+
+	if err := compare("Signature", v.Signature, strings.Join(r.Header["Signature"], ", ")); err != nil {
+		return err
+	}
+	if err := compare("Signature-Input", v.SignatureInput, strings.Join(r.Header["Signature-Input"], ", ")); err != nil {
+		return err
+	}
+	if err := v.compareSigningString(r); err != nil {
+		return err
+	}
+
+	if v.Key.Public == "" {
+		return nil
+	}
+	if err := v.verifyRequest(r); err != nil {
+		return fmt.Errorf("verifying the signature: %w", err)
+	}
+	return nil
+}
+
+func (v Vector) verify() error {
+	r, err := v.request()
+	if err != nil {
+		return err
+	}
+	if err := v.compareSigningString(r); err != nil {
+		return err
+	}
+
+	err = v.verifyRequest(r)
+	valid := v.Valid == nil || *v.Valid
+	switch {
+	case valid && err != nil:
+		return fmt.Errorf("expected a valid signature: %w", err)
+	case !valid && err == nil:
+		return errors.New("expected an invalid signature")
+	}
+	return nil
+}
+
+// verifyRequest verifies the signature of the request with the public key,
+// bound to the algorithm of the key as signatures without an algorithm need.
+// The timestamps of vectors are in the past, they are not checked.
+func (v Vector) verifyRequest(r *http.Request) error {
+	key, err := decodeKey(v.Key.Public)
+	if err != nil {
+		return fmt.Errorf("public key: %w", err)
+	}
+	keys := httpsignatures.NewMemoryKeyStore()
+	if err := keys.Add(v.Key.ID, v.Key.Algorithm, key); err != nil {
+		return fmt.Errorf("public key: %w", err)
+	}
+	verifier := httpsignatures.NewVerifier(nil, -1)
+	verifier.KeyStore = keys
+	verifier.ValidateTimestamps = false
+	verifier.SignatureLabel = v.Label
+	if verifier.Format, err = v.format(); err != nil {
+		return err
+	}
+	_, err = verifier.Verify(r)
+	return err
+}
+
+// compareSigningString compares the signing string of the first signature
+// the request carries with the expected one
+func (v Vector) compareSigningString(r *http.Request) error {
+	if v.SigningString == "" {
+		return nil
+	}
+	signatures, err := httpsignatures.SignaturesFromRequest(r)
+	if err != nil {
+		return fmt.Errorf("parsing the signature: %w", err)
+	}
+	signingString, err := signatures[0].SigningString()
+	if err != nil {
+		return err
+	}
+	return compare("signing string", v.SigningString, signingString)
+}
+
+// request parses the request of the vector
+func (v Vector) request() (*http.Request, error) {
+	raw := v.Request
+	if !strings.Contains(raw, "\r\n") {
+		raw = strings.ReplaceAll(raw, "\n", "\r\n")
+	}
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	// the wire format carries the host in the Host header only
+	r.URL.Host = r.Host
+	r.RequestURI = ""
+	return r, nil
+}
+
+func (v Vector) format() (httpsignatures.SignatureFormat, error) {
+	switch v.Format {
+	case "", "cavage":
+		return httpsignatures.FormatCavage, nil
+	case "rfc9421":
+		return httpsignatures.FormatRFC9421, nil
+	}
+	return 0, fmt.Errorf("unknown format %q", v.Format)
+}
+
+// decodeKey returns a PEM encoded key as is, and decodes other keys from
+// base64
+func decodeKey(key string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		return []byte(key), nil
+	}
+	return base64.StdEncoding.DecodeString(key)
+}
+
+// compare reports a difference between the expected and the actual value,
+// an empty expected value matches anything
+func compare(what, expected, actual string) error {
+	if expected == "" || expected == actual {
+		return nil
+	}
+	return fmt.Errorf("%s differs\nexpected: %q\nactual:   %q", what, expected, actual)
+}
@@ -0,0 +1,50 @@
+package conformance
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	vectors, err := LoadFile("testdata/vectors.json")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, vectors)
+	Run(t, vectors)
+}
+
+func TestVectorMismatch(t *testing.T) {
+	vectors, err := LoadFile("testdata/vectors.json")
+	assert.Nil(t, err)
+	var hmac Vector
+	for _, v := range vectors {
+		if v.Name == "RFC 9421 B.2.5 hmac-sha256" {
+			hmac = v
+		}
+	}
+	assert.Equal(t, ModeSign, hmac.Mode)
+
+	v := hmac
+	v.SigningString = `"date": Tue, 20 Apr 2021 02:07:55 GMT`
+	assert.Contains(t, v.Run().Error(), "signing string differs")
+
+	v = hmac
+	v.Signature = strings.Replace(v.Signature, "=:", "=:x", 1)
+	assert.Contains(t, v.Run().Error(), "Signature differs")
+
+	// the request of a signing vector carries no signature
+	v = hmac
+	v.Mode = ModeVerify
+	v.SigningString = ""
+	assert.Contains(t, v.Run().Error(), "expected a valid signature")
+	valid := false
+	v.Valid = &valid
+	assert.Nil(t, v.Run())
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load(strings.NewReader(`{"name": "not an array"}`))
+	assert.NotNil(t, err)
+
+	assert.EqualError(t, Vector{Mode: "fuzz"}.Run(), `unknown mode "fuzz"`)
+}
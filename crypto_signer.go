@@ -0,0 +1,64 @@
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+)
+
+// SignRequestSigner adds a http signature made by signer to the Signature:
+// HTTP Header. The private key stays with the signer, eg in a PKCS #11
+// token or a cloud KMS. The RSA, ECDSA and Ed25519 algorithms are
+// supported.
+func (s Signer) SignRequestSigner(r *http.Request, keyID string, signer crypto.Signer) error {
+	return s.signRequest(r, keyID, cryptoSignFunc(signer), false)
+}
+
+// AuthRequestSigner adds a http signature made by signer to the
+// Authorization: HTTP Header, see SignRequestSigner
+func (s Signer) AuthRequestSigner(r *http.Request, keyID string, signer crypto.Signer) error {
+	return s.signRequest(r, keyID, cryptoSignFunc(signer), true)
+}
+
+func cryptoSignFunc(signer crypto.Signer) signFunc {
+	return func(alg *Algorithm, message []byte) ([]byte, error) {
+		opts, err := cryptoSignerOpts(alg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		digest := message
+		if hash := opts.HashFunc(); hash != 0 {
+			h := hash.New()
+			h.Write(message)
+			digest = h.Sum(nil)
+		}
+		// ECDSA signers return ASN.1 DER signatures, like EcdsaSha256Sign
+		return signer.Sign(rand.Reader, digest, opts)
+	}
+}
+
+// cryptoSignerOpts returns the crypto.Signer options of the algorithm
+func cryptoSignerOpts(algorithm string) (crypto.SignerOpts, error) {
+	switch algorithm {
+	case AlgorithmRsaSha256, AlgorithmEcdsaSha256:
+		return crypto.SHA256, nil
+	case AlgorithmEcdsaSha512:
+		return crypto.SHA512, nil
+	case AlgorithmRsaPssSha256:
+		return pssOptions(crypto.SHA256), nil
+	case AlgorithmRsaPssSha512:
+		return pssOptions(crypto.SHA512), nil
+	case AlgorithmEd25519:
+		// Ed25519 signs the message itself
+		return crypto.Hash(0), nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrCryptoSignerAlgorithm, algorithm)
+}
+
+// pssOptions sets the salt length to the length of the hash, as recommended
+func pssOptions(hash crypto.Hash) *rsa.PSSOptions {
+	return &rsa.PSSOptions{SaltLength: hash.Size(), Hash: hash}
+}
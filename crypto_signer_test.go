@@ -0,0 +1,100 @@
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// opaqueSigner hides the private key behind the crypto.Signer interface,
+// like a hardware token would
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestSignRequestSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Nil(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		algorithm string
+		signer    crypto.Signer
+	}{
+		{AlgorithmRsaSha256, rsaKey},
+		{AlgorithmRsaPssSha256, rsaKey},
+		{AlgorithmRsaPssSha512, rsaKey},
+		{AlgorithmEcdsaSha256, ecKey},
+		{AlgorithmEcdsaSha512, ecKey},
+		{AlgorithmEd25519, edKey},
+	}
+
+	for _, test := range tests {
+		if _, ok := LookupAlgorithm(test.algorithm); !ok {
+			// not in httpsig_minimal builds
+			continue
+		}
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		assert.Nil(t, err)
+		r.Header.Set("Date", testDate)
+
+		err = NewSigner(test.algorithm, "(request-target)", "date").SignRequestSigner(r, testKeyID, opaqueSigner{test.signer})
+		assert.Nil(t, err, test.algorithm)
+
+		var s SignatureParameters
+		err = s.FromRequest(r)
+		assert.Nil(t, err, test.algorithm)
+		res, err := s.VerifyPublicKey(test.signer.Public())
+		assert.True(t, res, test.algorithm)
+		assert.Nil(t, err, test.algorithm)
+	}
+}
+
+func TestSignerWithCryptoSigner(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+
+	signer := NewSignerWithOptions(testKeyID, nil, AlgorithmEd25519, WithCryptoSigner(opaqueSigner{edKey}), WithDate(), WithAuthorization())
+	err = signer.Sign(r)
+	assert.Nil(t, err)
+
+	publicKey, err := KeyBytes(edKey.Public())
+	assert.Nil(t, err)
+	res, err := NewKeyVerifier(func(keyID string) ([]byte, error) { return publicKey, nil }, 300).VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSignRequestSignerHmac(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	err = DefaultSha256Signer.SignRequestSigner(r, testKeyID, edKey)
+	assert.EqualError(t, err, ErrorCryptoSignerAlgorithm+" 'hmac-sha256'")
+	assert.ErrorIs(t, err, ErrCryptoSignerAlgorithm)
+}
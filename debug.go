@@ -0,0 +1,86 @@
+package httpsignatures
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// VerifyDebug holds everything needed to diagnose a signature mismatch
+// between a client and this library. It never contains key material: the
+// key is only identified by a truncated fingerprint.
+type VerifyDebug struct {
+	// Parameters are the signature parameters parsed from the request
+	Parameters SignatureParameters
+	// SigningString is the reconstructed signing string, line by line
+	SigningString []string
+	// SignatureLength is the length of the decoded signature in bytes
+	SignatureLength int
+	// KeyFingerprint is the hex encoded start of the SHA-256 of the decoded key
+	KeyFingerprint string
+	// Valid is the result of the verification
+	Valid bool
+	// Err is the error which stopped or failed the verification
+	Err error
+}
+
+// keyFingerprintSize is the number of bytes of the key hash shown, enough to
+// tell keys apart but too few to help brute forcing a weak HMAC secret
+const keyFingerprintSize = 8
+
+// SigningString returns the draft-cavage signing string a signature of the
+// request covering headers signs, "date" when no headers are given, eg to
+// compare it with the string built by another implementation. The
+// (created) and (expires) headers need their signature parameter and can't
+// be included.
+func SigningString(r *http.Request, headers []string) (string, error) {
+	sig := SignatureParameters{Headers: HeaderList{{Name: HeaderDate}}}
+	if len(headers) > 0 {
+		sig.Headers = HeaderList{}
+		for _, header := range headers {
+			sig.Headers = append(sig.Headers, HeaderField{Name: strings.ToLower(header)})
+		}
+	}
+	if err := sig.ParseRequest(r); err != nil {
+		return "", err
+	}
+	return sig.Headers.signingString()
+}
+
+// SigningString returns the data the signature signs: the signing string of
+// a draft-cavage signature or the signature base of an RFC 9421 signature.
+// The header values must be loaded, eg by FromRequest.
+func (s SignatureParameters) SigningString() (string, error) {
+	return s.signingString()
+}
+
+// DebugVerify verifies the request with the base64 encoded key, like
+// SignatureParameters.Verify, and returns the intermediate results
+func DebugVerify(r *http.Request, keyB64 string) VerifyDebug {
+	var debug VerifyDebug
+
+	if byteKey, err := base64.StdEncoding.DecodeString(keyB64); err == nil {
+		sum := sha256.Sum256(byteKey)
+		debug.KeyFingerprint = hex.EncodeToString(sum[:keyFingerprintSize])
+	}
+
+	if debug.Err = debug.Parameters.FromRequest(r); debug.Err != nil {
+		return debug
+	}
+
+	signingString, err := debug.Parameters.signingString()
+	if err != nil {
+		debug.Err = err
+		return debug
+	}
+	debug.SigningString = strings.Split(signingString, "\n")
+
+	if signature, err := base64.StdEncoding.DecodeString(debug.Parameters.Signature); err == nil {
+		debug.SignatureLength = len(signature)
+	}
+
+	debug.Valid, debug.Err = debug.Parameters.Verify(keyB64)
+	return debug
+}
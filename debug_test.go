@@ -0,0 +1,78 @@
+package httpsignatures
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestDebugVerify(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	debug := DebugVerify(r, testKey)
+	assert.Nil(t, debug.Err)
+	assert.True(t, debug.Valid)
+	assert.Equal(t, testKeyID, debug.Parameters.KeyID)
+	assert.Equal(t, algorithmHmacSha256, debug.Parameters.Algorithm)
+	assert.Equal(t, []string{"date: " + testDate}, debug.SigningString)
+	assert.Equal(t, hmac256SignatureSize, debug.SignatureLength)
+	assert.Equal(t, 2*keyFingerprintSize, len(debug.KeyFingerprint))
+	assert.NotContains(t, debug.KeyFingerprint, testKey)
+}
+
+func TestDebugVerifyMismatch(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	valid := DebugVerify(r, testKey)
+	other := DebugVerify(r, hmacKey)
+	assert.False(t, other.Valid)
+	assert.EqualError(t, other.Err, ErrorSignatureDdoNotMatch)
+	assert.Equal(t, valid.SigningString, other.SigningString)
+	assert.NotEqual(t, valid.KeyFingerprint, other.KeyFingerprint)
+}
+
+func TestDebugVerifyWithoutSignature(t *testing.T) {
+	debug := DebugVerify(&http.Request{Header: http.Header{}}, testKey)
+	assert.False(t, debug.Valid)
+	assert.EqualError(t, debug.Err, ErrorNoSignatureHeaderFoundInRequest)
+	assert.Nil(t, debug.SigningString)
+}
+
+func TestSigningString(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo?param=value", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	s, err := SigningString(r, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "date: "+testDate, s)
+
+	s, err = SigningString(r, []string{"(request-target)", "Host", "date"})
+	assert.Nil(t, err)
+	assert.Equal(t, "(request-target): post /foo?param=value\nhost: example.com\ndate: "+testDate, s)
+
+	_, err = SigningString(r, []string{"digest"})
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'digest'")
+
+	// the same string the signature signs
+	err = NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "host", "date").Sign(r)
+	assert.Nil(t, err)
+	var sig SignatureParameters
+	err = sig.FromRequest(r)
+	assert.Nil(t, err)
+	signed, err := sig.SigningString()
+	assert.Nil(t, err)
+	assert.Equal(t, s, signed)
+}
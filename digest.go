@@ -0,0 +1,451 @@
+package httpsignatures
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// HeaderDigest is the draft-cavage body digest header (RFC 3230)
+	HeaderDigest string = "digest"
+	// HeaderContentDigest is the RFC 9421 body digest header (RFC 9530)
+	HeaderContentDigest string = "content-digest"
+)
+
+// digestAlgorithms are the supported digest algorithms, by their lowercase
+// name as used in both the Digest and the Content-Digest header
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// AddDigests computes the digests of the request body and sets both the
+// Digest and the Content-Digest header, so the request can be signed for
+// draft-cavage as well as RFC 9421 verifiers. Without algorithms only
+// SHA-256 is used, with several algorithms the headers list one digest per
+// algorithm, eg `Digest: SHA-256=X48E9q...,SHA-512=WZDPaV...`. The body is
+// restored so it can still be sent.
+func AddDigests(r *http.Request, algorithms ...string) error {
+	if len(algorithms) == 0 {
+		algorithms = []string{"SHA-256"}
+	}
+	hashes, err := newDigestHashes(algorithms)
+	if err != nil {
+		return err
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		h.Write(body)
+	}
+	setDigestHeaders(r.Header, hashes)
+	return nil
+}
+
+// SetDigest adds a digest computed by the caller, eg while the body was
+// written to disk, to the Digest and Content-Digest headers, so the body
+// doesn't have to be read again before signing. The body is not checked
+// against the digest.
+func SetDigest(r *http.Request, algorithm string, sum []byte) error {
+	name := strings.ToLower(algorithm)
+	if _, ok := digestAlgorithms[name]; !ok {
+		return fmt.Errorf("%w '%s'", ErrUnsupportedDigestAlgorithm, algorithm)
+	}
+	digest, contentDigest := formatDigest(name, sum)
+	if value := r.Header.Get(HeaderDigest); value != "" {
+		digest = value + "," + digest
+	}
+	if value := r.Header.Get(HeaderContentDigest); value != "" {
+		contentDigest = value + ", " + contentDigest
+	}
+	r.Header.Set(HeaderDigest, digest)
+	r.Header.Set(HeaderContentDigest, contentDigest)
+	return nil
+}
+
+// AddTrailerDigests hashes the request body while it is sent and sends the
+// Digest and Content-Digest headers as trailers, so a large body is never
+// held in memory. The request is sent with chunked transfer encoding. A
+// signature covers headers only, so it can't cover trailer digests: use
+// AddDigests or SetDigest when the digest has to be signed.
+func AddTrailerDigests(r *http.Request, algorithms ...string) error {
+	if len(algorithms) == 0 {
+		algorithms = []string{"SHA-256"}
+	}
+	hashes, err := newDigestHashes(algorithms)
+	if err != nil {
+		return err
+	}
+
+	if r.Trailer == nil {
+		r.Trailer = http.Header{}
+	}
+	// announced before the body is sent, set once it has been read
+	r.Trailer[http.CanonicalHeaderKey(HeaderDigest)] = nil
+	r.Trailer[http.CanonicalHeaderKey(HeaderContentDigest)] = nil
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	r.Body = &digestReader{
+		body:   body,
+		hashes: hashes,
+		eof: func() error {
+			setDigestHeaders(r.Trailer, hashes)
+			return nil
+		},
+	}
+	r.ContentLength = -1
+	r.GetBody = nil
+	return nil
+}
+
+// digestHash is a running digest of the body
+type digestHash struct {
+	// algorithm is the lowercase name of the digest algorithm
+	algorithm string
+	hash.Hash
+}
+
+// newDigestHashes returns a running digest for each of the algorithms
+func newDigestHashes(algorithms []string) ([]digestHash, error) {
+	var hashes []digestHash
+	for _, algorithm := range algorithms {
+		name := strings.ToLower(algorithm)
+		newHash, ok := digestAlgorithms[name]
+		if !ok {
+			return nil, fmt.Errorf("%w '%s'", ErrUnsupportedDigestAlgorithm, algorithm)
+		}
+		hashes = append(hashes, digestHash{name, newHash()})
+	}
+	return hashes, nil
+}
+
+// setDigestHeaders sets the Digest and Content-Digest header to the digests
+func setDigestHeaders(header http.Header, hashes []digestHash) {
+	var digests, contentDigests []string
+	for _, h := range hashes {
+		digest, contentDigest := formatDigest(h.algorithm, h.Sum(nil))
+		digests = append(digests, digest)
+		contentDigests = append(contentDigests, contentDigest)
+	}
+	header.Set(HeaderDigest, strings.Join(digests, ","))
+	header.Set(HeaderContentDigest, strings.Join(contentDigests, ", "))
+}
+
+// formatDigest returns a Digest and a Content-Digest member for sum
+func formatDigest(algorithm string, sum []byte) (string, string) {
+	b64 := base64.StdEncoding.EncodeToString(sum)
+	return strings.ToUpper(algorithm) + "=" + b64, algorithm + "=:" + b64 + ":"
+}
+
+// StreamDigest checks the request body against the Digest and
+// Content-Digest headers while it is read, instead of reading it up front
+// like VerifyDigest, so nothing is buffered. r.Body is replaced: once the
+// body was read completely, its Read returns ErrDigestMismatch instead of
+// io.EOF when a digest doesn't match, so handlers must check the read error
+// before acting on the body. Without digest headers the digests may be sent
+// as trailers, see AddTrailerDigests.
+func StreamDigest(r *http.Request) error {
+	digests, err := parseDigestHeaders(r.Header)
+	if err != nil {
+		return err
+	}
+	if len(digests) == 0 && !hasTrailerDigest(r.Trailer) {
+		return ErrNoDigestHeader
+	}
+
+	// hashed for every supported algorithm, the trailers aren't known yet
+	var algorithms []string
+	for algorithm := range digestAlgorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	hashes, _ := newDigestHashes(algorithms)
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	r.Body = &digestReader{
+		body:   body,
+		hashes: hashes,
+		eof: func() error {
+			if len(digests) == 0 {
+				// the trailers are set once the body was read
+				var err error
+				if digests, err = parseDigestHeaders(r.Trailer); err != nil {
+					return err
+				}
+				if len(digests) == 0 {
+					return ErrNoDigestHeader
+				}
+			}
+			return checkDigests(digests, hashes)
+		},
+	}
+	return nil
+}
+
+// hasTrailerDigest reports whether a digest trailer was announced
+func hasTrailerDigest(trailer http.Header) bool {
+	_, digest := trailer[http.CanonicalHeaderKey(HeaderDigest)]
+	_, contentDigest := trailer[http.CanonicalHeaderKey(HeaderContentDigest)]
+	return digest || contentDigest
+}
+
+// checkDigests compares the digests with the running digests of the body.
+// Every digest with a supported algorithm must match.
+func checkDigests(digests []bodyDigest, hashes []digestHash) error {
+	supported := false
+	for _, digest := range digests {
+		for _, h := range hashes {
+			if h.algorithm != digest.algorithm {
+				continue
+			}
+			supported = true
+			if subtle.ConstantTimeCompare(h.Sum(nil), digest.value) != 1 {
+				return ErrDigestMismatch
+			}
+		}
+	}
+	if !supported {
+		return ErrUnsupportedDigestAlgorithm
+	}
+	return nil
+}
+
+// digestReader hashes a body while it is read, and calls eof once it was
+// read completely. An error of eof is returned instead of io.EOF.
+type digestReader struct {
+	body   io.ReadCloser
+	hashes []digestHash
+	eof    func() error
+	err    error
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.body.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if eofErr := d.eof(); eofErr != nil {
+			err = eofErr
+		}
+	}
+	d.err = err
+	return n, err
+}
+
+func (d *digestReader) Close() error {
+	return d.body.Close()
+}
+
+// DefaultMaxBody is the largest body VerifyDigest reads
+const DefaultMaxBody = 32 << 20
+
+// VerifyDigest checks the request body against the Digest and
+// Content-Digest headers. The body is streamed through the hashes instead of
+// being read up front: at most maxMemory bytes are buffered in memory, larger
+// bodies spill over to a temporary file. Afterwards r.Body is replaced so
+// downstream handlers can still read the body. The temporary file is
+// unlinked right away where the system allows it, elsewhere closing the
+// body removes it. Bodies larger than DefaultMaxBody fail with
+// ErrBodyTooLarge, see VerifyDigestLimit.
+//
+// Every digest with a supported algorithm (SHA-256, SHA-512) must match,
+// digests with other algorithms are ignored.
+func VerifyDigest(r *http.Request, maxMemory int64) error {
+	return VerifyDigestLimit(r, maxMemory, DefaultMaxBody)
+}
+
+// VerifyDigestLimit is VerifyDigest failing with ErrBodyTooLarge for bodies
+// larger than maxBody bytes, DefaultMaxBody when 0 and any size when
+// negative
+func VerifyDigestLimit(r *http.Request, maxMemory int64, maxBody int64) error {
+	digests, err := parseDigestHeaders(r.Header)
+	if err != nil {
+		return err
+	}
+	if len(digests) == 0 {
+		return ErrNoDigestHeader
+	}
+
+	hashes := map[string]hash.Hash{}
+	buffer := &spillBuffer{maxMemory: maxMemory}
+	writers := []io.Writer{buffer}
+	for _, digest := range digests {
+		if newHash, ok := digestAlgorithms[digest.algorithm]; ok && hashes[digest.algorithm] == nil {
+			hashes[digest.algorithm] = newHash()
+			writers = append(writers, hashes[digest.algorithm])
+		}
+	}
+	if len(hashes) == 0 {
+		return ErrUnsupportedDigestAlgorithm
+	}
+
+	if maxBody == 0 {
+		maxBody = DefaultMaxBody
+	}
+	if r.Body != nil {
+		body := io.Reader(r.Body)
+		if maxBody > 0 {
+			body = io.LimitReader(body, maxBody+1)
+		}
+		n, err := io.Copy(io.MultiWriter(writers...), body)
+		r.Body.Close()
+		if err == nil && maxBody > 0 && n > maxBody {
+			err = ErrBodyTooLarge
+		}
+		if err != nil {
+			buffer.Close()
+			return err
+		}
+	}
+	if r.Body, err = buffer.body(); err != nil {
+		return err
+	}
+
+	for _, digest := range digests {
+		if h, ok := hashes[digest.algorithm]; ok {
+			if subtle.ConstantTimeCompare(h.Sum(nil), digest.value) != 1 {
+				return ErrDigestMismatch
+			}
+		}
+	}
+	return nil
+}
+
+type bodyDigest struct {
+	algorithm string
+	value     []byte
+}
+
+// parseDigestHeaders returns the digests listed in the Digest header, eg
+// `SHA-256=X48E9q...,SHA-512=WZDPaV...`, and in the Content-Digest header,
+// eg `sha-256=:X48E9q...:, sha-512=:WZDPaV...:`
+func parseDigestHeaders(header http.Header) ([]bodyDigest, error) {
+	var digests []bodyDigest
+	for _, name := range []string{HeaderDigest, HeaderContentDigest} {
+		for _, value := range header[http.CanonicalHeaderKey(name)] {
+			for _, member := range strings.Split(value, ",") {
+				parts := strings.SplitN(strings.TrimSpace(member), "=", 2)
+				if len(parts) != 2 {
+					return nil, ErrInvalidDigestHeader
+				}
+				encoded := parts[1]
+				if name == HeaderContentDigest {
+					// byte sequence, possibly followed by parameters
+					encoded = strings.SplitN(encoded, ";", 2)[0]
+					if len(encoded) < 2 || encoded[0] != ':' || encoded[len(encoded)-1] != ':' {
+						return nil, ErrInvalidDigestHeader
+					}
+					encoded = encoded[1 : len(encoded)-1]
+				}
+				sum, err := base64.StdEncoding.DecodeString(encoded)
+				if err != nil {
+					return nil, ErrInvalidDigestHeader
+				}
+				digests = append(digests, bodyDigest{strings.ToLower(parts[0]), sum})
+			}
+		}
+	}
+	return digests, nil
+}
+
+// readBody reads the complete request body and replaces it with a copy
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// spillBuffer buffers up to maxMemory bytes in memory and moves the data
+// to a temporary file when more is written
+type spillBuffer struct {
+	maxMemory int64
+	memory    bytes.Buffer
+	file      *os.File
+	// unlinked is set when the file was removed while open, it is gone once
+	// closed, or garbage collected when the body is never closed
+	unlinked bool
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && int64(b.memory.Len()+len(p)) > b.maxMemory {
+		file, err := ioutil.TempFile("", "httpsignatures-body-")
+		if err != nil {
+			return 0, err
+		}
+		b.file = file
+		// fails on Windows, which can't remove open files
+		b.unlinked = os.Remove(file.Name()) == nil
+		if _, err := b.memory.WriteTo(b.file); err != nil {
+			return 0, err
+		}
+	}
+	if b.file != nil {
+		return b.file.Write(p)
+	}
+	return b.memory.Write(p)
+}
+
+// body returns the buffered data as a request body
+func (b *spillBuffer) body() (io.ReadCloser, error) {
+	if b.file == nil {
+		return ioutil.NopCloser(bytes.NewReader(b.memory.Bytes())), nil
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return tempFileBody{b.file, b.unlinked}, nil
+}
+
+// Close removes the temporary file, if any
+func (b *spillBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	return tempFileBody{b.file, b.unlinked}.Close()
+}
+
+// tempFileBody is a request body read from a temporary file, which is
+// removed when the body is closed unless it was unlinked already
+type tempFileBody struct {
+	*os.File
+	unlinked bool
+}
+
+func (f tempFileBody) Close() error {
+	err := f.File.Close()
+	if !f.unlinked {
+		os.Remove(f.Name())
+	}
+	return err
+}
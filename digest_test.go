@@ -0,0 +1,355 @@
+package httpsignatures
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testBody               = `{"hello": "world"}`
+	testBodySha256         = "X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="
+	testBodyDigest         = "SHA-256=" + testBodySha256
+	testBodyContentDigest  = "sha-256=:" + testBodySha256 + ":"
+	testEmptyBodySha256    = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	testEmptyBodyDigest    = "SHA-256=" + testEmptyBodySha256
+	testEmptyContentDigest = "sha-256=:" + testEmptyBodySha256 + ":"
+)
+
+func TestAddDigests(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+
+	err = AddDigests(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testBodyDigest, r.Header.Get("Digest"))
+	assert.Equal(t, testBodyContentDigest, r.Header.Get("Content-Digest"))
+
+	// the body can still be read
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(body))
+}
+
+func TestAddDigestsWithoutBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+
+	err = AddDigests(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testEmptyBodyDigest, r.Header.Get("Digest"))
+	assert.Equal(t, testEmptyContentDigest, r.Header.Get("Content-Digest"))
+}
+
+func TestAddDigestsMultipleAlgorithms(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+
+	err = AddDigests(r, "SHA-256", "sha-512")
+	assert.Nil(t, err)
+	assert.Equal(t, "SHA-256="+testBodySha256+",SHA-512="+testBodySha512, r.Header.Get("Digest"))
+	assert.Equal(t, "sha-256=:"+testBodySha256+":, sha-512=:"+testBodySha512+":", r.Header.Get("Content-Digest"))
+
+	// both digests are checked against the restored body
+	err = VerifyDigest(r, defaultMaxBodyMemory)
+	assert.Nil(t, err)
+}
+
+func TestAddDigestsUnsupportedAlgorithm(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+
+	err = AddDigests(r, "SHA-256", "MD5")
+	assert.EqualError(t, err, ErrorUnsupportedDigestAlgorithm+" 'MD5'")
+	assert.Equal(t, "", r.Header.Get("Digest"))
+}
+
+func TestSignBothDigests(t *testing.T) {
+	for _, header := range []string{HeaderDigest, HeaderContentDigest} {
+		r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+		assert.Nil(t, err)
+		err = AddDigests(r)
+		assert.Nil(t, err)
+
+		signer := NewSigner("hmac-sha256", header)
+		err = signer.SignRequest(r, testKeyID, testKey)
+		assert.Nil(t, err)
+
+		res, err := VerifyRequest(r, keyLookUp, -1, header)
+		assert.True(t, res)
+		assert.Nil(t, err)
+	}
+}
+
+const testBodySha512 = "WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew=="
+
+func TestVerifyDigest(t *testing.T) {
+	headers := []http.Header{
+		{"Digest": []string{testBodyDigest}},
+		{"Content-Digest": []string{testBodyContentDigest}},
+		{"Digest": []string{"SHA-256=" + testBodySha256 + ",SHA-512=" + testBodySha512}},
+		{"Digest": []string{"MD5=Sd/dVLAcvNLSq16eXua5uQ==, SHA-512=" + testBodySha512}},
+		{"Content-Digest": []string{"sha-512=:" + testBodySha512 + ":, sha-256=:" + testBodySha256 + ":"}},
+	}
+
+	for _, header := range headers {
+		r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+		assert.Nil(t, err)
+		r.Header = header
+
+		err = VerifyDigest(r, 1024)
+		assert.Nil(t, err, header)
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, testBody, string(body))
+	}
+}
+
+func TestVerifyDigestTamperedBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	r.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "mallory"}`))
+	err = VerifyDigest(r, 1024)
+	assert.EqualError(t, err, ErrorDigestDoesNotMatch)
+
+	// only one of multiple digests matching is not enough
+	r.Body = ioutil.NopCloser(strings.NewReader(testBody))
+	r.Header.Set("Digest", "SHA-256="+testBodySha256+",SHA-512="+testEmptyBodySha256)
+	err = VerifyDigest(r, 1024)
+	assert.EqualError(t, err, ErrorDigestDoesNotMatch)
+}
+
+func TestVerifyDigestSpillsToDisk(t *testing.T) {
+	body := strings.Repeat(testBody, 100)
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(body))
+	assert.Nil(t, err)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	err = VerifyDigest(r, 16)
+	assert.Nil(t, err)
+
+	file, ok := r.Body.(tempFileBody)
+	assert.True(t, ok)
+	if file.unlinked {
+		// nothing is left on disk when the body is never closed
+		_, err = os.Stat(file.Name())
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	read, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(read))
+
+	// closing the body removes the temporary file
+	assert.Nil(t, r.Body.Close())
+	_, err = os.Stat(file.Name())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestVerifyDigestMaxBody(t *testing.T) {
+	body := strings.Repeat(testBody, 100)
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Nil(t, AddDigests(r))
+
+	err = VerifyDigestLimit(r, 16, int64(len(body)-1))
+	assert.Equal(t, ErrBodyTooLarge, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, ErrorHTTPStatus(err))
+
+	r.Body = ioutil.NopCloser(strings.NewReader(body))
+	assert.Nil(t, VerifyDigestLimit(r, 16, int64(len(body))))
+	r.Body.Close()
+
+	r.Body = ioutil.NopCloser(strings.NewReader(body))
+	v := NewVerifier(keyLookUp, -1)
+	v.MaxBody = 16
+	r.Header.Set("Date", testDate)
+	assert.Nil(t, NewSigner(AlgorithmHmacSha256, "date", "digest").SignRequest(r, testKeyID, testKey))
+	v.CheckDigest = true
+	_, err = v.VerifyRequest(r)
+	assert.Equal(t, ErrBodyTooLarge, err)
+}
+
+func TestVerifyDigestInvalidHeaders(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		err    string
+	}{
+		{http.Header{}, ErrorNoDigestHeaderFoundInRequest},
+		{http.Header{"Digest": []string{"MD5=Sd/dVLAcvNLSq16eXua5uQ=="}}, ErrorUnsupportedDigestAlgorithm},
+		{http.Header{"Digest": []string{"SHA-256"}}, ErrorInvalidDigestHeader},
+		{http.Header{"Digest": []string{"SHA-256=not base64"}}, ErrorInvalidDigestHeader},
+		{http.Header{"Content-Digest": []string{"sha-256=" + testBodySha256}}, ErrorInvalidDigestHeader},
+	}
+
+	for _, test := range tests {
+		r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+		assert.Nil(t, err)
+		r.Header = test.header
+
+		err = VerifyDigest(r, 1024)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestSignerDigestAlgorithms(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	signer := NewSigner("hmac-sha256", "(request-target)", "date")
+	signer.DigestAlgorithms = []string{"SHA-512"}
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "SHA-512="+testBodySha512, r.Header.Get("Digest"))
+	assert.Contains(t, r.Header.Get("Signature"), `headers="(request-target) date digest"`)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.CheckDigest = true
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the body still reads after verification
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(body))
+}
+
+func TestVerifierCheckDigestTamperedBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	signer := NewSigner("hmac-sha256", "date", "content-digest")
+	signer.DigestAlgorithms = []string{"SHA-256"}
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Contains(t, r.Header.Get("Signature"), `headers="date content-digest"`)
+
+	r.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "mallory"}`))
+
+	// the signature over the headers is still valid
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.CheckDigest = true
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorDigestDoesNotMatch)
+}
+
+func TestSetDigest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+
+	sum := sha256.Sum256([]byte(testBody))
+	err = SetDigest(r, "SHA-256", sum[:])
+	assert.Nil(t, err)
+	sum512 := sha512.Sum512([]byte(testBody))
+	err = SetDigest(r, "sha-512", sum512[:])
+	assert.Nil(t, err)
+	assert.Equal(t, testBodyDigest+",SHA-512="+testBodySha512, r.Header.Get("Digest"))
+	assert.Equal(t, testBodyContentDigest+", sha-512=:"+testBodySha512+":", r.Header.Get("Content-Digest"))
+
+	err = VerifyDigest(r, 0)
+	assert.Nil(t, err)
+
+	err = SetDigest(r, "MD5", sum[:])
+	assert.EqualError(t, err, ErrorUnsupportedDigestAlgorithm+" 'MD5'")
+}
+
+func TestAddTrailerDigests(t *testing.T) {
+	var received []byte
+	var receivedErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.Header.Get("Digest"))
+		assert.Nil(t, StreamDigest(r))
+		received, receivedErr = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	r, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(testBody))
+	assert.Nil(t, err)
+	err = AddTrailerDigests(r)
+	assert.Nil(t, err)
+	resp, err := http.DefaultClient.Do(r)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Nil(t, receivedErr)
+	assert.Equal(t, testBody, string(received))
+	assert.Equal(t, testBodyDigest, r.Trailer.Get("Digest"))
+	assert.Equal(t, testBodyContentDigest, r.Trailer.Get("Content-Digest"))
+}
+
+func TestStreamDigest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Digest", testBodyDigest)
+
+	err = StreamDigest(r)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(body))
+}
+
+func TestStreamDigestTamperedBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody+" "))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Digest", testBodyContentDigest)
+
+	err = StreamDigest(r)
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r.Body)
+	assert.Equal(t, ErrDigestMismatch, err)
+}
+
+func TestStreamDigestWithoutDigest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrNoDigestHeader, StreamDigest(r))
+}
+
+func TestVerifierStreamDigest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody+" "))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Set("Digest", testBodyDigest)
+	err = NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "date", "digest").Sign(r)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1, "digest")
+	v.CheckDigest = true
+	v.StreamDigest = true
+	result, err := v.Verify(r)
+	assert.Nil(t, err)
+	// nothing was checked yet
+	assert.False(t, result.DigestVerified)
+	assert.True(t, result.DigestPending)
+
+	// the tampered body is detected while it is read
+	_, err = ioutil.ReadAll(r.Body)
+	assert.Equal(t, ErrDigestMismatch, err)
+
+	v.StreamDigest = false
+	r.Body = ioutil.NopCloser(strings.NewReader(testBody))
+	result, err = v.Verify(r)
+	assert.Nil(t, err)
+	assert.True(t, result.DigestVerified)
+	assert.False(t, result.DigestPending)
+}
@@ -1,6 +1,8 @@
 package httpsignatures
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -20,8 +22,158 @@ var (
 	ErrorRequiredHeaderNotInHeaderList             = "Required header not in header list"
 	ErrorDateHeaderIsMissingForClockSkewComparison = "Date header is missing for clockSkew comparison"
 	ErrorNoHeadersConfigLoaded                     = "No headers config loaded"
+	ErrorSignedHeadersDoNotMatchRequiredSet        = "Signed headers do not match the required header set"
+	ErrorNoTLSClientCertificate                    = "No TLS client certificate presented"
+	ErrorKeyIDDoesNotMatchTLSClientCertificate     = "keyId does not match the TLS client certificate"
+	ErrorCriticalFieldNotSigned                    = "Critical request field not signed"
+	ErrorTooFewSignedHeaders                       = "Signature covers too few headers"
+	ErrorNoDigestHeaderFoundInRequest              = "No Digest or Content-Digest header found in request"
+	ErrorInvalidDigestHeader                       = "Invalid Digest or Content-Digest header"
+	ErrorUnsupportedDigestAlgorithm                = "No supported digest algorithm in Digest or Content-Digest header"
+	ErrorDigestDoesNotMatch                        = "Body digest does not match"
+	ErrorUnknownKeyID                              = "Unknown keyId"
+	ErrorSHA1AlgorithmNotAllowed                   = "SHA-1 based algorithms are not allowed"
+	ErrorInvalidEd25519PrivateKey                  = "Invalid ed25519 private key, expected a 64 byte key, a 32 byte seed or a PKCS #8 key"
+	ErrorInvalidEd25519PublicKey                   = "Invalid ed25519 public key, expected a 32 byte key or a PKIX key"
+	ErrorMissingSignatureParameterCreated          = "Missing signature parameter 'created'"
+	ErrorMissingSignatureParameterExpires          = "Missing signature parameter 'expires'"
+	ErrorInvalidSignatureParameter                 = "Invalid signature parameter"
+	ErrorSignatureExpired                          = "Signature expired"
+	ErrorSignatureCreatedInTheFuture               = "Signature created in the future"
+	ErrorRequestTargetWithoutRequest               = "Signature covers (request-target) but the response has no request"
+	ErrorMalformedSignatureHeader                  = "Malformed Signature header"
+	ErrorInvalidEcdsaPrivateKey                    = "Invalid ECDSA private key, expected a PEM or DER encoded EC key"
+	ErrorInvalidEcdsaPublicKey                     = "Invalid ECDSA public key, expected a PEM or DER encoded PKIX EC key"
+	ErrorUnknownAlgorithm                          = "Unknown signature algorithm provided"
+	ErrorMissingSignatureParameterHeaders          = "Missing signature parameter 'headers'"
+	ErrorInvalidRsaPrivateKey                      = "Invalid RSA private key, expected a PEM or DER encoded RSA key"
+	ErrorInvalidRsaPublicKey                       = "Invalid RSA public key, expected a PEM or DER encoded PKIX or PKCS #1 RSA key"
+	ErrorUnsupportedComponent                      = "Unsupported derived component"
+	ErrorSignatureReplayed                         = "Signature was used before"
+	ErrorInvalidPEMKey                             = "Invalid PEM encoded key"
+	ErrorPEMPassphraseRequired                     = "PEM encoded key is encrypted, a passphrase is required"
+	ErrorCryptoSignerAlgorithm                     = "Algorithm can't sign with a crypto.Signer"
+	ErrorInvalidDateHeader                         = "Invalid Date header"
+	ErrorInvalidKeyEncoding                        = "Key is not base64 encoded"
+	ErrorUnsupportedKeyType                        = "Unsupported key type"
+	ErrorAlgorithmKeyMismatch                      = "Signature algorithm doesn't match the key"
+	ErrorKeyNotValid                               = "Key is expired or not valid yet"
+	ErrorRepeatedQueryParameter                    = "Signed query parameter occurs more than once"
+	ErrorDuplicateSignatureParameter               = "Duplicate signature parameter"
+	ErrorUnknownPseudoHeader                       = "Unknown pseudo-header"
+	ErrorHopByHopHeader                            = "Hop-by-hop header can't be signed"
+	ErrorBodyTooLarge                              = "Body is too large to verify its digest"
+	ErrorDigestWithoutBody                         = "A message has no body to check against its digest"
+	ErrorTooManySignatures                         = "Request carries too many signatures"
 )
 
+// The errors returned by this package wrap one of these values, so the
+// failure can be told apart with errors.Is, eg a malformed request from a
+// signature which doesn't match. Their messages are the Error strings above.
+var (
+	ErrNoAlgorithmConfigured       = errors.New(ErrorNoAlgorithmConfigured)
+	ErrNoKeyIDConfigured           = errors.New(ErrorNoKeyIDConfigured)
+	ErrNoHeadersConfigLoaded       = errors.New(ErrorNoHeadersConfigLoaded)
+	ErrMissingRequiredHeader       = errors.New(ErrorMissingRequiredHeader)
+	ErrMissingSignature            = errors.New(ErrorMissingSignatureParameterSignature)
+	ErrMissingAlgorithm            = errors.New(ErrorMissingSignatureParameterAlgorithm)
+	ErrMissingKeyID                = errors.New(ErrorMissingSignatureParameterKeyId)
+	ErrMissingCreated              = errors.New(ErrorMissingSignatureParameterCreated)
+	ErrMissingExpires              = errors.New(ErrorMissingSignatureParameterExpires)
+	ErrMissingHeaders              = errors.New(ErrorMissingSignatureParameterHeaders)
+	ErrInvalidSignatureParameter   = errors.New(ErrorInvalidSignatureParameter)
+	ErrMalformedSignatureHeader    = errors.New(ErrorMalformedSignatureHeader)
+	ErrNoSignatureHeader           = errors.New(ErrorNoSignatureHeaderFoundInRequest)
+	ErrURLNotInRequest             = errors.New(ErrorURLNotInRequest)
+	ErrMethodNotInRequest          = errors.New(ErrorMethodNotInRequest)
+	ErrRequestTargetWithoutRequest = errors.New(ErrorRequestTargetWithoutRequest)
+	ErrUnknownAlgorithm            = errors.New(ErrorUnknownAlgorithm)
+	ErrSHA1AlgorithmNotAllowed     = errors.New(ErrorSHA1AlgorithmNotAllowed)
+	ErrUnknownKeyID                = errors.New(ErrorUnknownKeyID)
+	ErrSignatureMismatch           = errors.New(ErrorSignatureDdoNotMatch)
+	ErrClockSkewExceeded           = errors.New(ErrorAllowedClockskewExceeded)
+	ErrMisconfiguredClockSkew      = errors.New(ErrorYouProbablyMisconfiguredAllowedClockSkew)
+	ErrMissingDateHeader           = errors.New(ErrorDateHeaderIsMissingForClockSkewComparison)
+	ErrSignatureExpired            = errors.New(ErrorSignatureExpired)
+	ErrSignatureCreatedInTheFuture = errors.New(ErrorSignatureCreatedInTheFuture)
+	ErrRequiredHeaderNotSigned     = errors.New(ErrorRequiredHeaderNotInHeaderList)
+	ErrSignedHeadersMismatch       = errors.New(ErrorSignedHeadersDoNotMatchRequiredSet)
+	ErrTooFewSignedHeaders         = errors.New(ErrorTooFewSignedHeaders)
+	ErrCriticalFieldNotSigned      = errors.New(ErrorCriticalFieldNotSigned)
+	ErrNoTLSClientCertificate      = errors.New(ErrorNoTLSClientCertificate)
+	ErrKeyIDTLSClientMismatch      = errors.New(ErrorKeyIDDoesNotMatchTLSClientCertificate)
+	ErrNoDigestHeader              = errors.New(ErrorNoDigestHeaderFoundInRequest)
+	ErrInvalidDigestHeader         = errors.New(ErrorInvalidDigestHeader)
+	ErrUnsupportedDigestAlgorithm  = errors.New(ErrorUnsupportedDigestAlgorithm)
+	ErrDigestMismatch              = errors.New(ErrorDigestDoesNotMatch)
+	ErrInvalidEd25519PrivateKey    = errors.New(ErrorInvalidEd25519PrivateKey)
+	ErrInvalidEd25519PublicKey     = errors.New(ErrorInvalidEd25519PublicKey)
+	ErrInvalidEcdsaPrivateKey      = errors.New(ErrorInvalidEcdsaPrivateKey)
+	ErrInvalidEcdsaPublicKey       = errors.New(ErrorInvalidEcdsaPublicKey)
+	ErrInvalidRsaPrivateKey        = errors.New(ErrorInvalidRsaPrivateKey)
+	ErrInvalidRsaPublicKey         = errors.New(ErrorInvalidRsaPublicKey)
+	ErrUnsupportedComponent        = errors.New(ErrorUnsupportedComponent)
+	ErrSignatureReplayed           = errors.New(ErrorSignatureReplayed)
+	ErrInvalidPEMKey               = errors.New(ErrorInvalidPEMKey)
+	ErrPEMPassphraseRequired       = errors.New(ErrorPEMPassphraseRequired)
+	ErrCryptoSignerAlgorithm       = errors.New(ErrorCryptoSignerAlgorithm)
+	ErrInvalidDateHeader           = errors.New(ErrorInvalidDateHeader)
+	ErrInvalidKeyEncoding          = errors.New(ErrorInvalidKeyEncoding)
+	ErrUnsupportedKeyType          = errors.New(ErrorUnsupportedKeyType)
+	ErrAlgorithmKeyMismatch        = errors.New(ErrorAlgorithmKeyMismatch)
+	ErrKeyNotValid                 = errors.New(ErrorKeyNotValid)
+	ErrRepeatedQueryParameter      = errors.New(ErrorRepeatedQueryParameter)
+	ErrDuplicateSignatureParameter = errors.New(ErrorDuplicateSignatureParameter)
+	ErrUnknownPseudoHeader         = errors.New(ErrorUnknownPseudoHeader)
+	ErrHopByHopHeader              = errors.New(ErrorHopByHopHeader)
+	ErrBodyTooLarge                = errors.New(ErrorBodyTooLarge)
+	ErrDigestWithoutBody           = errors.New(ErrorDigestWithoutBody)
+	ErrTooManySignatures           = errors.New(ErrorTooManySignatures)
+)
+
+// ErrorHTTPStatus returns the status code to respond with when verifying a
+// request fails with err: 401 when the signature is missing, replayed or
+// doesn't match a known and valid key, including a key that doesn't fit
+// the keyId and algorithm the client chose, 413 for a body too large to
+// digest, 500 for configuration problems, 400 otherwise
+func ErrorHTTPStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	for _, unauthorized := range []error{
+		ErrNoSignatureHeader, ErrUnknownKeyID, ErrSignatureMismatch, ErrSignatureReplayed, ErrKeyNotValid,
+		ErrInvalidEd25519PublicKey, ErrInvalidEcdsaPublicKey, ErrInvalidRsaPublicKey, ErrUnsupportedKeyType,
+	} {
+		if errors.Is(err, unauthorized) {
+			return http.StatusUnauthorized
+		}
+	}
+	for _, configuration := range []error{
+		ErrNoAlgorithmConfigured, ErrNoKeyIDConfigured, ErrNoHeadersConfigLoaded, ErrMisconfiguredClockSkew,
+		ErrInvalidEd25519PrivateKey, ErrInvalidEcdsaPrivateKey, ErrInvalidRsaPrivateKey, ErrInvalidPEMKey,
+		ErrPEMPassphraseRequired, ErrCryptoSignerAlgorithm, ErrInvalidKeyEncoding, ErrDigestWithoutBody,
+	} {
+		if errors.Is(err, configuration) {
+			return http.StatusInternalServerError
+		}
+	}
+	return http.StatusBadRequest
+}
+
+// MissingHeaderError is returned when a header covered by the signature is
+// not in the request, it wraps ErrMissingRequiredHeader
+type MissingHeaderError struct {
+	Header string
+}
+
+func (e *MissingHeaderError) Error() string {
+	return fmt.Sprintf("%s '%s'", ErrorMissingRequiredHeader, e.Header)
+}
+
+func (e *MissingHeaderError) Unwrap() error {
+	return ErrMissingRequiredHeader
+}
+
 func ErrorToHTTPCode(errString string) (int, string) {
 	switch errString {
 	case ErrorNoAlgorithmConfigured:
@@ -30,6 +182,22 @@ func ErrorToHTTPCode(errString string) (int, string) {
 		return http.StatusInternalServerError, ErrorNoKeyIDConfigured
 	case ErrorNoHeadersConfigLoaded:
 		return http.StatusInternalServerError, ErrorNoHeadersConfigLoaded
+	case ErrorInvalidEd25519PrivateKey:
+		return http.StatusInternalServerError, ErrorInvalidEd25519PrivateKey
+	case ErrorInvalidEd25519PublicKey:
+		return http.StatusInternalServerError, ErrorInvalidEd25519PublicKey
+	case ErrorInvalidEcdsaPrivateKey:
+		return http.StatusInternalServerError, ErrorInvalidEcdsaPrivateKey
+	case ErrorInvalidEcdsaPublicKey:
+		return http.StatusInternalServerError, ErrorInvalidEcdsaPublicKey
+	case ErrorMissingSignatureParameterHeaders:
+		return http.StatusBadRequest, ErrorMissingSignatureParameterHeaders
+	case ErrorInvalidRsaPrivateKey:
+		return http.StatusInternalServerError, ErrorInvalidRsaPrivateKey
+	case ErrorInvalidRsaPublicKey:
+		return http.StatusInternalServerError, ErrorInvalidRsaPublicKey
+	case ErrorUnknownAlgorithm:
+		return http.StatusBadRequest, ErrorUnknownAlgorithm
 	case ErrorYouProbablyMisconfiguredAllowedClockSkew:
 		return http.StatusInternalServerError, ErrorYouProbablyMisconfiguredAllowedClockSkew
 	case ErrorMissingRequiredHeader:
@@ -54,6 +222,76 @@ func ErrorToHTTPCode(errString string) (int, string) {
 		return http.StatusBadRequest, ErrorRequiredHeaderNotInHeaderList
 	case ErrorDateHeaderIsMissingForClockSkewComparison:
 		return http.StatusBadRequest, ErrorDateHeaderIsMissingForClockSkewComparison
+	case ErrorSignedHeadersDoNotMatchRequiredSet:
+		return http.StatusBadRequest, ErrorSignedHeadersDoNotMatchRequiredSet
+	case ErrorNoTLSClientCertificate:
+		return http.StatusBadRequest, ErrorNoTLSClientCertificate
+	case ErrorKeyIDDoesNotMatchTLSClientCertificate:
+		return http.StatusBadRequest, ErrorKeyIDDoesNotMatchTLSClientCertificate
+	case ErrorCriticalFieldNotSigned:
+		return http.StatusBadRequest, ErrorCriticalFieldNotSigned
+	case ErrorTooFewSignedHeaders:
+		return http.StatusBadRequest, ErrorTooFewSignedHeaders
+	case ErrorNoDigestHeaderFoundInRequest:
+		return http.StatusBadRequest, ErrorNoDigestHeaderFoundInRequest
+	case ErrorInvalidDigestHeader:
+		return http.StatusBadRequest, ErrorInvalidDigestHeader
+	case ErrorUnsupportedDigestAlgorithm:
+		return http.StatusBadRequest, ErrorUnsupportedDigestAlgorithm
+	case ErrorDigestDoesNotMatch:
+		return http.StatusBadRequest, ErrorDigestDoesNotMatch
+	case ErrorUnknownKeyID:
+		return http.StatusBadRequest, ErrorUnknownKeyID
+	case ErrorSHA1AlgorithmNotAllowed:
+		return http.StatusBadRequest, ErrorSHA1AlgorithmNotAllowed
+	case ErrorMissingSignatureParameterCreated:
+		return http.StatusBadRequest, ErrorMissingSignatureParameterCreated
+	case ErrorMissingSignatureParameterExpires:
+		return http.StatusBadRequest, ErrorMissingSignatureParameterExpires
+	case ErrorInvalidSignatureParameter:
+		return http.StatusBadRequest, ErrorInvalidSignatureParameter
+	case ErrorSignatureExpired:
+		return http.StatusBadRequest, ErrorSignatureExpired
+	case ErrorSignatureCreatedInTheFuture:
+		return http.StatusBadRequest, ErrorSignatureCreatedInTheFuture
+	case ErrorRequestTargetWithoutRequest:
+		return http.StatusBadRequest, ErrorRequestTargetWithoutRequest
+	case ErrorMalformedSignatureHeader:
+		return http.StatusBadRequest, ErrorMalformedSignatureHeader
+	case ErrorUnsupportedComponent:
+		return http.StatusBadRequest, ErrorUnsupportedComponent
+	case ErrorSignatureReplayed:
+		return http.StatusBadRequest, ErrorSignatureReplayed
+	case ErrorInvalidPEMKey:
+		return http.StatusInternalServerError, ErrorInvalidPEMKey
+	case ErrorPEMPassphraseRequired:
+		return http.StatusInternalServerError, ErrorPEMPassphraseRequired
+	case ErrorCryptoSignerAlgorithm:
+		return http.StatusInternalServerError, ErrorCryptoSignerAlgorithm
+	case ErrorInvalidDateHeader:
+		return http.StatusBadRequest, ErrorInvalidDateHeader
+	case ErrorInvalidKeyEncoding:
+		return http.StatusInternalServerError, ErrorInvalidKeyEncoding
+	case ErrorUnsupportedKeyType:
+		return http.StatusInternalServerError, ErrorUnsupportedKeyType
+	case ErrorAlgorithmKeyMismatch:
+		return http.StatusBadRequest, ErrorAlgorithmKeyMismatch
+	case ErrorKeyNotValid:
+		return http.StatusBadRequest, ErrorKeyNotValid
+	case ErrorRepeatedQueryParameter:
+		return http.StatusBadRequest, ErrorRepeatedQueryParameter
+	case ErrorDuplicateSignatureParameter:
+		return http.StatusBadRequest, ErrorDuplicateSignatureParameter
+	case ErrorUnknownPseudoHeader:
+		return http.StatusBadRequest, ErrorUnknownPseudoHeader
+	case ErrorHopByHopHeader:
+		return http.StatusBadRequest, ErrorHopByHopHeader
+	case ErrorBodyTooLarge:
+		return http.StatusRequestEntityTooLarge, ErrorBodyTooLarge
+	case ErrorDigestWithoutBody:
+		return http.StatusInternalServerError, ErrorDigestWithoutBody
+	case ErrorTooManySignatures:
+		return http.StatusBadRequest, ErrorTooManySignatures
 	default:
 		return http.StatusInternalServerError, "UnknownError"
 	}
@@ -3,6 +3,7 @@ package httpsignatures_test
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/mvaneijk/httpsignatures-go"
 )
@@ -34,6 +35,39 @@ func Example_customSigning() {
 	http.DefaultClient.Do(r)
 }
 
+func Example_keySigning() {
+	signer := httpsignatures.NewKeySigner("keyId", httpsignatures.AlgorithmHmacSha256, "key",
+		httpsignatures.HeaderRequestTarget,
+		httpsignatures.HeaderDate,
+	)
+
+	r, _ := http.NewRequest("GET", "http://example.com/some-api", nil)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	if err := signer.Sign(r); err != nil {
+		panic(err)
+	}
+
+	http.DefaultClient.Do(r)
+}
+
+func Example_signerOptions() {
+	key := []byte("key")
+	signer := httpsignatures.NewSignerWithOptions("keyId", key, httpsignatures.AlgorithmHmacSha256,
+		httpsignatures.WithHeaders(httpsignatures.HeaderRequestTarget, httpsignatures.HeaderDate),
+		httpsignatures.WithDate(),
+		httpsignatures.WithDigest(),
+	)
+
+	r, _ := http.NewRequest("POST", "http://example.com/some-api", nil)
+
+	if err := signer.Sign(r); err != nil {
+		panic(err)
+	}
+
+	http.DefaultClient.Do(r)
+}
+
 func Example_verification() {
 	_ = func(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,115 @@
+// Package fasthttpsig signs and verifies the requests of
+// github.com/valyala/fasthttp, which doesn't use net/http, through the
+// httpsignatures Message:
+//
+//	verifier := httpsignatures.NewVerifier(nil, 300, "(request-target)", "host", "date")
+//	verifier.KeyStore = keys
+//	server := &fasthttp.Server{Handler: fasthttpsig.RequireSignature(verifier, api)}
+package fasthttpsig
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/valyala/fasthttp"
+)
+
+// Message adapts a fasthttp request to httpsignatures.Message. It is a
+// SchemeMessage: the scheme of a request received over TLS is "https".
+type Message struct {
+	Request *fasthttp.Request
+}
+
+// Method returns the request method
+func (m Message) Method() string {
+	return string(m.Request.Header.Method())
+}
+
+// RequestURI returns the path and query of the request
+func (m Message) RequestURI() string {
+	return string(m.Request.URI().RequestURI())
+}
+
+// Scheme returns the scheme of the request URI
+func (m Message) Scheme() string {
+	return string(m.Request.URI().Scheme())
+}
+
+// Header returns every value of the header name, and the host of the
+// request for "host"
+func (m Message) Header(name string) []string {
+	if strings.EqualFold(name, "host") {
+		if host := m.Request.Host(); len(host) > 0 {
+			return []string{string(host)}
+		}
+		return nil
+	}
+	var values []string
+	m.Request.Header.VisitAll(func(key, value []byte) {
+		if strings.EqualFold(string(key), name) {
+			values = append(values, string(value))
+		}
+	})
+	return values
+}
+
+// Sign signs the request with the key of signer and adds the signature
+// headers to it, see httpsignatures.Signer.SignMessage. The Date header is
+// set first when the signer has AddDate. DigestAlgorithms are ignored: set
+// the digest header of the body before signing.
+func Sign(signer *httpsignatures.Signer, req *fasthttp.Request) error {
+	if signer.AddDate && len(req.Header.Peek("Date")) == 0 {
+		now := time.Now()
+		if signer.Clock != nil {
+			now = signer.Clock()
+		}
+		req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	}
+
+	headers, err := signer.SignMessage(Message{req})
+	if err != nil {
+		return err
+	}
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+// Verify verifies the signature of the request against the verifier policy,
+// see httpsignatures.Verifier.VerifyMessageBody. With CheckDigest the body
+// is checked against the covered digest header.
+func Verify(v *httpsignatures.Verifier, req *fasthttp.Request) (*httpsignatures.VerifyResult, error) {
+	return v.VerifyMessageBody(Message{req}, req.Body())
+}
+
+// resultKey is the user value of the request carrying the verified
+// signature
+const resultKey = "httpsignatures.result"
+
+// RequireSignature returns a handler which verifies the signature of every
+// request before passing it to next, like httpsignatures.Verifier.Middleware.
+// The verified signature is described in the user values of the request,
+// see FromContext.
+func RequireSignature(v *httpsignatures.Verifier, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		result, err := Verify(v, &ctx.Request)
+		if err != nil {
+			ctx.Error(err.Error(), httpsignatures.ErrorHTTPStatus(err))
+			return
+		}
+		ctx.SetUserValue(resultKey, result)
+		next(ctx)
+	}
+}
+
+// FromContext returns the signature verified by RequireSignature, eg to
+// authorize the keyId
+func FromContext(ctx *fasthttp.RequestCtx) (*httpsignatures.VerifyResult, bool) {
+	result, ok := ctx.UserValue(resultKey).(*httpsignatures.VerifyResult)
+	return result, ok
+}
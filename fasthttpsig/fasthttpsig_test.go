@@ -0,0 +1,105 @@
+package fasthttpsig
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyID = "Test"
+	testKey   = "U29tZXRoaW5nUmFuZG9t"
+	testBody  = `{"hello": "world"}`
+)
+
+func keyLookUp(keyID string) (string, error) {
+	return testKey, nil
+}
+
+func testRequest() *fasthttp.Request {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://example.com/foo?param=value")
+	req.Header.SetMethod(http.MethodPost)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.SetBodyString(testBody)
+	return req
+}
+
+func TestSignVerify(t *testing.T) {
+	req := testRequest()
+	signer := httpsignatures.NewKeySigner(testKeyID, httpsignatures.AlgorithmHmacSha256, testKey, "(request-target)", "host", "date")
+	assert.Nil(t, Sign(signer, req))
+
+	v := httpsignatures.NewVerifier(keyLookUp, 300, "(request-target)", "host")
+	result, err := Verify(v, req)
+	assert.Nil(t, err)
+	assert.Equal(t, testKeyID, result.KeyID)
+
+	// the same signature verifies on a net/http request
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/foo?param=value", nil)
+	r.Header.Set("Date", string(req.Header.Peek("Date")))
+	r.Header.Set("Signature", string(req.Header.Peek("Signature")))
+	_, err = v.Verify(r)
+	assert.Nil(t, err)
+
+	req.SetRequestURI("http://example.com/bar?param=value")
+	_, err = Verify(v, req)
+	assert.ErrorIs(t, err, httpsignatures.ErrSignatureMismatch)
+}
+
+func TestSignVerifyRFC9421(t *testing.T) {
+	req := testRequest()
+	req.SetRequestURI("https://example.com/foo?param=value")
+	signer := httpsignatures.NewKeySigner(testKeyID, httpsignatures.AlgorithmHmacSha256, testKey, "@method", "@target-uri", "date")
+	signer.Format = httpsignatures.FormatRFC9421
+	assert.Nil(t, Sign(signer, req))
+	assert.NotEmpty(t, req.Header.Peek("Signature-Input"))
+
+	_, err := Verify(httpsignatures.NewVerifier(keyLookUp, 300), req)
+	assert.Nil(t, err)
+}
+
+func TestVerifyDigest(t *testing.T) {
+	req := testRequest()
+	sum := sha256.Sum256([]byte(testBody))
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+	signer := httpsignatures.NewKeySigner(testKeyID, httpsignatures.AlgorithmHmacSha256, testKey, "(request-target)", "date", "content-digest")
+	assert.Nil(t, Sign(signer, req))
+
+	v := httpsignatures.NewVerifier(keyLookUp, 300)
+	v.CheckDigest = true
+	result, err := Verify(v, req)
+	assert.Nil(t, err)
+	assert.True(t, result.DigestVerified)
+
+	req.SetBodyString(testBody + "tampered")
+	_, err = Verify(v, req)
+	assert.ErrorIs(t, err, httpsignatures.ErrDigestMismatch)
+}
+
+func TestRequireSignature(t *testing.T) {
+	var keyID string
+	handler := RequireSignature(httpsignatures.NewVerifier(keyLookUp, 300), func(ctx *fasthttp.RequestCtx) {
+		result, ok := FromContext(ctx)
+		assert.True(t, ok)
+		keyID = result.KeyID
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	testRequest().CopyTo(&ctx.Request)
+	handler(ctx)
+	assert.Equal(t, http.StatusUnauthorized, ctx.Response.StatusCode())
+	assert.Empty(t, keyID)
+
+	ctx = &fasthttp.RequestCtx{}
+	testRequest().CopyTo(&ctx.Request)
+	assert.Nil(t, Sign(httpsignatures.NewKeySigner(testKeyID, httpsignatures.AlgorithmHmacSha256, testKey), &ctx.Request))
+	handler(ctx)
+	assert.Equal(t, testKeyID, keyID)
+}
@@ -0,0 +1,141 @@
+package keyfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+// ActorFetcher resolves keyIds which are the URL of a public key in an
+// ActivityPub actor document, eg "https://example.com/users/alice#main-key".
+// It is a KeySet binding every key to the algorithms of its key type. The
+// keyId is chosen by the client, so keyIds on private addresses, like
+// loopback and link-local ones, are refused unless AllowPrivateAddresses is
+// set.
+type ActorFetcher struct {
+	// Client fetches the actor documents. When nil, a client is used which
+	// refuses to connect to private addresses, redirects and DNS names
+	// resolving to them included. Another client must restrict the
+	// addresses itself, only keyIds with a private IP address are refused
+	// for it.
+	Client *http.Client
+	// AllowPrivateAddresses allows keyIds on private addresses
+	AllowPrivateAddresses bool
+	// TTL is how long fetched keys are cached, DefaultTTL when 0
+	TTL time.Duration
+	// MinRefresh is how long an actor document isn't fetched again for an
+	// unknown key, DefaultMinRefresh when 0
+	MinRefresh time.Duration
+	// MaxEntries is how many actor documents are cached,
+	// DefaultMaxEntries when 0
+	MaxEntries int
+	// Clock returns the current time, time.Now when nil
+	Clock func() time.Time
+
+	cache cache
+}
+
+// NewActorFetcher creates a fetcher caching the keys for ttl
+func NewActorFetcher(ttl time.Duration) *ActorFetcher {
+	return &ActorFetcher{TTL: ttl}
+}
+
+type actorPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type actorDocument struct {
+	ID string `json:"id"`
+	// PublicKey is a single key or a list of keys
+	PublicKey json.RawMessage `json:"publicKey"`
+}
+
+var errorNotAnActorURL = errors.New("keyId is not an http(s) URL")
+
+// KeyLookup returns the PEM encoded public key with id keyID from the actor
+// document keyID points to. An unknown key is reported with a nil key. The
+// key is not bound to its algorithm, use the fetcher as the KeyStore of a
+// verifier instead.
+func (f *ActorFetcher) KeyLookup(keyID string) ([]byte, error) {
+	key, _, err := firstKey(f.LookUpKeysContext(context.Background(), keyID))
+	return key, err
+}
+
+// LookUpKey returns the PEM encoded public key with id keyID and its
+// algorithm, the first one for keys of several algorithms
+func (f *ActorFetcher) LookUpKey(keyID string) ([]byte, string, error) {
+	return firstKey(f.LookUpKeysContext(context.Background(), keyID))
+}
+
+// LookUpKeys returns the PEM encoded public key with id keyID once for
+// every algorithm it is bound to
+func (f *ActorFetcher) LookUpKeys(keyID string) ([]httpsignatures.StoredKey, error) {
+	return f.LookUpKeysContext(context.Background(), keyID)
+}
+
+// LookUpKeysContext is LookUpKeys using ctx for the request
+func (f *ActorFetcher) LookUpKeysContext(ctx context.Context, keyID string) ([]httpsignatures.StoredKey, error) {
+	u, err := url.Parse(keyID)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errorNotAnActorURL
+	}
+	if !f.AllowPrivateAddresses && isPrivateHost(u.Hostname()) {
+		return nil, errorPrivateAddress
+	}
+	u.Fragment = ""
+	documentURL := u.String()
+
+	client := f.Client
+	if client == nil && !f.AllowPrivateAddresses {
+		client = publicClient
+	}
+	return f.cache.lookUp(documentURL, keyID, policy(f.Clock, f.TTL, f.MinRefresh, f.MaxEntries), func() (keySet, error) {
+		document, err := fetch(ctx, client, documentURL, `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+		if err != nil {
+			return nil, err
+		}
+		return parseActorKeys(document)
+	})
+}
+
+// parseActorKeys returns the PEM encoded keys of the actor by key id. Keys
+// owned by another actor, and keys which don't parse, are ignored.
+func parseActorKeys(document []byte) (keySet, error) {
+	var actor actorDocument
+	if err := json.Unmarshal(document, &actor); err != nil {
+		return nil, err
+	}
+
+	var publicKeys []actorPublicKey
+	if len(actor.PublicKey) > 0 && actor.PublicKey[0] == '[' {
+		if err := json.Unmarshal(actor.PublicKey, &publicKeys); err != nil {
+			return nil, err
+		}
+	} else if len(actor.PublicKey) > 0 {
+		var publicKey actorPublicKey
+		if err := json.Unmarshal(actor.PublicKey, &publicKey); err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	keys := keySet{}
+	for _, publicKey := range publicKeys {
+		if publicKey.Owner != "" && actor.ID != "" && publicKey.Owner != actor.ID {
+			continue
+		}
+		parsed, err := httpsignatures.LoadPublicKeyPEM([]byte(publicKey.PublicKeyPem))
+		if err != nil {
+			continue
+		}
+		keys.add(publicKey.ID, []byte(publicKey.PublicKeyPem), parsed, "")
+	}
+	return keys, nil
+}
@@ -0,0 +1,207 @@
+package keyfetch
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func actorServer(t *testing.T, publicKeyPem string) (*httptest.Server, *int) {
+	fetches := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		assert.Contains(t, r.Header.Get("Accept"), "application/activity+json")
+		if r.URL.Path != "/users/alice" {
+			http.NotFound(w, r)
+			return
+		}
+		actor := server.URL + "/users/alice"
+		fmt.Fprintf(w, `{"id":%q,"type":"Person","publicKey":{"id":%q,"owner":%q,"publicKeyPem":%q}}`,
+			actor, actor+"#main-key", actor, publicKeyPem)
+	}))
+	return server, &fetches
+}
+
+func ed25519Pem(t *testing.T) (string, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), privateKey
+}
+
+func TestActorFetcher(t *testing.T) {
+	if _, ok := httpsignatures.LookupAlgorithm(httpsignatures.AlgorithmRsaSha256); !ok {
+		t.Skip("rsa-sha256 is not in httpsig_minimal builds")
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+	publicKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	server, fetches := actorServer(t, publicKeyPem)
+	defer server.Close()
+	keyID := server.URL + "/users/alice#main-key"
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/inbox", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	err = httpsignatures.NewSigner(httpsignatures.AlgorithmRsaSha256, "(request-target)", "date").
+		SignRequestKey(r, keyID, x509.MarshalPKCS1PrivateKey(privateKey))
+	assert.Nil(t, err)
+
+	f := NewActorFetcher(time.Minute)
+	f.AllowPrivateAddresses = true
+	v := httpsignatures.NewVerifier(nil, 300)
+	v.KeyStore = f
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// cached
+	key, algorithm, err := f.LookUpKey(keyID)
+	assert.Nil(t, err)
+	assert.Equal(t, publicKeyPem, string(key))
+	assert.Equal(t, httpsignatures.AlgorithmRsaSha256, algorithm)
+	assert.Equal(t, 1, *fetches)
+
+	// the public key can't be used as HMAC secret
+	r.Header.Del("Signature")
+	err = httpsignatures.NewSigner(httpsignatures.AlgorithmHmacSha256, "(request-target)", "date").
+		SignRequestKey(r, keyID, []byte(publicKeyPem))
+	assert.Nil(t, err)
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, httpsignatures.ErrAlgorithmKeyMismatch, err)
+}
+
+func TestActorFetcherTTL(t *testing.T) {
+	publicKeyPem, _ := ed25519Pem(t)
+	server, fetches := actorServer(t, publicKeyPem)
+	defer server.Close()
+	keyID := server.URL + "/users/alice#main-key"
+
+	now := time.Unix(1402170695, 0)
+	f := NewActorFetcher(time.Minute)
+	f.AllowPrivateAddresses = true
+	f.MinRefresh = 10 * time.Second
+	f.Clock = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		key, err := f.KeyLookup(keyID)
+		assert.Nil(t, err)
+		assert.Equal(t, publicKeyPem, string(key))
+	}
+	assert.Equal(t, 1, *fetches)
+
+	// an unknown key of the actor is fetched again after MinRefresh
+	key, err := f.KeyLookup(server.URL + "/users/alice#other-key")
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Equal(t, 1, *fetches)
+	now = now.Add(10 * time.Second)
+	_, err = f.KeyLookup(server.URL + "/users/alice#other-key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *fetches)
+	_, err = f.KeyLookup(server.URL + "/users/alice#other-key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *fetches)
+
+	now = now.Add(time.Minute)
+	_, err = f.KeyLookup(keyID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *fetches)
+}
+
+func TestActorFetcherMaxEntries(t *testing.T) {
+	publicKeyPem, _ := ed25519Pem(t)
+	server, fetches := actorServer(t, publicKeyPem)
+	defer server.Close()
+
+	now := time.Unix(1402170695, 0)
+	f := NewActorFetcher(time.Minute)
+	f.AllowPrivateAddresses = true
+	f.MaxEntries = 2
+	f.Clock = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		_, err := f.KeyLookup(fmt.Sprintf("%s/users/alice?%d#main-key", server.URL, i))
+		assert.Nil(t, err)
+	}
+	assert.Len(t, f.cache.entries, 2)
+
+	// the oldest documents were dropped
+	_, err := f.KeyLookup(server.URL + "/users/alice?4#main-key")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, *fetches)
+	_, err = f.KeyLookup(server.URL + "/users/alice?0#main-key")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, *fetches)
+}
+
+func TestActorFetcherPrivateAddresses(t *testing.T) {
+	publicKeyPem, _ := ed25519Pem(t)
+	server, fetches := actorServer(t, publicKeyPem)
+	defer server.Close()
+
+	f := NewActorFetcher(0)
+	for _, keyID := range []string{
+		server.URL + "/users/alice#main-key",
+		"http://169.254.169.254/latest/meta-data#key",
+		"http://[::1]/users/alice#main-key",
+		"http://[::ffff:10.0.0.1]/users/alice#main-key",
+	} {
+		_, err := f.KeyLookup(keyID)
+		assert.Equal(t, errorPrivateAddress, err, keyID)
+	}
+
+	// a host name resolving to a private address
+	_, err := f.KeyLookup(strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/users/alice#main-key")
+	assert.True(t, errors.Is(err, errorPrivateAddress), err)
+	assert.Equal(t, 0, *fetches)
+
+	assert.False(t, isPrivateHost("93.184.216.34"))
+	assert.False(t, isPrivateHost("example.com"))
+}
+
+func TestActorFetcherErrors(t *testing.T) {
+	server, _ := actorServer(t, "key")
+	defer server.Close()
+
+	f := NewActorFetcher(0)
+	f.AllowPrivateAddresses = true
+	_, err := f.KeyLookup("Test")
+	assert.Equal(t, errorNotAnActorURL, err)
+
+	_, err = f.KeyLookup(server.URL + "/users/bob#main-key")
+	assert.EqualError(t, err, "fetching "+server.URL+"/users/bob: 404 Not Found")
+
+	// a key which doesn't parse is left out
+	key, err := f.KeyLookup(server.URL + "/users/alice#main-key")
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+}
+
+func TestParseActorKeysOwner(t *testing.T) {
+	a, _ := ed25519Pem(t)
+	b, _ := ed25519Pem(t)
+	keys, err := parseActorKeys([]byte(fmt.Sprintf(`{"id":"https://example.com/alice","publicKey":[
+		{"id":"https://example.com/alice#a","owner":"https://example.com/alice","publicKeyPem":%q},
+		{"id":"https://example.com/bob#b","owner":"https://example.com/bob","publicKeyPem":%q}]}`, a, b)))
+	assert.Nil(t, err)
+	assert.Equal(t, keySet{"https://example.com/alice#a": {{Key: []byte(a), Algorithm: httpsignatures.AlgorithmEd25519}}}, keys)
+}
@@ -0,0 +1,61 @@
+package keyfetch
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var errorPrivateAddress = errors.New("keyId is on a private address")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicClient is the client of an ActorFetcher without one, it connects to
+// public addresses only. It uses no proxy, which would connect for it.
+var publicClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   refusePrivateAddress,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+// refusePrivateAddress fails for connections to a private address, it is
+// called with the resolved address of every connection
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if isPrivateAddress(addrPort.Addr()) {
+		return errorPrivateAddress
+	}
+	return nil
+}
+
+// isPrivateHost reports whether host is a private IP address, host names
+// are checked when connecting
+func isPrivateHost(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	return err == nil && isPrivateAddress(addr)
+}
+
+// isPrivateAddress reports whether addr is not a public unicast address:
+// loopback, private, link-local, carrier-grade NAT, unspecified or multicast
+func isPrivateAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
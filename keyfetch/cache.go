@@ -0,0 +1,164 @@
+// Package keyfetch resolves the keyId of a signature to its key over HTTP:
+// from the actor document a keyId URL points to, as used by ActivityPub, or
+// from a JWKS endpoint. The fetchers are httpsignatures.KeySets binding
+// every key to the algorithms of its key type, so a verifier refuses eg an
+// hmac-sha256 signature keyed with a fetched public key:
+//
+//	v := httpsignatures.NewVerifier(nil, 300)
+//	v.KeyStore = keyfetch.NewJWKSFetcher("https://example.com/.well-known/jwks.json", time.Hour)
+//
+// The fetched keys are cached for a configurable time.
+package keyfetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+// DefaultTTL is how long fetched keys are cached when no TTL is configured
+const DefaultTTL = time.Hour
+
+// DefaultMinRefresh is how long a document isn't fetched again for an
+// unknown key id when no MinRefresh is configured
+const DefaultMinRefresh = time.Minute
+
+// DefaultMaxEntries is how many documents are cached when no MaxEntries is
+// configured
+const DefaultMaxEntries = 1000
+
+// maxDocumentSize limits the size of the fetched documents
+const maxDocumentSize = 1 << 20
+
+// cache holds the key sets of fetched documents by URL
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// fetches are the running fetches by URL, concurrent look ups of a URL
+	// wait for its fetch
+	fetches map[string]*cacheFetch
+}
+
+type cacheFetch struct {
+	done chan struct{}
+	keys keySet
+	err  error
+}
+
+type cacheEntry struct {
+	keys    keySet
+	fetched time.Time
+}
+
+// cachePolicy configures how long and how many documents are cached
+type cachePolicy struct {
+	now        time.Time
+	ttl        time.Duration
+	minRefresh time.Duration
+	maxEntries int
+}
+
+// put caches the keys of url, with c.mu held. A full cache drops the
+// expired documents, and the oldest one when none expired.
+func (c *cache) put(url string, keys keySet, p cachePolicy) {
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	if _, ok := c.entries[url]; !ok && len(c.entries) >= p.maxEntries {
+		oldest := ""
+		for u, entry := range c.entries {
+			if p.now.Sub(entry.fetched) >= p.ttl {
+				delete(c.entries, u)
+			} else if oldest == "" || entry.fetched.Before(c.entries[oldest].fetched) {
+				oldest = u
+			}
+		}
+		if len(c.entries) >= p.maxEntries {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[url] = cacheEntry{keys: keys, fetched: p.now}
+}
+
+// lookUp returns the keys of keyID in the document at url. The document is
+// fetched and parsed when it isn't cached, when it expired, or when it lacks
+// keyID and was fetched at least minRefresh ago, eg after a key rotation.
+func (c *cache) lookUp(url string, keyID string, p cachePolicy, fetch func() (keySet, error)) ([]httpsignatures.StoredKey, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[url]
+	if ok && p.now.Sub(entry.fetched) < p.ttl {
+		if keys := entry.keys[keyID]; len(keys) > 0 || p.now.Sub(entry.fetched) < p.minRefresh {
+			c.mu.Unlock()
+			return keys, nil
+		}
+	}
+	if running, ok := c.fetches[url]; ok {
+		c.mu.Unlock()
+		<-running.done
+		return running.keys[keyID], running.err
+	}
+	if c.fetches == nil {
+		c.fetches = map[string]*cacheFetch{}
+	}
+	running := &cacheFetch{done: make(chan struct{})}
+	c.fetches[url] = running
+	c.mu.Unlock()
+
+	running.keys, running.err = fetch()
+
+	c.mu.Lock()
+	delete(c.fetches, url)
+	if running.err == nil {
+		c.put(url, running.keys, p)
+	}
+	c.mu.Unlock()
+	close(running.done)
+	return running.keys[keyID], running.err
+}
+
+// fetch gets the document at url with the accept header
+func fetch(ctx context.Context, client *http.Client, url string, accept string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", accept)
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
+
+// policy returns the cache policy of the configured values, the defaults
+// for those which are 0
+func policy(clock func() time.Time, ttl time.Duration, minRefresh time.Duration, maxEntries int) cachePolicy {
+	p := cachePolicy{now: time.Now(), ttl: DefaultTTL, minRefresh: DefaultMinRefresh, maxEntries: DefaultMaxEntries}
+	if clock != nil {
+		p.now = clock()
+	}
+	if ttl > 0 {
+		p.ttl = ttl
+	}
+	if minRefresh > 0 {
+		p.minRefresh = minRefresh
+	}
+	if maxEntries > 0 {
+		p.maxEntries = maxEntries
+	}
+	return p
+}
@@ -0,0 +1,175 @@
+package keyfetch
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+// JWKSFetcher resolves keyIds which are the kid of a key in the JSON Web Key
+// Set at URL. It is a KeySet binding every key to the algorithm of its alg
+// member, or to the algorithms of its key type when it has none. Keys with
+// a use other than "sig" are left out.
+type JWKSFetcher struct {
+	// URL of the JWKS
+	URL string
+	// Client fetches the JWKS, http.DefaultClient when nil
+	Client *http.Client
+	// TTL is how long the fetched keys are cached, DefaultTTL when 0
+	TTL time.Duration
+	// MinRefresh is how long the JWKS isn't fetched again for an unknown
+	// kid, DefaultMinRefresh when 0
+	MinRefresh time.Duration
+	// Clock returns the current time, time.Now when nil
+	Clock func() time.Time
+
+	cache cache
+}
+
+// NewJWKSFetcher creates a fetcher for the JWKS at url, caching the keys
+// for ttl
+func NewJWKSFetcher(url string, ttl time.Duration) *JWKSFetcher {
+	return &JWKSFetcher{URL: url, TTL: ttl}
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var errorUnsupportedJWK = errors.New("Unsupported JWK")
+
+// KeyLookup returns the key with kid keyID in the format the algorithms
+// expect, see httpsignatures.KeyBytes. An unknown key is reported with a
+// nil key. The key is not bound to its algorithm, use the fetcher as the
+// KeyStore of a verifier instead.
+func (f *JWKSFetcher) KeyLookup(keyID string) ([]byte, error) {
+	key, _, err := firstKey(f.LookUpKeysContext(context.Background(), keyID))
+	return key, err
+}
+
+// LookUpKey returns the key with kid keyID and its algorithm, the first
+// one for keys of several algorithms
+func (f *JWKSFetcher) LookUpKey(keyID string) ([]byte, string, error) {
+	return firstKey(f.LookUpKeysContext(context.Background(), keyID))
+}
+
+// LookUpKeys returns the key with kid keyID once for every algorithm it is
+// bound to
+func (f *JWKSFetcher) LookUpKeys(keyID string) ([]httpsignatures.StoredKey, error) {
+	return f.LookUpKeysContext(context.Background(), keyID)
+}
+
+// LookUpKeysContext is LookUpKeys using ctx for the request
+func (f *JWKSFetcher) LookUpKeysContext(ctx context.Context, keyID string) ([]httpsignatures.StoredKey, error) {
+	return f.cache.lookUp(f.URL, keyID, policy(f.Clock, f.TTL, f.MinRefresh, 1), func() (keySet, error) {
+		document, err := fetch(ctx, f.Client, f.URL, "application/jwk-set+json, application/json")
+		if err != nil {
+			return nil, err
+		}
+		return parseJWKS(document)
+	})
+}
+
+// parseJWKS returns the supported signing keys of the set by kid
+func parseJWKS(document []byte) (keySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(document, &set); err != nil {
+		return nil, err
+	}
+
+	keys := keySet{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.publicKey()
+		if err != nil {
+			// eg a key type for another purpose
+			continue
+		}
+		key, err := httpsignatures.KeyBytes(publicKey)
+		if err != nil {
+			continue
+		}
+		keys.add(k.Kid, key, publicKey, k.Alg)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errorUnsupportedJWK
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errorUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errorUnsupportedJWK
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errorUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errorUnsupportedJWK
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errorUnsupportedJWK
+}
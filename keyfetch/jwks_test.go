@@ -0,0 +1,147 @@
+package keyfetch
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWKSFetcher(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":"secret","k":"c2VjcmV0"},{"kty":"OKP","crv":"Ed25519","kid":"ed","x":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(publicKey))
+	}))
+	defer server.Close()
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	err = httpsignatures.NewSigner(httpsignatures.AlgorithmEd25519, "(request-target)", "date").
+		SignRequestKey(r, "ed", privateKey)
+	assert.Nil(t, err)
+
+	f := NewJWKSFetcher(server.URL, time.Minute)
+	v := httpsignatures.NewVerifier(nil, 300)
+	v.KeyStore = f
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the raw public key can't be used as HMAC secret
+	r.Header.Del("Signature")
+	err = httpsignatures.NewSigner(httpsignatures.AlgorithmHmacSha256, "(request-target)", "date").
+		SignRequestKey(r, "ed", publicKey)
+	assert.Nil(t, err)
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, httpsignatures.ErrAlgorithmKeyMismatch, err)
+
+	// symmetric keys are not served
+	key, err := f.KeyLookup("secret")
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Equal(t, 1, fetches)
+}
+
+func TestJWKSFetcherRefetchUnknownKid(t *testing.T) {
+	first, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	second, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	fetches := 0
+	kids := []string{"first"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		keys := []string{}
+		for i, kid := range kids {
+			keys = append(keys, fmt.Sprintf(`{"kty":"OKP","crv":"Ed25519","kid":%q,"x":%q}`,
+				kid, base64.RawURLEncoding.EncodeToString([][]byte{first, second}[i])))
+		}
+		fmt.Fprintf(w, `{"keys":[%s]}`, strings.Join(keys, ","))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1402170695, 0)
+	f := NewJWKSFetcher(server.URL, time.Hour)
+	f.Clock = func() time.Time { return now }
+
+	key, algorithm, err := f.LookUpKey("first")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(first), key)
+	assert.Equal(t, httpsignatures.AlgorithmEd25519, algorithm)
+
+	// the rotated key is fetched once MinRefresh passed, not for every
+	// request with an unknown kid
+	kids = append(kids, "second")
+	key, _, err = f.LookUpKey("second")
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	now = now.Add(DefaultMinRefresh)
+	key, _, err = f.LookUpKey("second")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(second), key)
+	for i := 0; i < 3; i++ {
+		key, _, err = f.LookUpKey("unknown")
+		assert.Nil(t, err)
+		assert.Nil(t, key)
+	}
+	assert.Equal(t, 2, fetches)
+}
+
+func TestParseJWKSAlgorithms(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	x := base64.RawURLEncoding.EncodeToString(publicKey)
+
+	keys, err := parseJWKS([]byte(fmt.Sprintf(`{"keys":[
+		{"kty":"OKP","crv":"Ed25519","kid":"ed","alg":"EdDSA","use":"sig","x":%q},
+		{"kty":"OKP","crv":"Ed25519","kid":"enc","use":"enc","x":%q},
+		{"kty":"OKP","crv":"Ed25519","kid":"hmac","alg":"HS256","x":%q}]}`, x, x, x)))
+	assert.Nil(t, err)
+	assert.Equal(t, keySet{"ed": {{Key: []byte(publicKey), Algorithm: httpsignatures.AlgorithmEd25519}}}, keys)
+}
+
+func TestJWKSFetcherEC(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	x := base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32)))
+	y := base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32)))
+
+	keys, err := parseJWKS([]byte(fmt.Sprintf(`{"keys":[
+		{"kty":"EC","crv":"P-256","kid":"ec","x":%q,"y":%q},
+		{"kty":"EC","crv":"P-256","kid":"off-curve","x":%q,"y":%q}]}`, x, y, x, x)))
+	assert.Nil(t, err)
+
+	expected, err := httpsignatures.KeyBytes(&privateKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, keySet{"ec": {
+		{Key: expected, Algorithm: httpsignatures.AlgorithmEcdsaSha256},
+		{Key: expected, Algorithm: httpsignatures.AlgorithmEcdsaSha512},
+	}}, keys)
+}
+
+func TestJWKSFetcherError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewJWKSFetcher(server.URL, 0).KeyLookup("ed")
+	assert.EqualError(t, err, "fetching "+server.URL+": 503 Service Unavailable")
+}
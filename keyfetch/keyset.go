@@ -0,0 +1,65 @@
+package keyfetch
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+
+	"github.com/mvaneijk/httpsignatures-go"
+)
+
+// keySet holds the keys of a fetched document by key id, each key once per
+// algorithm it may be used with
+type keySet map[string][]httpsignatures.StoredKey
+
+// jwsAlgorithms maps the JWS algorithm names of the JWK alg member to the
+// algorithms of the package
+var jwsAlgorithms = map[string]string{
+	"RS256": httpsignatures.AlgorithmRsaSha256,
+	"PS256": httpsignatures.AlgorithmRsaPssSha256,
+	"PS512": httpsignatures.AlgorithmRsaPssSha512,
+	"ES256": httpsignatures.AlgorithmEcdsaSha256,
+	"ES512": httpsignatures.AlgorithmEcdsaSha512,
+	"EdDSA": httpsignatures.AlgorithmEd25519,
+}
+
+// keyAlgorithms returns the algorithms a public key may be used with: the
+// algorithm of jwsAlgorithm when given, otherwise every algorithm of its
+// key type. Symmetric keys and algorithms of another key type have none.
+func keyAlgorithms(publicKey crypto.PublicKey, jwsAlgorithm string) []string {
+	var algorithms []string
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		algorithms = []string{httpsignatures.AlgorithmRsaSha256, httpsignatures.AlgorithmRsaPssSha256, httpsignatures.AlgorithmRsaPssSha512}
+	case *ecdsa.PublicKey:
+		algorithms = []string{httpsignatures.AlgorithmEcdsaSha256, httpsignatures.AlgorithmEcdsaSha512}
+	case ed25519.PublicKey:
+		algorithms = []string{httpsignatures.AlgorithmEd25519}
+	}
+	if jwsAlgorithm == "" {
+		return algorithms
+	}
+	for _, algorithm := range algorithms {
+		if algorithm == jwsAlgorithms[jwsAlgorithm] {
+			return []string{algorithm}
+		}
+	}
+	return nil
+}
+
+// add binds key to the algorithms of publicKey under keyID
+func (s keySet) add(keyID string, key []byte, publicKey crypto.PublicKey, jwsAlgorithm string) {
+	for _, algorithm := range keyAlgorithms(publicKey, jwsAlgorithm) {
+		s[keyID] = append(s[keyID], httpsignatures.StoredKey{Key: key, Algorithm: algorithm})
+	}
+}
+
+// firstKey returns the key and algorithm of the first of keys, which are
+// the same key bound to each of its algorithms
+func firstKey(keys []httpsignatures.StoredKey, err error) ([]byte, string, error) {
+	if err != nil || len(keys) == 0 {
+		return nil, "", err
+	}
+	return keys[0].Key, keys[0].Algorithm, nil
+}
@@ -0,0 +1,193 @@
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+)
+
+// KeyBytes returns the raw key expected by the algorithms for a parsed key:
+// the secret itself for a []byte HMAC secret, the raw key for Ed25519 keys,
+// the DER encoded PKCS #1 or SEC 1 private key for RSA and EC private keys,
+// and the DER encoded PKIX public key for RSA and EC public keys.
+func KeyBytes(key interface{}) ([]byte, error) {
+	switch k := key.(type) {
+	case []byte:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	case ed25519.PublicKey:
+		return k, nil
+	case *rsa.PrivateKey:
+		return x509.MarshalPKCS1PrivateKey(k), nil
+	case *ecdsa.PrivateKey:
+		return x509.MarshalECPrivateKey(k)
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return x509.MarshalPKIXPublicKey(k)
+	}
+	return nil, ErrUnsupportedKeyType
+}
+
+// LoadPrivateKeyPEM parses the first PEM block of data: a PKCS #1 RSA, SEC 1
+// EC or PKCS #8 private key. The key can be passed to KeyBytes, or signed
+// with directly with SignRequestPrivateKey.
+func LoadPrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	return LoadEncryptedPrivateKeyPEM(data, nil)
+}
+
+// LoadEncryptedPrivateKeyPEM parses the first PEM block of data like
+// LoadPrivateKeyPEM, decrypting it with passphrase: an encrypted PKCS #8
+// private key ("ENCRYPTED PRIVATE KEY") using PBES2 with PBKDF2 and
+// AES-CBC, or a legacy encrypted PEM block ("Proc-Type: 4,ENCRYPTED")
+func LoadEncryptedPrivateKeyPEM(data []byte, passphrase []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	encrypted := block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+	if encrypted && len(passphrase) == 0 {
+		return nil, ErrPEMPassphraseRequired
+	}
+
+	der := block.Bytes
+	var err error
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	// the standard library only decrypts the legacy PEM encryption, which
+	// it deprecates for its weak key derivation
+	if encrypted {
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, block.Type)
+}
+
+// LoadPublicKeyPEM parses the first PEM block of data: a PKIX or PKCS #1 RSA
+// public key, or the public key of a certificate
+func LoadPublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, block.Type)
+}
+
+// parseEncodedPublicKey parses a PEM or DER encoded PKIX or PKCS #1 public
+// key or certificate
+func parseEncodedPublicKey(key []byte) (crypto.PublicKey, error) {
+	if block, _ := pem.Decode(key); block != nil {
+		return LoadPublicKeyPEM(key)
+	}
+	if publicKey, err := x509.ParsePKIXPublicKey(key); err == nil {
+		return publicKey, nil
+	}
+	if publicKey, err := x509.ParsePKCS1PublicKey(key); err == nil {
+		return publicKey, nil
+	}
+	cert, err := x509.ParseCertificate(key)
+	if err != nil {
+		return nil, ErrUnsupportedKeyType
+	}
+	return cert.PublicKey, nil
+}
+
+// SignRequestPrivateKey adds a http signature using a parsed private key to
+// the Signature: HTTP Header, eg one loaded with LoadPrivateKeyPEM
+func (s Signer) SignRequestPrivateKey(r *http.Request, keyID string, key crypto.PrivateKey) error {
+	raw, err := KeyBytes(key)
+	if err != nil {
+		return err
+	}
+	return s.SignRequestKey(r, keyID, raw)
+}
+
+// VerifyPublicKey verifies this signature for a parsed public key, eg one
+// loaded with LoadPublicKeyPEM. The signature must claim an algorithm of
+// the type of the key, others, like HMAC, fail with
+// ErrAlgorithmKeyMismatch. An hs2019 signature uses the algorithm
+// draft-cavage recommends for the type of the key.
+func (s SignatureParameters) VerifyPublicKey(key crypto.PublicKey) (bool, error) {
+	algorithms := keyTypeAlgorithms(key)
+	if len(algorithms) == 0 {
+		return false, ErrUnsupportedKeyType
+	}
+	var err error
+	if s.Algorithm == algorithmHs2019 {
+		if s.Algorithm, err = algorithmFromString(algorithms[0]); err != nil {
+			return false, err
+		}
+	} else if s.Algorithm == nil || !keyTypeHasAlgorithm(algorithms, s.Algorithm.Name) {
+		return false, ErrAlgorithmKeyMismatch
+	}
+
+	raw, err := KeyBytes(key)
+	if err != nil {
+		return false, err
+	}
+	return s.VerifyKey(raw)
+}
+
+// keyTypeAlgorithms returns the algorithms of the type of a public key, the
+// first one is the algorithm draft-cavage recommends for hs2019
+func keyTypeAlgorithms(publicKey crypto.PublicKey) []string {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return []string{AlgorithmRsaPssSha512, AlgorithmRsaSha256, AlgorithmRsaPssSha256}
+	case *ecdsa.PublicKey:
+		return []string{AlgorithmEcdsaSha512, AlgorithmEcdsaSha256}
+	case ed25519.PublicKey:
+		return []string{AlgorithmEd25519}
+	}
+	return nil
+}
+
+func keyTypeHasAlgorithm(algorithms []string, name string) bool {
+	for _, algorithm := range algorithms {
+		if algorithm == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pemBytes returns the contents of the first PEM block in key, or key itself
+// when it is not PEM encoded
+func pemBytes(key []byte) []byte {
+	if block, _ := pem.Decode(key); block != nil {
+		return block.Bytes
+	}
+	return key
+}
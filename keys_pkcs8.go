@@ -0,0 +1,142 @@
+package httpsignatures
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// The PKCS #5 v2 (RFC 8018) schemes of encrypted PKCS #8 private keys:
+// PBES2 with the PBKDF2 key derivation and AES-CBC encryption, as written by
+// eg "openssl pkcs8 -topk8"
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	pbkdf2Hashes = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+	aesKeySizes = map[string]int{
+		"2.16.840.1.101.3.4.1.2":  16,
+		"2.16.840.1.101.3.4.1.22": 24,
+		"2.16.840.1.101.3.4.1.42": 32,
+	}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Parameters struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Parameters struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the DER encoded EncryptedPrivateKeyInfo of an
+// "ENCRYPTED PRIVATE KEY" PEM block to the DER encoded PKCS #8 private key.
+// A wrong passphrase fails with x509.IncorrectPasswordError, like legacy
+// encrypted PEM blocks.
+func decryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, info.Algorithm.Algorithm)
+	}
+	var params pbes2Parameters
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Parameters
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		if prf = pbkdf2Hashes[kdf.PRF.Algorithm.String()]; prf == nil {
+			return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, kdf.PRF.Algorithm)
+		}
+	}
+	keySize, ok := aesKeySizes[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidPEMKey, params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 || kdf.IterationCount < 1 {
+		return nil, ErrInvalidPEMKey
+	}
+
+	block, err := aes.NewCipher(pbkdf2(passphrase, kdf.Salt, kdf.IterationCount, keySize, prf))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// a wrong passphrase shows as invalid PKCS #7 padding
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// pbkdf2 derives a key of keySize bytes from the passphrase, RFC 8018
+// section 5.2
+func pbkdf2(passphrase []byte, salt []byte, iterations int, keySize int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, passphrase)
+	size := prf.Size()
+	var index [4]byte
+	key := make([]byte, 0, keySize+size)
+	u := make([]byte, 0, size)
+	for i := 1; len(key) < keySize; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(index[:], uint32(i))
+		prf.Write(index[:])
+		key = prf.Sum(key)
+		t := key[len(key)-size:]
+		u = append(u[:0], t...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return key[:keySize]
+}
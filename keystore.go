@@ -0,0 +1,189 @@
+package httpsignatures
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyStore binds every keyId to its key and the algorithm the key must be
+// used with. A verifier with a key store refuses signatures claiming another
+// algorithm, eg hmac-sha256 against an RSA public key. See KeySet for
+// several keys per keyId.
+type KeyStore interface {
+	// LookUpKey returns the raw key and the algorithm of keyID. It reports
+	// an unknown keyID with an empty key or an error wrapping
+	// ErrUnknownKeyID.
+	LookUpKey(keyID string) (key []byte, algorithm string, err error)
+}
+
+// KeySet is a KeyStore which holds several keys per keyId, eg the old and
+// the new key while a key is rotated. A verifier with a key set tries every
+// key which is valid and bound to the algorithm of the signature, a signer
+// signs with the newest valid key, see Signer.Keys.
+type KeySet interface {
+	KeyStore
+	// LookUpKeys returns every key of keyID, none for an unknown keyID
+	LookUpKeys(keyID string) ([]StoredKey, error)
+}
+
+// StoredKey is a raw key with the algorithm it must be used with, and the
+// period it is valid in
+type StoredKey struct {
+	Key       []byte
+	Algorithm string
+	// NotBefore and NotAfter limit the period the key is valid in, a zero
+	// time doesn't limit it
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ValidAt reports whether the key is valid at t
+func (k StoredKey) ValidAt(t time.Time) bool {
+	return (k.NotBefore.IsZero() || !t.Before(k.NotBefore)) && (k.NotAfter.IsZero() || t.Before(k.NotAfter))
+}
+
+// MemoryKeyStore is a KeySet holding the keys in memory
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string][]StoredKey
+	// Clock returns the current time, time.Now when nil
+	Clock func() time.Time
+}
+
+// NewMemoryKeyStore creates an empty key store
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string][]StoredKey{}}
+}
+
+// Add binds keyID to the raw key and algorithm, replacing the earlier keys
+// of keyID. The algorithm must be registered, hs2019 binds to no algorithm.
+func (s *MemoryKeyStore) Add(keyID string, algorithm string, key []byte) error {
+	if err := checkStoredAlgorithm(algorithm); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[keyID] = []StoredKey{{Key: key, Algorithm: algorithm}}
+	return nil
+}
+
+// AddKey adds a key to the keys of keyID, eg the new key of a rotation.
+// The newest key is the one valid from the latest NotBefore, or the one
+// added last.
+func (s *MemoryKeyStore) AddKey(keyID string, key StoredKey) error {
+	if err := checkStoredAlgorithm(key.Algorithm); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[keyID] = append(s.keys[keyID], key)
+	return nil
+}
+
+// Remove forgets the keys of keyID
+func (s *MemoryKeyStore) Remove(keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, keyID)
+}
+
+// LookUpKey returns the raw key and the algorithm of the newest key of
+// keyID which is valid now
+func (s *MemoryKeyStore) LookUpKey(keyID string) ([]byte, string, error) {
+	keys, _ := s.LookUpKeys(keyID)
+	key, ok := newestKey(keys, s.now())
+	if !ok {
+		return nil, "", nil
+	}
+	return key.Key, key.Algorithm, nil
+}
+
+// LookUpKeys returns every key of keyID
+func (s *MemoryKeyStore) LookUpKeys(keyID string) ([]StoredKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]StoredKey(nil), s.keys[keyID]...), nil
+}
+
+func (s *MemoryKeyStore) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// checkStoredAlgorithm fails for algorithms a key can't be bound to
+func checkStoredAlgorithm(algorithm string) error {
+	if algorithm == AlgorithmHs2019 {
+		return ErrUnknownAlgorithm
+	}
+	_, err := algorithmFromString(algorithm)
+	return err
+}
+
+// newestKey returns the key valid at now with the latest NotBefore, the
+// last one of those
+func newestKey(keys []StoredKey, now time.Time) (StoredKey, bool) {
+	var newest StoredKey
+	found := false
+	for _, key := range keys {
+		if key.ValidAt(now) && (!found || !key.NotBefore.Before(newest.NotBefore)) {
+			newest, found = key, true
+		}
+	}
+	return newest, found
+}
+
+// lookUpPinnedKey returns the key of the signature from the key store and
+// the algorithm it is bound to, and fails when the signature claims another
+// algorithm than the key is bound to. An hs2019 signature uses the bound
+// algorithm.
+func (v Verifier) lookUpPinnedKey(sig SignatureParameters) ([]byte, string, error) {
+	key, algorithm, err := v.KeyStore.LookUpKey(sig.KeyID)
+	if err == nil && len(key) == 0 {
+		err = &UnknownKeyError{KeyID: sig.KeyID}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if sig.Algorithm == nil || (sig.Algorithm.Name != algorithm && sig.Algorithm != algorithmHs2019) {
+		return nil, "", ErrAlgorithmKeyMismatch
+	}
+	return key, algorithm, nil
+}
+
+// verifyKeySet verifies the signature with every key of its keyId which is
+// valid and bound to the algorithm of the signature, until one matches
+func (v Verifier) verifyKeySet(set KeySet, sig SignatureParameters) (bool, error) {
+	keys, err := set.LookUpKeys(sig.KeyID)
+	if err != nil {
+		return false, err
+	}
+	if len(keys) == 0 {
+		return false, &UnknownKeyError{KeyID: sig.KeyID}
+	}
+
+	now := v.now()
+	err = ErrKeyNotValid
+	for _, key := range keys {
+		if !key.ValidAt(now) {
+			continue
+		}
+		if sig.Algorithm == nil || (sig.Algorithm.Name != key.Algorithm && sig.Algorithm != algorithmHs2019) {
+			if err == ErrKeyNotValid {
+				err = ErrAlgorithmKeyMismatch
+			}
+			continue
+		}
+		ok, keyErr := v.verifyKey(sig, key.Key, key.Algorithm)
+		if ok && keyErr == nil {
+			return true, nil
+		}
+		if err = keyErr; err == nil {
+			err = ErrSignatureMismatch
+		}
+	}
+	return false, err
+}
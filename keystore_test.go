@@ -0,0 +1,141 @@
+package httpsignatures
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryKeyStore(t *testing.T) {
+	skipUnregistered(t, AlgorithmRsaPssSha256)
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+
+	store := NewMemoryKeyStore()
+	err = store.Add(testKeyID, AlgorithmRsaPssSha256, publicKey)
+	assert.Nil(t, err)
+	v := NewVerifier(nil, -1)
+	v.KeyStore = store
+	// the key store must catch the confusion by itself
+	v.RejectAlgorithmConfusion = false
+
+	sign := func(algorithm string, key []byte) *http.Request {
+		r := &http.Request{
+			Header: http.Header{
+				"Date": []string{testDate},
+			},
+		}
+		err := NewSigner(algorithm).SignRequestKey(r, testKeyID, key)
+		assert.Nil(t, err)
+		return r
+	}
+
+	res, err := v.VerifyRequest(sign(AlgorithmRsaPssSha256, x509.MarshalPKCS1PrivateKey(privateKey)))
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// downgrades to another algorithm are refused
+	for _, r := range []*http.Request{
+		sign(AlgorithmRsaSha256, x509.MarshalPKCS1PrivateKey(privateKey)),
+		sign(AlgorithmHmacSha256, publicKey),
+	} {
+		res, err = v.VerifyRequest(r)
+		assert.False(t, res)
+		assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+	}
+
+	store.Remove(testKeyID)
+	_, err = v.VerifyRequest(sign(AlgorithmRsaPssSha256, x509.MarshalPKCS1PrivateKey(privateKey)))
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
+
+func TestMemoryKeyStoreUnknownAlgorithm(t *testing.T) {
+	err := NewMemoryKeyStore().Add(testKeyID, "rot13", []byte(testKey))
+	assert.Equal(t, ErrUnknownAlgorithm, err)
+}
+
+func TestMemoryKeyStoreRotation(t *testing.T) {
+	now := time.Unix(1402170695, 0)
+	oldKey, newKey, nextKey := []byte("old secret"), []byte("new secret"), []byte("next secret")
+
+	store := NewMemoryKeyStore()
+	store.Clock = func() time.Time { return now }
+	assert.Nil(t, store.AddKey(testKeyID, StoredKey{Key: oldKey, Algorithm: AlgorithmHmacSha256, NotAfter: now.Add(time.Hour)}))
+	assert.Nil(t, store.AddKey(testKeyID, StoredKey{Key: newKey, Algorithm: AlgorithmHmacSha256, NotBefore: now.Add(-time.Minute)}))
+	assert.Nil(t, store.AddKey(testKeyID, StoredKey{Key: nextKey, Algorithm: AlgorithmHmacSha256, NotBefore: now.Add(time.Hour)}))
+
+	key, algorithm, err := store.LookUpKey(testKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, newKey, key)
+	assert.Equal(t, AlgorithmHmacSha256, algorithm)
+
+	sign := func(key []byte) *http.Request {
+		r := &http.Request{
+			Header: http.Header{
+				"Date": []string{testDate},
+			},
+		}
+		assert.Nil(t, NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, key))
+		return r
+	}
+
+	// the signer uses the newest valid key
+	signer := NewSignerWithOptions(testKeyID, nil, "", WithKeySet(store))
+	signer.Clock = store.Clock
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	assert.Nil(t, signer.Sign(r))
+	assert.Equal(t, sign(newKey).Header.Get("Signature"), r.Header.Get("Signature"))
+
+	// both keys of the rotation verify, the next one is not valid yet
+	v := NewVerifier(nil, -1)
+	v.KeyStore = store
+	v.Clock = store.Clock
+	for _, key := range [][]byte{oldKey, newKey} {
+		res, err := v.VerifyRequest(sign(key))
+		assert.True(t, res)
+		assert.Nil(t, err)
+	}
+	_, err = v.VerifyRequest(sign(nextKey))
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	// the old key expires
+	now = now.Add(time.Hour)
+	_, err = v.VerifyRequest(sign(oldKey))
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+	res, err := v.VerifyRequest(sign(nextKey))
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestMemoryKeyStoreExpiredKeys(t *testing.T) {
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.AddKey(testKeyID, StoredKey{Key: []byte("secret"), Algorithm: AlgorithmHmacSha256, NotAfter: time.Now().Add(-time.Minute)}))
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := NewSignerWithOptions(testKeyID, nil, "", WithKeySet(store)).Sign(r)
+	assert.Equal(t, ErrKeyNotValid, err)
+
+	assert.Nil(t, NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, []byte("secret")))
+	v := NewVerifier(nil, -1)
+	v.KeyStore = store
+	_, err = v.VerifyRequest(r)
+	assert.Equal(t, ErrKeyNotValid, err)
+	assert.Equal(t, http.StatusUnauthorized, ErrorHTTPStatus(err))
+
+	err = NewSignerWithOptions("unknown", nil, "", WithKeySet(store)).Sign(r)
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
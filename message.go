@@ -0,0 +1,218 @@
+package httpsignatures
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// Message is the part of a HTTP request a signature covers. The signature
+// strings are built from it, so proxies and servers which don't use
+// net/http can sign and verify their requests, see the fasthttpsig package
+// for fasthttp.
+type Message interface {
+	// Method returns the request method, eg "GET"
+	Method() string
+	// RequestURI returns the request target as sent, eg "/foo?bar=baz"
+	RequestURI() string
+	// Header returns every value of the header name, which is case
+	// insensitive, and of the Host header for "host"
+	Header(name string) []string
+}
+
+// SchemeMessage is a Message which knows the scheme of the request, eg
+// "https" when it was received over TLS. The "@scheme" and "@target-uri"
+// components of RFC 9421 of other messages use "http".
+type SchemeMessage interface {
+	Message
+	Scheme() string
+}
+
+// HeaderMessage is a Message built from a raw header map
+type HeaderMessage struct {
+	RequestMethod string
+	URI           string
+	// Headers by name, the names are case insensitive
+	Headers map[string][]string
+}
+
+// Method returns RequestMethod
+func (m HeaderMessage) Method() string {
+	return m.RequestMethod
+}
+
+// RequestURI returns URI
+func (m HeaderMessage) RequestURI() string {
+	return m.URI
+}
+
+// Header returns the values of the header name
+func (m HeaderMessage) Header(name string) []string {
+	if values, ok := m.Headers[name]; ok {
+		return values
+	}
+	for key, values := range m.Headers {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// RequestMessage adapts a net/http request to Message
+func RequestMessage(r *http.Request) Message {
+	return requestMessage{r}
+}
+
+type requestMessage struct {
+	r *http.Request
+}
+
+func (m requestMessage) Method() string {
+	return m.r.Method
+}
+
+// RequestURI returns the target of r.URL, which a handler may have
+// rewritten, eg to strip a prefix, like the URL the request is sent to
+func (m requestMessage) RequestURI() string {
+	if m.r.URL != nil {
+		return m.r.URL.RequestURI()
+	}
+	return m.r.RequestURI
+}
+
+func (m requestMessage) Header(name string) []string {
+	if strings.EqualFold(name, "host") {
+		if host := requestHost(m.r); host != "" {
+			return []string{host}
+		}
+		return nil
+	}
+	return m.r.Header[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+func (m requestMessage) Scheme() string {
+	if m.r.URL != nil && m.r.URL.Scheme != "" {
+		return m.r.URL.Scheme
+	}
+	if m.r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// messageURL parses the request target of the message
+func messageURL(m Message) (*url.URL, error) {
+	u, err := url.ParseRequestURI(m.RequestURI())
+	if err != nil {
+		return nil, ErrURLNotInRequest
+	}
+	return u, nil
+}
+
+// messageHost returns the first Host header of the message
+func messageHost(m Message) string {
+	if hosts := m.Header("host"); len(hosts) > 0 {
+		return strings.TrimSpace(hosts[0])
+	}
+	return ""
+}
+
+// messageScheme returns the scheme of a SchemeMessage, "http" otherwise
+func messageScheme(m Message) string {
+	if sm, ok := m.(SchemeMessage); ok {
+		if scheme := sm.Scheme(); scheme != "" {
+			return scheme
+		}
+	}
+	return "http"
+}
+
+// SignMessage signs the message with the key of the signer like Sign, and
+// returns the headers to add to it: the Signature or Authorization header,
+// or the Signature-Input and Signature headers for RFC 9421. The body is not
+// part of a message, so DigestAlgorithms are ignored: set the digest header
+// before signing instead. AddDate is ignored as well, and the Observer is
+// not notified.
+func (s Signer) SignMessage(m Message) (http.Header, error) {
+	sign, err := s.keySignFunc()
+	if err != nil {
+		return nil, err
+	}
+	sig := SignatureParameters{}
+	if err := sig.FromConfig(s.keyID, s.algorithm, s.headers); err != nil {
+		return nil, err
+	}
+	return s.signatureHeaders(m, sig, sign, s.UseAuthorization)
+}
+
+// VerifyMessage verifies the signature of the message against the verifier
+// policy like Verify. The body is not part of a message, so it fails with
+// ErrDigestWithoutBody when CheckDigest is set, see VerifyMessageBody.
+// Target and the Observer, which take a net/http request, are not used.
+func (v Verifier) VerifyMessage(m Message) (*VerifyResult, error) {
+	if v.CheckDigest {
+		return nil, ErrDigestWithoutBody
+	}
+	return v.verifyMessage(m, nil)
+}
+
+// VerifyMessageBody verifies the signature of the message like
+// VerifyMessage, and with CheckDigest checks body against the covered
+// digest header, see VerifyMessageDigest
+func (v Verifier) VerifyMessageBody(m Message, body []byte) (*VerifyResult, error) {
+	var checkDigest func(sig SignatureParameters) error
+	if v.CheckDigest {
+		checkDigest = func(sig SignatureParameters) error {
+			if !sig.Covers(HeaderDigest) && !sig.Covers(HeaderContentDigest) {
+				return nil
+			}
+			return VerifyMessageDigest(m, body)
+		}
+	}
+	return v.verifyMessage(m, checkDigest)
+}
+
+func (v Verifier) verifyMessage(m Message, checkDigest func(sig SignatureParameters) error) (*VerifyResult, error) {
+	sig := SignatureParameters{}
+	if err := sig.fromMessage(m, v.requestOptions()); err != nil {
+		return nil, err
+	}
+	ok, err := v.verifyChecked(nil, sig, v.checks(), checkDigest)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSignatureMismatch
+	}
+
+	result := newVerifyResult(sig)
+	result.DigestVerified = v.CheckDigest && (sig.Covers(HeaderDigest) || sig.Covers(HeaderContentDigest))
+	return result, nil
+}
+
+// VerifyMessageDigest checks body against the Digest and Content-Digest
+// headers of the message. Every digest with a supported algorithm must
+// match, like VerifyDigest.
+func VerifyMessageDigest(m Message, body []byte) error {
+	header := http.Header{}
+	for _, name := range []string{HeaderDigest, HeaderContentDigest} {
+		header[http.CanonicalHeaderKey(name)] = m.Header(name)
+	}
+	digests, err := parseDigestHeaders(header)
+	if err != nil {
+		return err
+	}
+	if len(digests) == 0 {
+		return ErrNoDigestHeader
+	}
+
+	var hashes []digestHash
+	for name, newHash := range digestAlgorithms {
+		h := digestHash{name, newHash()}
+		h.Write(body)
+		hashes = append(hashes, h)
+	}
+	return checkDigests(digests, hashes)
+}
@@ -0,0 +1,161 @@
+package httpsignatures
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testMessage() HeaderMessage {
+	return HeaderMessage{
+		RequestMethod: http.MethodPost,
+		URI:           "/foo?param=value",
+		Headers: map[string][]string{
+			"host":            {"example.com"},
+			"date":            {testDate},
+			"X-Forwarded-For": {"192.0.2.1", "198.51.100.7"},
+		},
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	m := testMessage()
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "host", "date", "x-forwarded-for")
+	added, err := signer.SignMessage(m)
+	assert.Nil(t, err)
+	assert.Len(t, added, 1)
+	assert.Contains(t, added.Get("Signature"), `headers="(request-target) host date x-forwarded-for"`)
+
+	// the message was not modified
+	assert.Nil(t, m.Header("signature"))
+	m.Headers["Signature"] = added["Signature"]
+
+	result, err := NewVerifier(keyLookUp, -1, "(request-target)", "host").VerifyMessage(m)
+	assert.Nil(t, err)
+	assert.Equal(t, testKeyID, result.KeyID)
+
+	// the same signature verifies on a net/http request
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo?param=value", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header["X-Forwarded-For"] = []string{"192.0.2.1", "198.51.100.7"}
+	r.Header["Signature"] = added["Signature"]
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(RequestMessage(r))
+	assert.Nil(t, err)
+
+	// tampered
+	m.URI = "/bar?param=value"
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(m)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestSignMessageRFC9421(t *testing.T) {
+	m := testMessage()
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "@method", "@authority", "@path", "date")
+	signer.Format = FormatRFC9421
+	added, err := signer.SignMessage(m)
+	assert.Nil(t, err)
+	assert.Len(t, added, 2)
+
+	m.Headers["Signature"] = added["Signature"]
+	m.Headers["Signature-Input"] = added["Signature-Input"]
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(m)
+	assert.Nil(t, err)
+}
+
+func TestVerifyMessageWithoutSignature(t *testing.T) {
+	_, err := NewVerifier(keyLookUp, -1).VerifyMessage(testMessage())
+	assert.Equal(t, ErrNoSignatureHeader, err)
+}
+
+func TestSignMessageMissingHeader(t *testing.T) {
+	_, err := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "digest").SignMessage(testMessage())
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'digest'")
+}
+
+func TestSignMessageKeySet(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.Add(testKeyID, AlgorithmHmacSha256, key))
+	signer := NewSignerWithOptions(testKeyID, nil, "", WithKeySet(store), WithHeaders("(request-target)", "date"))
+	signer.UseAuthorization = true
+	m := testMessage()
+	added, err := signer.SignMessage(m)
+	assert.Nil(t, err)
+	assert.Contains(t, added.Get("Authorization"), `Signature keyId="Test",algorithm="hmac-sha256"`)
+
+	m.Headers["Authorization"] = added["Authorization"]
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(m)
+	assert.Nil(t, err)
+}
+
+// schemeMessage is a message received over TLS
+type schemeMessage struct {
+	HeaderMessage
+}
+
+func (m schemeMessage) Scheme() string {
+	return "https"
+}
+
+func TestSignMessageScheme(t *testing.T) {
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "@target-uri")
+	signer.Format = FormatRFC9421
+	m := schemeMessage{testMessage()}
+	added, err := signer.SignMessage(m)
+	assert.Nil(t, err)
+	m.Headers["Signature"] = added["Signature"]
+	m.Headers["Signature-Input"] = added["Signature-Input"]
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(m)
+	assert.Nil(t, err)
+
+	// the same signature over plain http
+	_, err = NewVerifier(keyLookUp, -1).VerifyMessage(m.HeaderMessage)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	// a net/http request received over TLS
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader("POST /foo?param=value HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	assert.Nil(t, err)
+	r.TLS = &tls.ConnectionState{}
+	r.Header["Signature"] = added["Signature"]
+	r.Header["Signature-Input"] = added["Signature-Input"]
+	_, err = NewVerifier(keyLookUp, -1).Verify(r)
+	assert.Nil(t, err)
+}
+
+func TestVerifyMessageDigest(t *testing.T) {
+	m := testMessage()
+	m.Headers["Digest"] = []string{testBodyDigest}
+	added, err := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "date", "digest").SignMessage(m)
+	assert.Nil(t, err)
+	m.Headers["Signature"] = added["Signature"]
+
+	v := NewVerifier(keyLookUp, -1)
+	v.CheckDigest = true
+	_, err = v.VerifyMessage(m)
+	assert.Equal(t, ErrDigestWithoutBody, err)
+
+	result, err := v.VerifyMessageBody(m, []byte(testBody))
+	assert.Nil(t, err)
+	assert.True(t, result.DigestVerified)
+
+	_, err = v.VerifyMessageBody(m, []byte(testBody+"tampered"))
+	assert.Equal(t, ErrDigestMismatch, err)
+
+	// without CheckDigest the body is not checked
+	v.CheckDigest = false
+	result, err = v.VerifyMessageBody(m, []byte(testBody+"tampered"))
+	assert.Nil(t, err)
+	assert.False(t, result.DigestVerified)
+
+	assert.Equal(t, ErrNoDigestHeader, VerifyMessageDigest(testMessage(), []byte(testBody)))
+}
@@ -0,0 +1,145 @@
+package httpsignatures
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	keyIDContextKey contextKey = iota
+	resultContextKey
+)
+
+// NewVerifierMiddleware returns middleware which verifies the signature of
+// every request before passing it to the next handler. The signature must
+// cover the required headers, eg "(request-target)" and "date", whatever the
+// client chose to sign. Requests which fail verification are rejected with
+// the status of ErrorHTTPStatus.
+func NewVerifierMiddleware(keyResolver KeyResolver, required []string) func(http.Handler) http.Handler {
+	v := NewVerifier(nil, -1, required...)
+	v.KeyResolver = keyResolver
+	return v.Middleware
+}
+
+// VerifierOption configures the verifier of RequireSignature
+type VerifierOption func(v *Verifier)
+
+// WithKeyResolver looks up the base64 encoded keys with resolver
+func WithKeyResolver(resolver KeyResolver) VerifierOption {
+	return func(v *Verifier) {
+		v.KeyResolver = resolver
+	}
+}
+
+// WithKeyLookup looks up the raw keys with keyLookUp
+func WithKeyLookup(keyLookUp KeyLookupFunc) VerifierOption {
+	return func(v *Verifier) {
+		v.RawKeyLookUp = keyLookUp
+	}
+}
+
+// WithKeyStore looks up the keys and their algorithms in store
+func WithKeyStore(store KeyStore) VerifierOption {
+	return func(v *Verifier) {
+		v.KeyStore = store
+	}
+}
+
+// WithRequiredHeaders requires the signature to cover headers
+func WithRequiredHeaders(headers ...string) VerifierOption {
+	return func(v *Verifier) {
+		v.RequiredHeaders = headers
+	}
+}
+
+// WithRealm sets the realm of the WWW-Authenticate challenge
+func WithRealm(realm string) VerifierOption {
+	return func(v *Verifier) {
+		v.Realm = realm
+	}
+}
+
+// RequireSignature returns a handler which verifies the signature of every
+// request before passing it to next, see Middleware. Without options the
+// verifier has no keys; configure them with WithKeyResolver or
+// WithKeyLookup.
+func RequireSignature(next http.Handler, opts ...VerifierOption) http.Handler {
+	v := NewVerifier(nil, -1)
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v.Middleware(next)
+}
+
+// Middleware verifies the signature of every request against the verifier
+// policy before passing it to next. The verified signature is described in
+// the request context, see FromContext and KeyIDFromContext. Unauthorized
+// requests are answered with a WWW-Authenticate challenge listing the
+// required headers.
+func (v Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := v.Verify(r)
+		// the digest check may have replaced the body, eg by a temporary
+		// file, and net/http only closes the body it created
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+		if err != nil {
+			status := ErrorHTTPStatus(err)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", v.challenge())
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), result)))
+	})
+}
+
+// challenge returns the WWW-Authenticate challenge for the verifier, eg
+// `Signature realm="api",headers="(request-target) date"`
+func (v Verifier) challenge() string {
+	var params []string
+	if v.Realm != "" {
+		params = append(params, "realm="+quoteParameter(v.Realm))
+	}
+	if len(v.RequiredHeaders) > 0 {
+		params = append(params, "headers="+quoteParameter(strings.ToLower(strings.Join(v.RequiredHeaders, " "))))
+	}
+	scheme := v.AuthScheme
+	if scheme == "" {
+		scheme = defaultAuthScheme
+	}
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ",")
+}
+
+func quoteParameter(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// KeyIDFromContext returns the keyId of the signature verified by the
+// middleware
+func KeyIDFromContext(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(keyIDContextKey).(string)
+	return keyID, ok
+}
+
+// NewContext returns a copy of ctx carrying the verified signature, as the
+// middleware passes it to the next handler
+func NewContext(ctx context.Context, result *VerifyResult) context.Context {
+	ctx = context.WithValue(ctx, keyIDContextKey, result.KeyID)
+	return context.WithValue(ctx, resultContextKey, result)
+}
+
+// FromContext returns the signature verified by the middleware, eg to
+// authorize the keyId or to log it
+func FromContext(ctx context.Context) (*VerifyResult, bool) {
+	result, ok := ctx.Value(resultContextKey).(*VerifyResult)
+	return result, ok
+}
@@ -0,0 +1,236 @@
+package httpsignatures
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMiddleware() http.Handler {
+	resolver := func(keyID string, algorithm string) (string, error) {
+		if keyID == testKeyID {
+			return testKey, nil
+		}
+		return "", nil
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, _ := KeyIDFromContext(r.Context())
+		w.Write([]byte(keyID))
+	})
+	return NewVerifierMiddleware(resolver, []string{"(request-target)", "date"})(handler)
+}
+
+func signedTestRequest(t *testing.T, keyID string, headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	r.Header.Set("Date", testDate)
+	err := NewSigner("hmac-sha256", headers...).SignRequest(r, keyID, testKey)
+	assert.Nil(t, err)
+	return r
+}
+
+func TestVerifierMiddleware(t *testing.T) {
+	w := httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, signedTestRequest(t, testKeyID, "(request-target)", "date"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testKeyID, w.Body.String())
+}
+
+func TestVerifierMiddlewareRequiredHeaderNotSigned(t *testing.T) {
+	w := httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, signedTestRequest(t, testKeyID, "date"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorRequiredHeaderNotInHeaderList+"\n", w.Body.String())
+}
+
+func TestVerifierMiddlewareRejects(t *testing.T) {
+	// without signature
+	w := httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// unknown key
+	w = httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, signedTestRequest(t, "Other", "(request-target)", "date"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrorUnknownKeyID+"\n", w.Body.String())
+
+	// tampered request
+	r := signedTestRequest(t, testKeyID, "(request-target)", "date")
+	r.URL.Path = "/bar"
+	w = httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrorSignatureDdoNotMatch+"\n", w.Body.String())
+}
+
+func TestVerifierMiddlewareFromContext(t *testing.T) {
+	var result *VerifyResult
+	v := NewVerifier(keyLookUp, -1)
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ = FromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	err = NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256,
+		WithHeaders("(request-target)"), WithCreated(), WithExpiresIn(time.Minute)).Sign(r)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testKeyID, result.KeyID)
+	assert.Equal(t, AlgorithmHmacSha256, result.Algorithm)
+	assert.Equal(t, []string{"(request-target)", "(created)", "(expires)"}, result.Headers)
+	assert.Equal(t, time.Minute, result.Expires.Sub(result.Created))
+
+	_, ok := FromContext(r.Context())
+	assert.False(t, ok)
+}
+
+func TestVerifierMiddlewareChallenge(t *testing.T) {
+	w := httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Signature headers="(request-target) date"`, w.Header().Get("WWW-Authenticate"))
+
+	// no challenge for malformed requests
+	w = httptest.NewRecorder()
+	testMiddleware().ServeHTTP(w, signedTestRequest(t, testKeyID, "date"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "", w.Header().Get("WWW-Authenticate"))
+
+	v := NewVerifier(keyLookUp, -1)
+	v.AuthScheme = "HMAC-Signature"
+	assert.Equal(t, "HMAC-Signature", v.challenge())
+}
+
+func TestRequireSignature(t *testing.T) {
+	rawKey, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	handler := RequireSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, _ := KeyIDFromContext(r.Context())
+		w.Write([]byte(keyID))
+	}),
+		WithKeyLookup(func(keyID string) ([]byte, error) {
+			if keyID == testKeyID {
+				return rawKey, nil
+			}
+			return nil, nil
+		}),
+		WithRequiredHeaders("(request-target)", "Date"),
+		WithRealm("api"),
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedTestRequest(t, testKeyID, "(request-target)", "date"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testKeyID, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedTestRequest(t, "Other", "(request-target)", "date"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Signature realm="api",headers="(request-target) date"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestRequireSignatureRejectsAlgorithmConfusion(t *testing.T) {
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(edPublicKey)
+	assert.Nil(t, err)
+	handler := RequireSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("forged request accepted")
+	}), WithKeyLookup(func(keyID string) ([]byte, error) {
+		return publicKey, nil
+	}))
+
+	// an HMAC signature keyed with the public key
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	r.Header.Set("Date", testDate)
+	assert.Nil(t, NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, publicKey))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), ErrorAlgorithmKeyMismatch)
+}
+
+func TestVerifierMiddlewareClosesSpilledBody(t *testing.T) {
+	var body tempFileBody
+	v := NewVerifier(keyLookUp, -1, "digest")
+	v.CheckDigest = true
+	v.MaxBodyMemory = 16
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler reads the body without closing it
+		var ok bool
+		body, ok = r.Body.(tempFileBody)
+		assert.True(t, ok)
+		read, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Repeat(testBody, 10), string(read))
+	}))
+
+	for _, tampered := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(strings.Repeat(testBody, 10)))
+		r.Header.Set("Date", testDate)
+		assert.Nil(t, NewSignerWithOptions(testKeyID, nil, AlgorithmHmacSha256, WithDigest()).SignRequest(r, testKeyID, testKey))
+		if tampered {
+			r.Body = ioutil.NopCloser(strings.NewReader(strings.Repeat(testBody, 11)))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if tampered {
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			body, _ = r.Body.(tempFileBody)
+		} else {
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+
+		// the temporary file was closed after the handler
+		assert.NotNil(t, body.File)
+		_, err := body.File.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, os.ErrClosed)
+	}
+}
+
+func TestErrorHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusUnauthorized, ErrorHTTPStatus(&UnknownKeyError{KeyID: "Other"}))
+	assert.Equal(t, http.StatusBadRequest, ErrorHTTPStatus(&MissingHeaderError{Header: "date"}))
+	assert.Equal(t, http.StatusBadRequest, ErrorHTTPStatus(ErrMalformedSignatureHeader))
+	assert.Equal(t, http.StatusInternalServerError, ErrorHTTPStatus(ErrMisconfiguredClockSkew))
+	assert.Equal(t, http.StatusInternalServerError, ErrorHTTPStatus(ErrInvalidKeyEncoding))
+
+	// a client claiming an algorithm which doesn't fit the key of its keyId
+	for _, test := range []struct {
+		algorithm string
+		err       error
+		status    int
+	}{
+		{AlgorithmEd25519, ErrInvalidEd25519PublicKey, http.StatusUnauthorized},
+		{AlgorithmRsaSha256, ErrInvalidRsaPublicKey, http.StatusUnauthorized},
+		{AlgorithmEcdsaSha256, ErrInvalidEcdsaPublicKey, http.StatusUnauthorized},
+		{AlgorithmHs2019, ErrAlgorithmKeyMismatch, http.StatusBadRequest},
+	} {
+		if _, ok := LookupAlgorithm(test.algorithm); !ok {
+			// not in httpsig_minimal builds
+			continue
+		}
+		r := &http.Request{Header: http.Header{"Date": []string{testDate}}}
+		r.Header.Set("Signature", `keyId="Test",algorithm="`+test.algorithm+`",headers="date",signature="`+testSha256Hash+`"`)
+		_, err := VerifyRequest(r, keyLookUp, -1)
+		assert.ErrorIs(t, err, test.err, test.algorithm)
+		assert.Equal(t, test.status, ErrorHTTPStatus(err), test.algorithm)
+	}
+	assert.Equal(t, http.StatusUnauthorized, ErrorHTTPStatus(ErrUnsupportedKeyType))
+}
@@ -0,0 +1,93 @@
+package httpsignatures
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Observer is notified of every signature a signer creates and a verifier
+// checks, eg to monitor failure rates and latency. Embed NopObserver to
+// implement only some of the methods. ExpvarObserver publishes counters
+// with expvar, the promsig package exports Prometheus metrics.
+//
+// The methods are called synchronously, they must be safe for concurrent
+// use and should return quickly.
+type Observer interface {
+	OnSignStart(r *http.Request)
+	OnSignDone(r *http.Request, event SignatureEvent)
+	OnVerifyStart(r *http.Request)
+	OnVerifyDone(r *http.Request, event SignatureEvent)
+}
+
+// SignatureEvent describes a signature which was created or checked
+type SignatureEvent struct {
+	// KeyID and Algorithm are those of the signature, empty when a
+	// signature could not be parsed, or when none of the signatures of
+	// VerifyAny verified. A signer with Keys reports the algorithm of the
+	// key it signed with.
+	KeyID     string
+	Algorithm string
+	// Duration is how long signing or verification took
+	Duration time.Duration
+	// Err is nil when signing or verification succeeded
+	Err error
+}
+
+// NopObserver implements Observer and ignores every event
+type NopObserver struct{}
+
+// OnSignStart does nothing
+func (NopObserver) OnSignStart(r *http.Request) {}
+
+// OnSignDone does nothing
+func (NopObserver) OnSignDone(r *http.Request, event SignatureEvent) {}
+
+// OnVerifyStart does nothing
+func (NopObserver) OnVerifyStart(r *http.Request) {}
+
+// OnVerifyDone does nothing
+func (NopObserver) OnVerifyDone(r *http.Request, event SignatureEvent) {}
+
+// ExpvarObserver counts signatures and sums their durations in an
+// expvar.Map, which is served as JSON on /debug/vars: sign_success,
+// sign_failure, verify_success and verify_failure count the signatures,
+// sign_nanoseconds and verify_nanoseconds sum the time spent
+type ExpvarObserver struct {
+	NopObserver
+	Vars *expvar.Map
+}
+
+var expvarMu sync.Mutex
+
+// NewExpvarObserver creates an observer publishing its counters as the
+// expvar name, or reusing the map already published as name
+func NewExpvarObserver(name string) *ExpvarObserver {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		vars = expvar.NewMap(name)
+	}
+	return &ExpvarObserver{Vars: vars}
+}
+
+// OnSignDone counts the signature
+func (o *ExpvarObserver) OnSignDone(r *http.Request, event SignatureEvent) {
+	o.add("sign", event)
+}
+
+// OnVerifyDone counts the verification
+func (o *ExpvarObserver) OnVerifyDone(r *http.Request, event SignatureEvent) {
+	o.add("verify", event)
+}
+
+func (o *ExpvarObserver) add(operation string, event SignatureEvent) {
+	if event.Err == nil {
+		o.Vars.Add(operation+"_success", 1)
+	} else {
+		o.Vars.Add(operation+"_failure", 1)
+	}
+	o.Vars.Add(operation+"_nanoseconds", int64(event.Duration))
+}
@@ -0,0 +1,112 @@
+package httpsignatures
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+type recordingObserver struct {
+	NopObserver
+	mu     sync.Mutex
+	starts int
+	events []SignatureEvent
+}
+
+func (o *recordingObserver) OnSignStart(r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.starts++
+}
+
+func (o *recordingObserver) OnSignDone(r *http.Request, event SignatureEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) OnVerifyStart(r *http.Request) {
+	o.OnSignStart(r)
+}
+
+func (o *recordingObserver) OnVerifyDone(r *http.Request, event SignatureEvent) {
+	o.OnSignDone(r, event)
+}
+
+func TestObserver(t *testing.T) {
+	observer := &recordingObserver{}
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey)
+	signer.Observer = observer
+	assert.Nil(t, signer.Sign(r))
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Observer = observer
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	_, err = v.VerifyAny(r)
+	assert.NotNil(t, err)
+
+	_, err = v.VerifyRequest(&http.Request{Header: http.Header{}})
+	assert.Equal(t, ErrNoSignatureHeader, err)
+
+	assert.Equal(t, 4, observer.starts)
+	assert.Len(t, observer.events, 4)
+	for _, event := range observer.events[:2] {
+		assert.Equal(t, testKeyID, event.KeyID)
+		assert.Equal(t, AlgorithmHmacSha256, event.Algorithm)
+	}
+	assert.Nil(t, observer.events[0].Err)
+	assert.Nil(t, observer.events[1].Err)
+	assert.ErrorIs(t, observer.events[2].Err, ErrSignatureMismatch)
+	assert.Equal(t, SignatureEvent{Duration: observer.events[3].Duration, Err: ErrNoSignatureHeader}, observer.events[3])
+}
+
+func TestObserverKeySet(t *testing.T) {
+	keys := NewMemoryKeyStore()
+	secret, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	assert.Nil(t, keys.Add(testKeyID, AlgorithmHmacSha256, secret))
+
+	observer := &recordingObserver{}
+	signer := NewSignerWithOptions(testKeyID, nil, AlgorithmEd25519, WithKeySet(keys))
+	signer.Observer = observer
+	assert.Nil(t, signer.Sign(&http.Request{Header: http.Header{"Date": []string{testDate}}}))
+
+	assert.Len(t, observer.events, 1)
+	assert.Equal(t, AlgorithmHmacSha256, observer.events[0].Algorithm)
+}
+
+func TestExpvarObserver(t *testing.T) {
+	observer := NewExpvarObserver("httpsignatures_test")
+	assert.Equal(t, observer.Vars, NewExpvarObserver("httpsignatures_test").Vars)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey)
+	signer.Observer = observer
+	assert.Nil(t, signer.Sign(r))
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Observer = observer
+	v.VerifyRequest(r)
+	v.VerifyRequest(&http.Request{Header: http.Header{}})
+
+	assert.Equal(t, "1", observer.Vars.Get("sign_success").String())
+	assert.Equal(t, "1", observer.Vars.Get("verify_success").String())
+	assert.Equal(t, "1", observer.Vars.Get("verify_failure").String())
+	assert.Nil(t, observer.Vars.Get("sign_failure"))
+	assert.NotNil(t, observer.Vars.Get("verify_nanoseconds"))
+}
@@ -0,0 +1,95 @@
+// Package promsig exports the signatures httpsignatures signers create and
+// verifiers check as Prometheus metrics, to monitor failure rates and
+// latency:
+//
+//	observer, err := promsig.NewObserver(prometheus.DefaultRegisterer)
+//	if err != nil {
+//		return err
+//	}
+//	signer.Observer = observer
+//	verifier.Observer = observer
+package promsig
+
+import (
+	"net/http"
+
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OutcomeSuccess and OutcomeFailure are the values of the outcome label
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Observer implements httpsignatures.Observer with a counter and a
+// histogram, labeled with the operation, "sign" or "verify", and the
+// algorithm of the signature. The algorithm is empty when a signature could
+// not be parsed.
+type Observer struct {
+	httpsignatures.NopObserver
+	// Signatures counts the signatures, httpsignatures_signatures_total,
+	// labeled with operation, outcome and algorithm
+	Signatures *prometheus.CounterVec
+	// Duration observes the seconds signing and verification take,
+	// httpsignatures_duration_seconds, labeled with operation and algorithm
+	Duration *prometheus.HistogramVec
+}
+
+// NewObserver creates an observer and registers its metrics with
+// registerer, reusing the metrics already registered by another observer
+func NewObserver(registerer prometheus.Registerer) (*Observer, error) {
+	o := &Observer{
+		Signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "httpsignatures",
+			Name:      "signatures_total",
+			Help:      "Signatures created and verified, by operation, outcome and algorithm.",
+		}, []string{"operation", "outcome", "algorithm"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "httpsignatures",
+			Name:      "duration_seconds",
+			Help:      "Time spent signing and verifying, by operation and algorithm.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "algorithm"}),
+	}
+
+	if err := registerer.Register(o.Signatures); err != nil {
+		existing, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if o.Signatures, ok = existing.ExistingCollector.(*prometheus.CounterVec); !ok {
+			return nil, err
+		}
+	}
+	if err := registerer.Register(o.Duration); err != nil {
+		existing, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if o.Duration, ok = existing.ExistingCollector.(*prometheus.HistogramVec); !ok {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// OnSignDone counts the signature
+func (o *Observer) OnSignDone(r *http.Request, event httpsignatures.SignatureEvent) {
+	o.observe("sign", event)
+}
+
+// OnVerifyDone counts the verification
+func (o *Observer) OnVerifyDone(r *http.Request, event httpsignatures.SignatureEvent) {
+	o.observe("verify", event)
+}
+
+func (o *Observer) observe(operation string, event httpsignatures.SignatureEvent) {
+	outcome := OutcomeSuccess
+	if event.Err != nil {
+		outcome = OutcomeFailure
+	}
+	o.Signatures.WithLabelValues(operation, outcome, event.Algorithm).Inc()
+	o.Duration.WithLabelValues(operation, event.Algorithm).Observe(event.Duration.Seconds())
+}
@@ -0,0 +1,56 @@
+package promsig
+
+import (
+	"github.com/mvaneijk/httpsignatures-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+const (
+	testKeyID = "Test"
+	testKey   = "U29tZXRoaW5nUmFuZG9t"
+	testDate  = "Thu, 05 Jan 2012 21:31:40 GMT"
+)
+
+func keyLookUp(keyID string) (string, error) {
+	return testKey, nil
+}
+
+func TestObserver(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	observer, err := NewObserver(registry)
+	assert.Nil(t, err)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	signer := httpsignatures.NewKeySigner(testKeyID, httpsignatures.AlgorithmHmacSha256, testKey)
+	signer.Observer = observer
+	assert.Nil(t, signer.Sign(r))
+
+	v := httpsignatures.NewVerifier(keyLookUp, -1)
+	v.Observer = observer
+	v.VerifyRequest(r)
+	v.VerifyRequest(&http.Request{Header: http.Header{}})
+
+	hmac := httpsignatures.AlgorithmHmacSha256
+	assert.Equal(t, float64(1), testutil.ToFloat64(observer.Signatures.WithLabelValues("sign", OutcomeSuccess, hmac)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(observer.Signatures.WithLabelValues("verify", OutcomeSuccess, hmac)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(observer.Signatures.WithLabelValues("verify", OutcomeFailure, "")))
+	assert.Equal(t, 3, testutil.CollectAndCount(observer.Duration))
+}
+
+func TestNewObserverRegistered(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	first, err := NewObserver(registry)
+	assert.Nil(t, err)
+	second, err := NewObserver(registry)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Signatures, second.Signatures)
+	assert.Equal(t, first.Duration, second.Duration)
+}
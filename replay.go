@@ -0,0 +1,140 @@
+package httpsignatures
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// defaultReplayWindow is how long an accepted signature is remembered when
+// it has no expires parameter and the date is not checked
+const defaultReplayWindow = 5 * time.Minute
+
+// ReplayCache remembers accepted signatures, so a verifier can reject a
+// signature it has accepted before. Implementations backed by eg Redis or
+// memcached let several servers share the cache.
+type ReplayCache interface {
+	// Seen reports whether signature was seen before, and otherwise records
+	// it until expires. Checking and recording must be atomic, so two
+	// concurrent requests with the same signature can't both be accepted.
+	// The verifier identifies a signature by its keyId and the hash of its
+	// signing string, not by the encoded signature.
+	Seen(signature string, expires time.Time) (bool, error)
+}
+
+// MemoryReplayCache is an in-memory ReplayCache. It forgets signatures once
+// they expire, and the oldest signatures when it is full.
+type MemoryReplayCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	// order holds the entries oldest first
+	order *list.List
+	// Clock returns the current time, time.Now when nil
+	Clock func() time.Time
+}
+
+type replayEntry struct {
+	signature string
+	expires   time.Time
+}
+
+// NewMemoryReplayCache creates a cache remembering at most maxEntries
+// signatures, or any number when maxEntries is 0
+func NewMemoryReplayCache(maxEntries int) *MemoryReplayCache {
+	return &MemoryReplayCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// Seen reports whether signature was seen before and hasn't expired yet,
+// and otherwise records it until expires
+func (c *MemoryReplayCache) Seen(signature string, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if element, ok := c.entries[signature]; ok {
+		if now.Before(element.Value.(*replayEntry).expires) {
+			return true, nil
+		}
+		c.remove(element)
+	}
+
+	c.removeExpired(now)
+	if c.maxEntries > 0 && c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Front())
+	}
+	c.entries[signature] = c.order.PushBack(&replayEntry{signature: signature, expires: expires})
+	return false, nil
+}
+
+// removeExpired forgets the expired signatures. Entries with a later
+// expiry may precede expired ones, those are forgotten when they reach the
+// front.
+func (c *MemoryReplayCache) removeExpired(now time.Time) {
+	for element := c.order.Front(); element != nil; element = c.order.Front() {
+		if now.Before(element.Value.(*replayEntry).expires) {
+			return
+		}
+		c.remove(element)
+	}
+}
+
+func (c *MemoryReplayCache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*replayEntry).signature)
+	c.order.Remove(element)
+}
+
+func (c *MemoryReplayCache) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// checkReplay rejects signatures the replay cache has seen before. A
+// signature is remembered until it expires, or until its date falls out of
+// the allowed clock skew.
+func (v Verifier) checkReplay(sig SignatureParameters) error {
+	if v.ReplayCache == nil {
+		return nil
+	}
+
+	expires := v.now().Add(defaultReplayWindow)
+	if sig.Expires != 0 {
+		expires = time.Unix(sig.Expires, 0).Add(v.TimestampSkew)
+	} else if v.AllowedClockSkew > 0 {
+		expires = v.now().Add(2 * time.Duration(v.AllowedClockSkew) * time.Second)
+	}
+
+	key, err := replayKey(sig)
+	if err != nil {
+		return err
+	}
+	seen, err := v.ReplayCache.Seen(key, expires)
+	if err != nil {
+		return err
+	}
+	if seen {
+		return ErrSignatureReplayed
+	}
+	return nil
+}
+
+// replayKey identifies a signature in the replay cache by its keyId and the
+// SHA-256 hash of its signing string. The encoded signature can be altered
+// without invalidating it: base64 has unused bits in its last character, and
+// an ECDSA signature (r, s) is as valid as (r, n-s).
+func replayKey(sig SignatureParameters) (string, error) {
+	signingString, err := sig.signingString()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(signingString))
+	return sig.KeyID + " " + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,217 @@
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryReplayCache(t *testing.T) {
+	now := time.Unix(1402170695, 0)
+	c := NewMemoryReplayCache(0)
+	c.Clock = func() time.Time { return now }
+
+	seen, err := c.Seen("a", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.False(t, seen)
+
+	seen, err = c.Seen("a", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.True(t, seen)
+
+	// forgotten once expired
+	now = now.Add(time.Minute)
+	seen, err = c.Seen("a", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.False(t, seen)
+}
+
+func TestMemoryReplayCacheMaxEntries(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	c := NewMemoryReplayCache(2)
+
+	for _, signature := range []string{"a", "b", "c"} {
+		seen, err := c.Seen(signature, expires)
+		assert.Nil(t, err)
+		assert.False(t, seen)
+	}
+	assert.Len(t, c.entries, 2)
+
+	// the oldest signature was forgotten
+	seen, _ := c.Seen("c", expires)
+	assert.True(t, seen)
+	seen, _ = c.Seen("a", expires)
+	assert.False(t, seen)
+}
+
+func TestVerifyReplayCache(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.ReplayCache = NewMemoryReplayCache(0)
+
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrSignatureReplayed)
+	assert.Equal(t, http.StatusUnauthorized, ErrorHTTPStatus(err))
+}
+
+func TestVerifyReplayCacheIgnoresInvalidSignatures(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.ReplayCache = NewMemoryReplayCache(0)
+
+	// a tampered request doesn't burn the signature
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	r.Header.Set("Date", testDate)
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyReplayCacheIgnoresTamperedBodies(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	assert.Nil(t, NewSignerWithOptions(testKeyID, nil, AlgorithmHmacSha256, WithDigest()).SignRequest(r, testKeyID, testKey))
+
+	v := NewVerifier(keyLookUp, -1)
+	v.CheckDigest = true
+	v.ReplayCache = NewMemoryReplayCache(0)
+
+	// a request with a tampered body doesn't burn the signature
+	for _, verify := range []func(r *http.Request) error{
+		func(r *http.Request) error {
+			_, err := v.VerifyRequestStrict(r)
+			return err
+		},
+		func(r *http.Request) error {
+			_, err := v.Verify(r)
+			return err
+		},
+	} {
+		v.ReplayCache = NewMemoryReplayCache(0)
+		r.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "mallory"}`))
+		assert.ErrorIs(t, verify(r), ErrDigestMismatch)
+
+		r.Body = ioutil.NopCloser(strings.NewReader(testBody))
+		assert.Nil(t, verify(r))
+		r.Body = ioutil.NopCloser(strings.NewReader(testBody))
+		assert.ErrorIs(t, verify(r), ErrSignatureReplayed)
+	}
+}
+
+// replaceSignature replaces the signature of the Signature header of r
+func replaceSignature(t *testing.T, r *http.Request, replace func(signature string) string) {
+	var sig SignatureParameters
+	assert.Nil(t, sig.FromRequest(r))
+	header := r.Header.Get("Signature")
+	altered := replace(sig.Signature)
+	assert.NotEqual(t, sig.Signature, altered)
+	r.Header.Set("Signature", strings.Replace(header, `signature="`+sig.Signature+`"`, `signature="`+altered+`"`, 1))
+}
+
+func TestVerifyReplayCacheAlteredEncoding(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.ReplayCache = NewMemoryReplayCache(0)
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the last character before the padding has 2 unused bits, flipping
+	// them leaves the decoded signature as is
+	replaceSignature(t, r, func(signature string) string {
+		const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+		last := len(signature) - 2
+		return signature[:last] + string(alphabet[strings.IndexByte(alphabet, signature[last])^1]) + signature[last+1:]
+	})
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrSignatureReplayed)
+}
+
+func TestVerifyReplayCacheEcdsaMalleability(t *testing.T) {
+	skipUnregistered(t, AlgorithmEcdsaSha256)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	privateKey, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err = NewSigner(AlgorithmEcdsaSha256).SignRequestKey(r, testKeyID, privateKey)
+	assert.Nil(t, err)
+
+	v := NewKeyVerifier(func(keyID string) ([]byte, error) {
+		return publicKey, nil
+	}, -1)
+	v.ReplayCache = NewMemoryReplayCache(0)
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// (r, n-s) is a valid signature as well
+	replaceSignature(t, r, func(signature string) string {
+		der, err := base64.StdEncoding.DecodeString(signature)
+		assert.Nil(t, err)
+		var rs struct{ R, S *big.Int }
+		_, err = asn1.Unmarshal(der, &rs)
+		assert.Nil(t, err)
+		rs.S.Sub(elliptic.P256().Params().N, rs.S)
+		der, err = asn1.Marshal(rs)
+		assert.Nil(t, err)
+		return base64.StdEncoding.EncodeToString(der)
+	})
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrSignatureReplayed)
+
+	// without the cache the altered signature verifies
+	v.ReplayCache = nil
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
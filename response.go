@@ -0,0 +1,154 @@
+package httpsignatures
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SignResponse adds a http signature with the key of the signer to the
+// headers of the response, setting the Date header when it is missing. A
+// signature covering (request-target) signs the target of resp.Request.
+// With DigestAlgorithms the body is read to compute its digest, and
+// replaced by a buffered copy.
+func (s Signer) SignResponse(resp *http.Response) error {
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	r := responseRequest(resp)
+	err := s.signResponseHeaders(r)
+	resp.Body = r.Body
+	return err
+}
+
+// SigningResponseWriter returns a writer which signs the response to r when
+// the handler writes the header, so every covered header must be set before
+// the first call to WriteHeader or Write. When signing fails the response is
+// replaced by a 500 Internal Server Error.
+//
+// The body is not written yet when the header is signed, so the writer
+// can't compute its digest. With DigestAlgorithms the handler sets the
+// Digest or Content-Digest header itself, eg with SetDigest, and the writer
+// covers it. Signing fails when neither is set.
+func (s Signer) SigningResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	return &signingResponseWriter{ResponseWriter: w, r: r, signer: s}
+}
+
+func (s Signer) signResponseHeaders(r *http.Request) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", s.now().UTC().Format(http.TimeFormat))
+	}
+	return s.Sign(r)
+}
+
+// precomputedDigest returns the signer for a response with the digest
+// header set by the handler: without DigestAlgorithms, covering the digest
+// header when the signer doesn't. It fails when DigestAlgorithms are set
+// and the header has no digest.
+func (s Signer) precomputedDigest(header http.Header) (Signer, error) {
+	if len(s.DigestAlgorithms) == 0 {
+		return s, nil
+	}
+	s.DigestAlgorithms = nil
+	digest, contentDigest := header.Get(HeaderDigest) != "", header.Get(HeaderContentDigest) != ""
+	if !digest && !contentDigest {
+		return s, ErrNoDigestHeader
+	}
+
+	headers := s.headers
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	for _, name := range headers {
+		if name = strings.ToLower(name); name == HeaderDigest || name == HeaderContentDigest {
+			return s, nil
+		}
+	}
+	name := HeaderDigest
+	if contentDigest && (!digest || s.Format == FormatRFC9421) {
+		name = HeaderContentDigest
+	}
+	s.headers = append(headers[:len(headers):len(headers)], name)
+	return s, nil
+}
+
+type signingResponseWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	signer Signer
+
+	wroteHeader bool
+	err         error
+}
+
+func (w *signingResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	r := &http.Request{Header: w.Header(), Method: w.r.Method, URL: w.r.URL}
+	signer, err := w.signer.precomputedDigest(w.Header())
+	if err == nil {
+		err = signer.signResponseHeaders(r)
+	}
+	if w.err = err; w.err != nil {
+		w.Header().Del("Signature")
+		w.Header().Del("Authorization")
+		code = http.StatusInternalServerError
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *signingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// VerifyResponse verifies the signature added to the response and returns true if it is OK
+func VerifyResponse(resp *http.Response, keyLookUp func(keyID string) (string, error), allowedClockSkew int, headers ...string) (bool, error) {
+	return NewVerifier(keyLookUp, allowedClockSkew, headers...).VerifyResponse(resp)
+}
+
+// VerifyResponse verifies the signature added to the response against the
+// verifier policy and returns true if it is OK. A response has no target of
+// its own: a signature covering (request-target) or host is checked against
+// resp.Request, the request the response belongs to, and fails when it is nil.
+func (v Verifier) VerifyResponse(resp *http.Response) (bool, error) {
+	r := responseRequest(resp)
+	// the digest check may replace the body with a buffered copy
+	defer func() { resp.Body = r.Body }()
+
+	if resp.Request == nil {
+		sig := SignatureParameters{}
+		if err := sig.parseSignatureHeader(RequestMessage(r), v.requestOptions()); err != nil {
+			return false, err
+		}
+		if _, ok := sig.Headers.Get(HeaderRequestTarget); ok {
+			return false, ErrRequestTargetWithoutRequest
+		}
+	}
+
+	_, ok, err := v.verifyRequest(r, v.checks(), v.checkDigest(r))
+	return ok, err
+}
+
+// responseRequest returns a request carrying the headers and the body of
+// the response, and the method and URL of the originating request when
+// there is one, so the request code paths can load the headers covered by
+// the signature and digest the body
+func responseRequest(resp *http.Response) *http.Request {
+	r := &http.Request{Header: resp.Header, Body: resp.Body}
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	if resp.Request != nil {
+		r.Method = resp.Request.Method
+		r.URL = resp.Request.URL
+	}
+	return r
+}
@@ -0,0 +1,204 @@
+package httpsignatures
+
+import (
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// signResponse signs the headers of the response, and the target of its
+// request when there is one, like a signing server would
+func signResponse(t *testing.T, resp *http.Response, headers ...string) {
+	err := NewSigner("hmac-sha256", headers...).SignRequest(responseRequest(resp), testKeyID, testKey)
+	assert.Nil(t, err)
+}
+
+func TestVerifyResponse(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{
+			"Date":         []string{testDate},
+			"Content-Type": []string{"application/json"},
+		},
+	}
+	signResponse(t, resp, "date", "content-type")
+
+	res, err := VerifyResponse(resp, keyLookUp, -1, "date")
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	resp.Header.Set("Content-Type", "text/plain")
+	res, err = VerifyResponse(resp, keyLookUp, -1, "date")
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyResponseRequestTarget(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	resp := &http.Response{
+		Header:  http.Header{"Date": []string{testDate}},
+		Request: req,
+	}
+	signResponse(t, resp, "(request-target)", "host", "date")
+
+	res, err := VerifyResponse(resp, keyLookUp, -1, "(request-target)")
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// a response to another request does not verify
+	resp.Request, err = http.NewRequest(http.MethodPost, "http://example.com/bar", nil)
+	assert.Nil(t, err)
+	res, err = VerifyResponse(resp, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyResponseWithoutRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	resp := &http.Response{
+		Header:  http.Header{"Date": []string{testDate}},
+		Request: req,
+	}
+	signResponse(t, resp, "(request-target)", "date")
+
+	resp.Request = nil
+	res, err := VerifyResponse(resp, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorRequestTargetWithoutRequest)
+}
+
+func TestVerifyResponseWithoutRequestHost(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{
+			"Date":      []string{testDate},
+			"Signature": []string{`keyId="Test",algorithm="hmac-sha256",headers="host date",signature="AAAA"`},
+		},
+	}
+
+	res, err := VerifyResponse(resp, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'host'")
+}
+
+func TestVerifyResponseNoSignature(t *testing.T) {
+	resp := &http.Response{}
+
+	res, err := VerifyResponse(resp, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorNoSignatureHeaderFoundInRequest)
+}
+
+func TestSignResponse(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	resp := &http.Response{Request: req}
+
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "(request-target)", "date")
+	err = signer.SignResponse(resp)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", resp.Header.Get("Date"))
+
+	res, err := VerifyResponse(resp, keyLookUp, -1, "(request-target)")
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSignResponseDigest(t *testing.T) {
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "date")
+	signer.DigestAlgorithms = []string{"SHA-256"}
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(testBody))}
+	err := signer.SignResponse(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, testBodyDigest, resp.Header.Get("Digest"))
+
+	// the body can still be read
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(body))
+
+	resp.Body = ioutil.NopCloser(strings.NewReader(testBody))
+	v := NewVerifier(keyLookUp, -1, "digest")
+	v.CheckDigest = true
+	res, err := v.VerifyResponse(resp)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	resp.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+	res, err = v.VerifyResponse(resp)
+	assert.False(t, res)
+	assert.Equal(t, ErrDigestMismatch, err)
+}
+
+func TestSigningResponseWriterDigest(t *testing.T) {
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "date")
+	signer.DigestAlgorithms = []string{"SHA-256"}
+
+	// the handler sets the digest of the body it writes
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = signer.SigningResponseWriter(w, r)
+		sum := sha256.Sum256([]byte(testBody))
+		assert.Nil(t, SetDigest(&http.Request{Header: w.Header()}, "SHA-256", sum[:]))
+		w.Write([]byte(testBody))
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Signature"), `headers="date digest"`)
+
+	v := NewVerifier(keyLookUp, -1, "digest")
+	v.CheckDigest = true
+	res, err := v.VerifyResponse(w.Result())
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// without a digest the empty body would be signed
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = signer.SigningResponseWriter(w, r)
+		_, err := w.Write([]byte(testBody))
+		assert.Equal(t, ErrNoDigestHeader, err)
+	})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestSigningResponseWriter(t *testing.T) {
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "(request-target)", "date", "content-type")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = signer.SigningResponseWriter(w, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testBody))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testBody, w.Body.String())
+
+	resp := w.Result()
+	resp.Request = r
+	res, err := VerifyResponse(resp, keyLookUp, -1, "(request-target)", "content-type")
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSigningResponseWriterSignError(t *testing.T) {
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "content-type")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = signer.SigningResponseWriter(w, r)
+		_, err := w.Write([]byte(testBody))
+		assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'content-type'")
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Signature"))
+}
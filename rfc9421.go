@@ -0,0 +1,741 @@
+package httpsignatures
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderSignatureParams is the component identifier of the last line of
+	// an RFC 9421 signature base
+	HeaderSignatureParams string = "@signature-params"
+	// HeaderSignatureInput carries the covered components and parameters of
+	// RFC 9421 signatures, the signatures themselves are in the Signature
+	// header
+	HeaderSignatureInput string = "signature-input"
+
+	defaultSignatureLabel = "sig1"
+)
+
+// SignatureFormat selects between draft-cavage and RFC 9421 signatures
+type SignatureFormat int
+
+const (
+	// FormatAuto signs draft-cavage signatures, and verifies RFC 9421
+	// signatures when the request has a Signature-Input header, falling back
+	// to draft-cavage otherwise
+	FormatAuto SignatureFormat = iota
+	// FormatCavage only signs and verifies draft-cavage signatures
+	FormatCavage
+	// FormatRFC9421 only signs and verifies RFC 9421 signatures
+	FormatRFC9421
+)
+
+var errorInvalidStructuredFieldString = errors.New("Invalid character in structured field string")
+
+// signatureParams holds the covered components and the metadata of an
+// RFC 9421 signature, as carried in the Signature-Input header
+type signatureParams struct {
+	Components []string
+	Created    int64
+	Expires    int64
+	Nonce      string
+	KeyID      string
+	Algorithm  string
+}
+
+// serialize encodes the parameters as a structured field inner list,
+// eg `("@method" "content-type");created=1618884473;keyid="test-key"`
+func (p signatureParams) serialize() (string, error) {
+	components := make([]string, 0, len(p.Components))
+	for _, component := range p.Components {
+		c, err := componentIdentifier(component)
+		if err != nil {
+			return "", err
+		}
+		components = append(components, c)
+	}
+	str := "(" + strings.Join(components, " ") + ")"
+
+	if p.Created != 0 {
+		str += ";created=" + strconv.FormatInt(p.Created, 10)
+	}
+	if p.Expires != 0 {
+		str += ";expires=" + strconv.FormatInt(p.Expires, 10)
+	}
+	if len(p.Nonce) != 0 {
+		nonce, err := serializeString(p.Nonce)
+		if err != nil {
+			return "", err
+		}
+		str += ";nonce=" + nonce
+	}
+	if len(p.KeyID) != 0 {
+		keyID, err := serializeString(p.KeyID)
+		if err != nil {
+			return "", err
+		}
+		str += ";keyid=" + keyID
+	}
+	if len(p.Algorithm) != 0 {
+		alg, err := serializeString(p.Algorithm)
+		if err != nil {
+			return "", err
+		}
+		str += ";alg=" + alg
+	}
+
+	return str, nil
+}
+
+// componentName normalizes a component of the signer configuration:
+// the name is lowercased and parameter values are serialized as strings,
+// eg `@Query-Param;name=Pet` becomes `@query-param;name="Pet"`
+func componentName(component string) string {
+	name, params := splitComponent(component)
+	name = strings.ToLower(name)
+	if params == "" {
+		return name
+	}
+	for _, param := range strings.Split(params[1:], ";") {
+		parts := strings.SplitN(param, "=", 2)
+		name += ";" + strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) == 1 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		if !strings.HasPrefix(value, `"`) {
+			if serialized, err := serializeString(value); err == nil {
+				value = serialized
+			}
+		}
+		name += "=" + value
+	}
+	return name
+}
+
+// splitComponent splits a component into its name and its parameters, eg
+// `@query-param;name="pet"` into `@query-param` and `;name="pet"`
+func splitComponent(component string) (name, params string) {
+	if i := strings.IndexByte(component, ';'); i >= 0 {
+		return component[:i], component[i:]
+	}
+	return component, ""
+}
+
+// componentIdentifier serializes a component as it appears in the
+// Signature-Input header and the signature base, eg `"@query-param";name="pet"`
+func componentIdentifier(component string) (string, error) {
+	name, params := splitComponent(component)
+	identifier, err := serializeString(strings.ToLower(name))
+	if err != nil {
+		return "", err
+	}
+	return identifier + params, nil
+}
+
+// componentParam returns the value of the string parameter key of a
+// component, eg "pet" for name in `@query-param;name="pet"`
+func componentParam(component, key string) (string, bool) {
+	_, params := splitComponent(component)
+	p := &sfParser{in: params}
+	for p.consume(';') {
+		name, err := p.key()
+		if err != nil || !p.consume('=') {
+			return "", false
+		}
+		if name != key {
+			if p.bareItem() != nil {
+				return "", false
+			}
+			continue
+		}
+		value, err := p.string()
+		return value, err == nil
+	}
+	return "", false
+}
+
+// signatureBaseLine returns the final "@signature-params" line of the
+// signature base, which has no trailing newline
+func (p signatureParams) signatureBaseLine() (string, error) {
+	params, err := p.serialize()
+	if err != nil {
+		return "", err
+	}
+	return `"` + HeaderSignatureParams + `": ` + params, nil
+}
+
+// targetURI reconstructs the absolute target URI of a message for the
+// "@target-uri" component. On the server side the request target usually
+// only holds the path and query, so the scheme is taken from the message,
+// see SchemeMessage, and the authority from its host. Behind a proxy these
+// don't match what the client signed, Verifier.Target supplies the URL the
+// client addressed instead. It is empty when the request target of the
+// message is invalid.
+func targetURI(m Message) string {
+	u, err := messageURL(m)
+	if err != nil {
+		return ""
+	}
+	return targetScheme(m, u) + "://" + targetAuthority(m, u) + u.RequestURI()
+}
+
+// targetScheme returns the lowercase scheme of the target URI u of the
+// message, see targetURI
+func targetScheme(m Message, u *url.URL) string {
+	scheme := u.Scheme
+	if len(scheme) == 0 {
+		scheme = messageScheme(m)
+	}
+	return strings.ToLower(scheme)
+}
+
+// targetAuthority returns the lowercase authority of the target URI u of
+// the message, see targetURI. The host is used as received, it is not
+// parsed.
+func targetAuthority(m Message, u *url.URL) string {
+	authority := messageHost(m)
+	if len(authority) == 0 {
+		authority = u.Host
+	}
+	return strings.ToLower(authority)
+}
+
+func (s *SignatureParameters) parseRFC9421(m Message, label string) error {
+	*s = SignatureParameters{}
+
+	inputs, err := parseSignatureInput(strings.Join(m.Header(HeaderSignatureInput), ", "))
+	if err != nil {
+		return err
+	}
+	var input *signatureInputMember
+	for i := range inputs {
+		if label == "" || inputs[i].label == label {
+			input = &inputs[i]
+			break
+		}
+	}
+	if input == nil {
+		return ErrNoSignatureHeader
+	}
+
+	signatures, err := parseSignatureDictionary(strings.Join(m.Header("Signature"), ", "))
+	if err != nil {
+		return err
+	}
+	signature, ok := signatures[input.label]
+	if !ok {
+		return ErrMissingSignature
+	}
+
+	if len(input.params.KeyID) == 0 {
+		return ErrMissingKeyID
+	}
+	// alg is optional, without it the algorithm is the one of the key, as
+	// for hs2019
+	alg := algorithmHs2019
+	if len(input.params.Algorithm) != 0 {
+		if alg, err = algorithmFromString(input.params.Algorithm); err != nil {
+			return err
+		}
+	}
+
+	s.KeyID = input.params.KeyID
+	s.Algorithm = alg
+	s.Signature = base64.StdEncoding.EncodeToString(signature)
+	s.Created = input.params.Created
+	s.Expires = input.params.Expires
+	for _, component := range input.params.Components {
+		s.Headers = append(s.Headers, HeaderField{Name: component})
+	}
+	s.signatureInput = input.value
+	return nil
+}
+
+// rfc9421SignaturesFromRequest parses every RFC 9421 signature of the
+// request, in the order of the Signature-Input members, or only the one
+// with the label of the options
+func rfc9421SignaturesFromMessage(m Message, opts requestOptions) ([]SignatureParameters, error) {
+	if opts.label != "" {
+		s := SignatureParameters{}
+		if err := s.fromMessage(m, opts); err != nil {
+			return nil, err
+		}
+		return []SignatureParameters{s}, nil
+	}
+
+	inputs, err := parseSignatureInput(strings.Join(m.Header(HeaderSignatureInput), ", "))
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkSignatureCount(len(inputs)); err != nil {
+		return nil, err
+	}
+
+	signatures := make([]SignatureParameters, len(inputs))
+	for i, input := range inputs {
+		if err := signatures[i].parseRFC9421(m, input.label); err != nil {
+			return nil, err
+		}
+		if err := signatures[i].parseMessage(m, opts); err != nil {
+			return nil, err
+		}
+	}
+	return signatures, nil
+}
+
+// loadComponents fills in the values of all covered RFC 9421 components
+// and returns an error for every component which could not be loaded
+func (s *SignatureParameters) loadComponents(m Message, opts requestOptions) []error {
+	var errs []error
+	for i, component := range s.Headers {
+		value, err := componentValue(m, component.Name, opts)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		s.Headers[i].Value = value
+	}
+	return errs
+}
+
+// derivedComponents are the derived components of requests (RFC 9421
+// section 2.2) without parameters, see queryParamComponents for
+// "@query-param"
+var derivedComponents = []string{"@method", "@target-uri", "@authority", "@scheme", "@request-target", "@path", "@query"}
+
+// queryParamComponents returns an "@query-param" component per query
+// parameter of the message, ordered by name
+func queryParamComponents(m Message) []string {
+	u, err := messageURL(m)
+	if err != nil {
+		return nil
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil
+	}
+	components := []string{}
+	for param := range query {
+		name, err := serializeString(strings.ReplaceAll(url.QueryEscape(param), "+", "%20"))
+		if err == nil {
+			components = append(components, "@query-param;name="+name)
+		}
+	}
+	sort.Strings(components)
+	return components
+}
+
+// componentValue returns the value of a derived component (RFC 9421
+// section 2.2) or of a header
+func componentValue(m Message, name string, opts requestOptions) (string, error) {
+	if !strings.HasPrefix(name, "@") {
+		if err := checkHeaderName(name); err != nil {
+			return "", err
+		}
+		if value, ok := headerValue(m, name, opts); ok {
+			return value, nil
+		}
+		return "", &MissingHeaderError{Header: name}
+	}
+
+	if name == "@method" {
+		if len(m.Method()) == 0 {
+			return "", ErrMethodNotInRequest
+		}
+		return m.Method(), nil
+	}
+	u, err := messageURL(m)
+	if err != nil {
+		return "", err
+	}
+	switch name {
+	case "@target-uri":
+		return targetURI(m), nil
+	case "@authority":
+		return targetAuthority(m, u), nil
+	case "@scheme":
+		return targetScheme(m, u), nil
+	case "@request-target":
+		return u.RequestURI(), nil
+	case "@path":
+		if path := u.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + u.RawQuery, nil
+	}
+	if base, _ := splitComponent(name); base == "@query-param" {
+		return queryParamValue(u, name)
+	}
+	return "", fmt.Errorf("%w '%s'", ErrUnsupportedComponent, name)
+}
+
+// queryParamValue returns the value of an "@query-param" component (RFC 9421
+// section 2.2.8), its name parameter is the encoded name of the query
+// parameter. A parameter which occurs more than once can't be signed.
+func queryParamValue(u *url.URL, component string) (string, error) {
+	encoded, ok := componentParam(component, "name")
+	if !ok {
+		return "", fmt.Errorf("%w '%s'", ErrUnsupportedComponent, component)
+	}
+	param, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w '%s'", ErrUnsupportedComponent, component)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", ErrURLNotInRequest
+	}
+	switch values := query[param]; len(values) {
+	case 0:
+		return "", &MissingHeaderError{Header: component}
+	case 1:
+		return strings.ReplaceAll(url.QueryEscape(values[0]), "+", "%20"), nil
+	}
+	return "", fmt.Errorf("%w '%s'", ErrRepeatedQueryParameter, param)
+}
+
+// signatureBase returns the RFC 9421 signature base: a line per covered
+// component followed by the "@signature-params" line
+func (s SignatureParameters) signatureBase() string {
+	var b bytes.Buffer
+	for _, component := range s.Headers {
+		name, params := splitComponent(component.Name)
+		b.WriteString(`"` + name + `"` + params + ": " + component.Value + "\n")
+	}
+	b.WriteString(`"` + HeaderSignatureParams + `": ` + s.signatureInput)
+	return b.String()
+}
+
+// signRFC9421 returns the Signature-Input and Signature headers of an RFC
+// 9421 signature of the components of sig of the message
+func (s Signer) signRFC9421(m Message, sig SignatureParameters, sign signFunc) (http.Header, error) {
+	now := s.now()
+	sig.Created = now.Unix()
+	if s.ExpiresIn > 0 {
+		sig.Expires = now.Add(s.ExpiresIn).Unix()
+	}
+
+	params := signatureParams{
+		Components: sig.Headers.Names(),
+		Created:    sig.Created,
+		Expires:    sig.Expires,
+		Nonce:      s.Nonce,
+		KeyID:      sig.KeyID,
+		Algorithm:  sig.Algorithm.Name,
+	}
+	if s.Hs2019 {
+		params.Algorithm = ""
+	}
+	input, err := params.serialize()
+	if err != nil {
+		return nil, err
+	}
+	sig.signatureInput = input
+
+	if err := sig.parseMessage(m, s.requestOptions()); err != nil {
+		return nil, err
+	}
+	signature, err := sig.calculateSignatureWith(sign)
+	if err != nil {
+		return nil, err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = defaultSignatureLabel
+	}
+	return http.Header{
+		http.CanonicalHeaderKey(HeaderSignatureInput): {label + "=" + input},
+		"Signature": {label + "=:" + signature + ":"},
+	}, nil
+}
+
+type signatureInputMember struct {
+	label string
+	// value is the member value as received, it is the value of the
+	// "@signature-params" line of the signature base
+	value  string
+	params signatureParams
+}
+
+// parseSignatureInput parses the Signature-Input structured field
+// dictionary, eg `sig1=("@method" "date");created=1618884473;keyid="k"`
+func parseSignatureInput(in string) ([]signatureInputMember, error) {
+	var members []signatureInputMember
+	p := &sfParser{in: in}
+	p.skipSpaces()
+	for !p.done() {
+		label, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume('=') || !p.consume('(') {
+			return nil, ErrMalformedSignatureHeader
+		}
+		start := p.i - 1
+
+		member := signatureInputMember{label: label}
+		for {
+			p.skipSpaces()
+			if p.consume(')') {
+				break
+			}
+			component, err := p.string()
+			if err != nil {
+				return nil, err
+			}
+			// component parameters, eg `"@query-param";name="pet"`, are kept
+			// as received
+			paramsStart := p.i
+			for p.consume(';') {
+				if _, err := p.key(); err != nil {
+					return nil, err
+				}
+				if p.consume('=') {
+					if err := p.bareItem(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			component += p.in[paramsStart:p.i]
+			member.params.Components = append(member.params.Components, component)
+			if !p.peek(' ') && !p.peek(')') {
+				return nil, ErrMalformedSignatureHeader
+			}
+		}
+
+		for p.consume(';') {
+			p.skipSpaces()
+			name, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume('=') {
+				continue // boolean true
+			}
+			switch name {
+			case "created", "expires":
+				value, err := p.integer()
+				if err != nil {
+					return nil, err
+				}
+				if name == "created" {
+					member.params.Created = value
+				} else {
+					member.params.Expires = value
+				}
+			case "keyid", "alg", "nonce":
+				value, err := p.string()
+				if err != nil {
+					return nil, err
+				}
+				switch name {
+				case "keyid":
+					member.params.KeyID = value
+				case "alg":
+					member.params.Algorithm = value
+				default:
+					member.params.Nonce = value
+				}
+			default:
+				// eg tag
+				if err := p.bareItem(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		member.value = p.in[start:p.i]
+		members = append(members, member)
+
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// parseSignatureDictionary parses the RFC 9421 Signature structured field
+// dictionary, eg `sig1=:dGVzdA==:`, and returns the signatures by label
+func parseSignatureDictionary(in string) (map[string][]byte, error) {
+	signatures := map[string][]byte{}
+	p := &sfParser{in: in}
+	p.skipSpaces()
+	for !p.done() {
+		label, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume('=') || !p.consume(':') {
+			return nil, ErrMalformedSignatureHeader
+		}
+		end := strings.IndexByte(p.in[p.i:], ':')
+		if end < 0 {
+			return nil, ErrMalformedSignatureHeader
+		}
+		signature, err := base64.StdEncoding.DecodeString(p.in[p.i : p.i+end])
+		if err != nil {
+			return nil, ErrMalformedSignatureHeader
+		}
+		p.i += end + 1
+		signatures[label] = signature
+
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return signatures, nil
+}
+
+// sfParser parses the subset of RFC 8941 structured fields used by RFC 9421
+type sfParser struct {
+	in string
+	i  int
+}
+
+func (p *sfParser) done() bool {
+	return p.i >= len(p.in)
+}
+
+func (p *sfParser) peek(c byte) bool {
+	return !p.done() && p.in[p.i] == c
+}
+
+func (p *sfParser) consume(c byte) bool {
+	if p.peek(c) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sfParser) skipSpaces() {
+	for p.peek(' ') || p.peek('\t') {
+		p.i++
+	}
+}
+
+// nextMember skips the comma between dictionary members
+func (p *sfParser) nextMember() error {
+	p.skipSpaces()
+	if p.done() {
+		return nil
+	}
+	if !p.consume(',') {
+		return ErrMalformedSignatureHeader
+	}
+	p.skipSpaces()
+	if p.done() {
+		return ErrMalformedSignatureHeader
+	}
+	return nil
+}
+
+// key parses a dictionary or parameter key
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	for !p.done() {
+		c := p.in[p.i]
+		if c >= 'a' && c <= 'z' || c == '*' || p.i > start && (c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			p.i++
+			continue
+		}
+		break
+	}
+	if start == p.i {
+		return "", ErrMalformedSignatureHeader
+	}
+	return p.in[start:p.i], nil
+}
+
+func (p *sfParser) string() (string, error) {
+	if !p.consume('"') {
+		return "", ErrMalformedSignatureHeader
+	}
+	var b bytes.Buffer
+	for !p.done() {
+		c := p.in[p.i]
+		p.i++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\':
+			if !p.peek('"') && !p.peek('\\') {
+				return "", ErrMalformedSignatureHeader
+			}
+			b.WriteByte(p.in[p.i])
+			p.i++
+		case c < 0x20 || c > 0x7e:
+			return "", ErrMalformedSignatureHeader
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", ErrMalformedSignatureHeader
+}
+
+func (p *sfParser) integer() (int64, error) {
+	start := p.i
+	p.consume('-')
+	for !p.done() && p.in[p.i] >= '0' && p.in[p.i] <= '9' {
+		p.i++
+	}
+	value, err := strconv.ParseInt(p.in[start:p.i], 10, 64)
+	if err != nil {
+		return 0, ErrMalformedSignatureHeader
+	}
+	return value, nil
+}
+
+// bareItem skips a string, integer, token or boolean parameter value
+func (p *sfParser) bareItem() error {
+	switch {
+	case p.peek('"'):
+		_, err := p.string()
+		return err
+	case p.peek('?'):
+		p.i++
+		if !p.consume('0') && !p.consume('1') {
+			return ErrMalformedSignatureHeader
+		}
+		return nil
+	case p.peek('-') || !p.done() && p.in[p.i] >= '0' && p.in[p.i] <= '9':
+		_, err := p.integer()
+		return err
+	}
+	start := p.i
+	for !p.done() && strings.IndexByte(" ,;()\"=", p.in[p.i]) < 0 {
+		p.i++
+	}
+	if start == p.i {
+		return ErrMalformedSignatureHeader
+	}
+	return nil
+}
+
+// serializeString encodes a structured field string (RFC 8941 section 4.1.6)
+func serializeString(in string) (string, error) {
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if c < 0x20 || c > 0x7e {
+			return "", errorInvalidStructuredFieldString
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
@@ -0,0 +1,362 @@
+package httpsignatures
+
+import (
+	"bufio"
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignatureParamsLine(t *testing.T) {
+	// example from RFC 9421 section 2.5
+	p := signatureParams{
+		Components: []string{"@method", "@authority", "@path", "content-digest", "content-length", "content-type"},
+		Created:    1618884473,
+		KeyID:      "test-key-rsa-pss",
+	}
+	line, err := p.signatureBaseLine()
+	assert.Nil(t, err)
+	assert.Equal(t, `"@signature-params": ("@method" "@authority" "@path" "content-digest" "content-length" "content-type");created=1618884473;keyid="test-key-rsa-pss"`, line)
+}
+
+func TestSignatureParamsAllParameters(t *testing.T) {
+	p := signatureParams{
+		Components: []string{"Date", "@request-target"},
+		Created:    1402170695,
+		Expires:    1402170995,
+		KeyID:      `key "one"`,
+		Algorithm:  "hmac-sha256",
+	}
+	params, err := p.serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, `("date" "@request-target");created=1402170695;expires=1402170995;keyid="key \"one\"";alg="hmac-sha256"`, params)
+}
+
+func TestSignatureParamsEmptyComponents(t *testing.T) {
+	params, err := signatureParams{}.serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, `()`, params)
+}
+
+func TestSignatureParamsInvalidString(t *testing.T) {
+	_, err := signatureParams{KeyID: "key\n"}.serialize()
+	assert.Equal(t, errorInvalidStructuredFieldString, err)
+}
+
+func TestTargetURIPlaintext(t *testing.T) {
+	// server side request, the URL only holds the path and query
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET /foo/bar?param=value&pet=dog HTTP/1.1\r\nHost: Example.com:8080\r\n\r\n")))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "http://example.com:8080/foo/bar?param=value&pet=dog", targetURI(RequestMessage(r)))
+}
+
+func TestTargetURITLS(t *testing.T) {
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(
+		"POST /foo HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	assert.Nil(t, err)
+	r.TLS = &tls.ConnectionState{}
+
+	assert.Equal(t, "https://example.com/foo", targetURI(RequestMessage(r)))
+}
+
+func TestTargetURIOverride(t *testing.T) {
+	signer := NewSigner(AlgorithmHmacSha256, "@target-uri", "@scheme", "@authority")
+	signer.Format = FormatRFC9421
+	client, err := http.NewRequest(http.MethodGet, "https://api.example.com/foo?a=b", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, signer.SignRequest(client, testKeyID, testKey))
+
+	// plaintext request from a TLS terminating proxy
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(
+		"GET /foo?a=b HTTP/1.1\r\nHost: backend.internal\r\n\r\n")))
+	assert.Nil(t, err)
+	r.Header = client.Header
+	assert.Equal(t, "http://backend.internal/foo?a=b", targetURI(RequestMessage(r)))
+
+	v := NewVerifier(keyLookUp, -1)
+	_, err = v.Verify(r)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	v.Target = func(r *http.Request) (*url.URL, error) {
+		return &url.URL{Scheme: "https", Host: "api.example.com", Path: r.URL.Path, RawQuery: r.URL.RawQuery}, nil
+	}
+	_, err = v.Verify(r)
+	assert.Nil(t, err)
+}
+
+func TestRFC9421BadHost(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	r.Host = "%zz"
+	r.Header.Set("Signature-Input", `sig1=("@authority" "@scheme" "@target-uri");created=1618884473;keyid="Test";alg="hmac-sha256"`)
+	r.Header.Set("Signature", "sig1=:dGVzdA==:")
+
+	value, err := componentValue(RequestMessage(r), "@authority", requestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "%zz", value)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.ValidateTimestamps = false
+	ok, err := v.VerifyRequest(r)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestTargetURIClientRequest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "https://example.com/", targetURI(RequestMessage(r)))
+}
+
+func rfc9421Signer() *Signer {
+	signer := NewSigner(AlgorithmHmacSha256, "@method", "@authority", "@path", "content-type")
+	signer.Format = FormatRFC9421
+	return signer
+}
+
+func rfc9421Request(t *testing.T) *http.Request {
+	r, err := http.NewRequest(http.MethodPost, "http://Example.com/foo?param=value", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestRFC9421SignAndVerify(t *testing.T) {
+	r := rfc9421Request(t)
+	err := rfc9421Signer().SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	assert.True(t, strings.HasPrefix(r.Header.Get("Signature-Input"), `sig1=("@method" "@authority" "@path" "content-type");created=`))
+	assert.True(t, strings.HasSuffix(r.Header.Get("Signature-Input"), `;keyid="Test";alg="hmac-sha256"`))
+	assert.True(t, strings.HasPrefix(r.Header.Get("Signature"), "sig1=:"))
+
+	ok, err := VerifyRequest(r, keyLookUp, -1, "@method", "@path")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	sig := SignatureParameters{}
+	err = sig.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testKeyID, sig.KeyID)
+	assert.Equal(t, AlgorithmHmacSha256, sig.Algorithm.Name)
+	assert.Equal(t, []string{"@method", "@authority", "@path", "content-type"}, sig.Headers.Names())
+}
+
+func TestRFC9421Digest(t *testing.T) {
+	for _, headers := range [][]string{
+		{"@method", "@path"},
+		{"@method", "@path", "content-digest"},
+	} {
+		r := rfc9421Request(t)
+		signer := NewSignerWithOptions(testKeyID, nil, AlgorithmHmacSha256, WithHeaders(headers...), WithDigest())
+		signer.Format = FormatRFC9421
+		err := signer.SignRequest(r, testKeyID, testKey)
+		assert.Nil(t, err)
+
+		assert.Equal(t, testBodyContentDigest, r.Header.Get("Content-Digest"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Signature-Input"), `sig1=("@method" "@path" "content-digest");`))
+
+		v := NewVerifier(keyLookUp, -1, "content-digest")
+		v.CheckDigest = true
+		ok, err := v.VerifyRequest(r)
+		assert.True(t, ok)
+		assert.Nil(t, err)
+	}
+}
+
+func TestRFC9421SignatureBase(t *testing.T) {
+	r := rfc9421Request(t)
+	sig := SignatureParameters{
+		Headers:        HeaderList{{Name: "@method"}, {Name: "@authority"}, {Name: "@path"}, {Name: "@query"}, {Name: "content-type"}},
+		signatureInput: `("@method" "@authority" "@path" "@query" "content-type");created=1618884473;keyid="Test"`,
+	}
+	errs := sig.loadComponents(RequestMessage(r), requestOptions{})
+	assert.Empty(t, errs)
+	assert.Equal(t, `"@method": POST
+"@authority": example.com
+"@path": /foo
+"@query": ?param=value
+"content-type": application/json
+"@signature-params": ("@method" "@authority" "@path" "@query" "content-type");created=1618884473;keyid="Test"`, sig.signatureBase())
+}
+
+func TestRFC9421TamperedRequest(t *testing.T) {
+	r := rfc9421Request(t)
+	err := rfc9421Signer().SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	r.Method = http.MethodPut
+	_, err = VerifyRequest(r, keyLookUp, -1)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestRFC9421MissingComponent(t *testing.T) {
+	r := rfc9421Request(t)
+	err := rfc9421Signer().SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	r.Header.Del("Content-Type")
+	_, err = VerifyRequest(r, keyLookUp, -1)
+	assert.ErrorIs(t, err, ErrMissingRequiredHeader)
+}
+
+func TestRFC9421UnsupportedComponent(t *testing.T) {
+	signer := NewSigner(AlgorithmHmacSha256, "@status")
+	signer.Format = FormatRFC9421
+	err := signer.SignRequest(rfc9421Request(t), testKeyID, testKey)
+	assert.ErrorIs(t, err, ErrUnsupportedComponent)
+}
+
+func TestRFC9421QueryParam(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/path?var=this%20is%20a%20big%0Avalue&bar=with+plus+whitespace&fa%C3%A7ade%22%3A%20=something&qux=", nil)
+	assert.Nil(t, err)
+	signer := NewSigner(AlgorithmHmacSha256, "@method", "@Query-Param;name=var", `@query-param;name="bar"`, `@query-param;name="fa%C3%A7ade%22%3A%20"`, "@query-param;name=qux")
+	signer.Format = FormatRFC9421
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(r.Header.Get("Signature-Input"), `sig1=("@method" "@query-param";name="var" "@query-param";name="bar" "@query-param";name="fa%C3%A7ade%22%3A%20" "@query-param";name="qux");created=`))
+
+	ok, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	sig := SignatureParameters{}
+	assert.Nil(t, sig.FromRequest(r))
+	assert.Nil(t, sig.ParseRequest(r))
+	assert.True(t, strings.HasPrefix(sig.signatureBase(), `"@method": GET
+"@query-param";name="var": this%20is%20a%20big%0Avalue
+"@query-param";name="bar": with%20plus%20whitespace
+"@query-param";name="fa%C3%A7ade%22%3A%20": something
+"@query-param";name="qux": 
+"@signature-params": ("@method" "@query-param";name="var"`))
+
+	r.URL.RawQuery = strings.Replace(r.URL.RawQuery, "var=this", "var=that", 1)
+	_, err = VerifyRequest(r, keyLookUp, -1)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestRFC9421QueryParamMissing(t *testing.T) {
+	signer := NewSigner(AlgorithmHmacSha256, "@query-param;name=pet")
+	signer.Format = FormatRFC9421
+	err := signer.SignRequest(rfc9421Request(t), testKeyID, testKey)
+	assert.ErrorIs(t, err, ErrMissingRequiredHeader)
+
+	signer = NewSigner(AlgorithmHmacSha256, "@query-param")
+	signer.Format = FormatRFC9421
+	err = signer.SignRequest(rfc9421Request(t), testKeyID, testKey)
+	assert.ErrorIs(t, err, ErrUnsupportedComponent)
+}
+
+func TestRFC9421QueryParamRepeated(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/?pet=dog&pet=cat", nil)
+	assert.Nil(t, err)
+	signer := NewSigner(AlgorithmHmacSha256, "@query-param;name=pet")
+	signer.Format = FormatRFC9421
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.ErrorIs(t, err, ErrRepeatedQueryParameter)
+}
+
+func TestRFC9421Authorization(t *testing.T) {
+	r := rfc9421Request(t)
+	err := rfc9421Signer().AuthRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "", r.Header.Get("Authorization"))
+
+	_, err = VerifyRequest(r, keyLookUp, -1)
+	assert.Nil(t, err)
+}
+
+func TestRFC9421Label(t *testing.T) {
+	r := rfc9421Request(t)
+	signer := rfc9421Signer()
+	signer.Label = "proxy"
+	err := signer.SignRequest(r, "Other", testKey)
+	assert.Nil(t, err)
+	err = rfc9421Signer().SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	sig, err := v.VerifyAny(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "Other", sig.KeyID)
+
+	v.SignatureLabel = "sig1"
+	sig, err = v.VerifyAny(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testKeyID, sig.KeyID)
+
+	v.SignatureLabel = "sig2"
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrNoSignatureHeader)
+}
+
+func TestRFC9421Format(t *testing.T) {
+	r := rfc9421Request(t)
+	err := rfc9421Signer().SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Format = FormatCavage
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrMalformedSignatureHeader)
+
+	// a draft-cavage signature is not accepted in RFC 9421 mode
+	r = rfc9421Request(t)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v.Format = FormatRFC9421
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrNoSignatureHeader)
+
+	v.Format = FormatAuto
+	_, err = v.VerifyRequest(r)
+	assert.Nil(t, err)
+}
+
+func TestRFC9421MalformedSignatureInput(t *testing.T) {
+	for _, input := range []string{
+		`sig1`,
+		`sig1=("@method"`,
+		`sig1=("@method" "@path";keyid="Test"`,
+		`sig1=(@method);keyid="Test"`,
+		`sig1=("@method");created=soon;keyid="Test"`,
+		`sig1=("@method");keyid="Test",`,
+		`Sig1=("@method");keyid="Test"`,
+	} {
+		r := rfc9421Request(t)
+		r.Header.Set("Signature-Input", input)
+		r.Header.Set("Signature", "sig1=:dGVzdA==:")
+		_, err := VerifyRequest(r, keyLookUp, -1)
+		assert.ErrorIs(t, err, ErrMalformedSignatureHeader, input)
+	}
+}
+
+func TestRFC9421SignatureInputParameters(t *testing.T) {
+	r := rfc9421Request(t)
+	r.Header.Set("Signature-Input", `sig1=("@method");created=1618884473;nonce="b3k2pp5k7z";tag="app";keyid="Test"`)
+	r.Header.Set("Signature", "sig1=:dGVzdA==:")
+
+	// without alg the algorithm is the one of the key
+	sig := SignatureParameters{}
+	err := sig.parseSignatureHeader(RequestMessage(r), requestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, algorithmHs2019, sig.Algorithm)
+
+	r.Header.Set("Signature-Input", `sig1=("@method");created=1618884473;nonce="b3k2pp5k7z";keyid="Test";alg="hmac-sha256"`)
+	err = sig.parseSignatureHeader(RequestMessage(r), requestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1618884473), sig.Created)
+	assert.Equal(t, `("@method");created=1618884473;nonce="b3k2pp5k7z";keyid="Test";alg="hmac-sha256"`, sig.signatureInput)
+
+	r.Header.Set("Signature", "other=:dGVzdA==:")
+	err = sig.parseSignatureHeader(RequestMessage(r), requestOptions{})
+	assert.ErrorIs(t, err, ErrMissingSignature)
+}
@@ -0,0 +1,188 @@
+package httpsignatures
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider returns the shared HMAC secret of a keyId, eg from a
+// secret manager. It reports an unknown keyID with an empty secret or an
+// error wrapping ErrUnknownKeyID.
+type SecretProvider interface {
+	Secret(keyID string) ([]byte, error)
+}
+
+// SecretFunc adapts a function to a SecretProvider
+type SecretFunc func(keyID string) ([]byte, error)
+
+// Secret returns f(keyID)
+func (f SecretFunc) Secret(keyID string) ([]byte, error) {
+	return f(keyID)
+}
+
+// Secrets is a KeySet of the HMAC secrets of a provider. The secret is
+// looked up for every request, so a rotated secret is used without
+// creating a new signer or verifier:
+//
+//	secrets := httpsignatures.NewSecrets(httpsignatures.NewFileSecrets("/etc/secrets"))
+//	signer := httpsignatures.NewSignerWithOptions("client", nil, httpsignatures.AlgorithmHmacSha256,
+//		httpsignatures.WithKeySet(secrets))
+//	handler := httpsignatures.RequireSignature(api, httpsignatures.WithKeyStore(secrets))
+type Secrets struct {
+	Provider SecretProvider
+	// Algorithm is the HMAC algorithm the secrets are bound to
+	Algorithm string
+}
+
+// NewSecrets creates a key set of the secrets of provider, bound to
+// hmac-sha256
+func NewSecrets(provider SecretProvider) *Secrets {
+	return &Secrets{Provider: provider, Algorithm: AlgorithmHmacSha256}
+}
+
+// LookUpKey returns the secret of keyID and the algorithm of the secrets
+func (s *Secrets) LookUpKey(keyID string) ([]byte, string, error) {
+	secret, err := s.Provider.Secret(keyID)
+	if err != nil || len(secret) == 0 {
+		return nil, "", err
+	}
+	return secret, s.Algorithm, nil
+}
+
+// LookUpKeys returns the secret of keyID, a provider has one secret per
+// keyId
+func (s *Secrets) LookUpKeys(keyID string) ([]StoredKey, error) {
+	secret, algorithm, err := s.LookUpKey(keyID)
+	if err != nil || len(secret) == 0 {
+		return nil, err
+	}
+	return []StoredKey{{Key: secret, Algorithm: algorithm}}, nil
+}
+
+// EnvSecrets loads base64 encoded secrets from environment variables named
+// Prefix followed by the keyId in upper case, with the characters other
+// than letters and digits replaced by "_". The secret of keyId
+// "billing-api" with Prefix "HTTPSIG_" is in HTTPSIG_BILLING_API.
+type EnvSecrets struct {
+	Prefix string
+}
+
+// Secret returns the secret of keyID from the environment
+func (e EnvSecrets) Secret(keyID string) ([]byte, error) {
+	value, ok := os.LookupEnv(e.Prefix + envName(keyID))
+	if !ok {
+		return nil, nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, ErrInvalidKeyEncoding
+	}
+	return secret, nil
+}
+
+// envName returns keyID in upper case, with the characters other than
+// letters and digits replaced by "_"
+func envName(keyID string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, keyID)
+}
+
+// FileSecrets loads secrets from the files in a directory, named after
+// their keyId, eg a mounted Kubernetes secret. A file is read again when
+// its modification time or size changes, so a secret which is rotated on
+// disk is picked up by the next request.
+type FileSecrets struct {
+	Dir string
+	// Base64 decodes the files from base64, otherwise a file holds the raw
+	// secret and a trailing newline is removed
+	Base64 bool
+
+	mu    sync.Mutex
+	cache map[string]fileSecret
+}
+
+type fileSecret struct {
+	modTime time.Time
+	size    int64
+	secret  []byte
+}
+
+// NewFileSecrets creates a provider of the raw secrets in the files of dir
+func NewFileSecrets(dir string) *FileSecrets {
+	return &FileSecrets{Dir: dir}
+}
+
+// Secret returns the secret of keyID, an empty secret when there is no
+// file for keyID
+func (f *FileSecrets) Secret(keyID string) ([]byte, error) {
+	// keyIDs are chosen by the client, they must not leave the directory
+	if keyID == "" || keyID == "." || keyID == ".." || strings.ContainsAny(keyID, `/\`) {
+		return nil, nil
+	}
+	path := filepath.Join(f.Dir, keyID)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cached, ok := f.cache[keyID]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.secret, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimRight(data, "\r\n")
+	if f.Base64 {
+		if secret, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err != nil {
+			return nil, ErrInvalidKeyEncoding
+		}
+	}
+	if f.cache == nil {
+		f.cache = map[string]fileSecret{}
+	}
+	f.cache[keyID] = fileSecret{modTime: info.ModTime(), size: info.Size(), secret: secret}
+	return secret, nil
+}
+
+// DerivedSecrets derives the secret of every keyId from a master secret,
+// as HMAC-SHA256(master, keyId), so a server can verify any number of
+// clients while storing a single secret. Each client is handed its own
+// derived secret, see DeriveSecret.
+type DerivedSecrets struct {
+	Master []byte
+}
+
+// Secret returns the secret derived for keyID
+func (d DerivedSecrets) Secret(keyID string) ([]byte, error) {
+	return DeriveSecret(d.Master, keyID), nil
+}
+
+// DeriveSecret returns the secret of keyID derived from master, see
+// DerivedSecrets
+func DeriveSecret(master []byte, keyID string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(keyID))
+	return mac.Sum(nil)
+}
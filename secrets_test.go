@@ -0,0 +1,130 @@
+package httpsignatures
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func secretsRequest(t *testing.T, signer *Signer) *http.Request {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	assert.Nil(t, signer.Sign(r))
+	return r
+}
+
+func TestFileSecretsReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, testKeyID)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("first secret\n"), 0600))
+
+	secrets := NewSecrets(NewFileSecrets(dir))
+	signer := NewSignerWithOptions(testKeyID, nil, AlgorithmHmacSha256, WithKeySet(secrets))
+	v := NewVerifier(nil, -1)
+	v.KeyStore = secrets
+
+	r := secretsRequest(t, signer)
+	ok, err := v.VerifyRequest(r)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	// rotate the secret on disk, a signature of the old secret fails
+	assert.Nil(t, ioutil.WriteFile(path, []byte("the second secret\n"), 0600))
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(path, later, later))
+	ok, err = v.VerifyRequest(r)
+	assert.False(t, ok)
+	assert.Equal(t, ErrSignatureMismatch, err)
+
+	ok, err = v.VerifyRequest(secretsRequest(t, signer))
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	secret, err := NewFileSecrets(dir).Secret(testKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("the second secret"), secret)
+}
+
+func TestFileSecretsUnknownKeyID(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600))
+	files := NewFileSecrets(filepath.Join(dir, "keys"))
+	for _, keyID := range []string{"missing", "../secret", "..", ""} {
+		secret, err := files.Secret(keyID)
+		assert.Nil(t, err)
+		assert.Empty(t, secret, keyID)
+	}
+
+	v := NewVerifier(nil, -1)
+	v.KeyStore = NewSecrets(files)
+	_, err := v.VerifyRequest(secretsRequest(t, NewSignerWithOptions("../secret", []byte("secret"), AlgorithmHmacSha256)))
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
+
+func TestFileSecretsBase64(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, testKeyID), []byte(base64.StdEncoding.EncodeToString([]byte("secret"))+"\n"), 0600))
+	files := NewFileSecrets(dir)
+	files.Base64 = true
+	secret, err := files.Secret(testKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), secret)
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("HTTPSIG_BILLING_API", base64.StdEncoding.EncodeToString([]byte("secret")))
+	t.Setenv("HTTPSIG_INVALID", "not base64!")
+	env := EnvSecrets{Prefix: "HTTPSIG_"}
+
+	secret, err := env.Secret("billing-api")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), secret)
+
+	secret, err = env.Secret("missing")
+	assert.Nil(t, err)
+	assert.Empty(t, secret)
+
+	_, err = env.Secret("invalid")
+	assert.Equal(t, ErrInvalidKeyEncoding, err)
+}
+
+func TestDerivedSecrets(t *testing.T) {
+	master := []byte("master secret")
+	client := NewSignerWithOptions(testKeyID, DeriveSecret(master, testKeyID), AlgorithmHmacSha256)
+	v := NewVerifier(nil, -1)
+	v.KeyStore = NewSecrets(DerivedSecrets{Master: master})
+
+	ok, err := v.VerifyRequest(secretsRequest(t, client))
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	// another client can't sign with its own secret as testKeyID
+	other := NewSignerWithOptions(testKeyID, DeriveSecret(master, "other"), AlgorithmHmacSha256)
+	ok, err = v.VerifyRequest(secretsRequest(t, other))
+	assert.False(t, ok)
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestSecretFunc(t *testing.T) {
+	secrets := NewSecrets(SecretFunc(func(keyID string) ([]byte, error) {
+		if keyID == testKeyID {
+			return []byte("secret"), nil
+		}
+		return nil, nil
+	}))
+
+	key, algorithm, err := secrets.LookUpKey(testKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), key)
+	assert.Equal(t, AlgorithmHmacSha256, algorithm)
+
+	keys, err := secrets.LookUpKeys("unknown")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
@@ -4,11 +4,14 @@ package httpsignatures
 
 import (
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type SignatureParameters struct {
@@ -16,46 +19,265 @@ type SignatureParameters struct {
 	Algorithm *Algorithm
 	Headers   HeaderList
 	Signature string
+	// Created and Expires are the created and expires parameters, as Unix
+	// timestamps, 0 when absent
+	Created int64
+	Expires int64
+
+	// signatureInput is the serialized Signature-Input member of an RFC 9421
+	// signature, empty for draft-cavage signatures
+	signatureInput string
 }
 
 const (
 	HeaderRequestTarget string = "(request-target)"
 	HeaderDate          string = "date"
 	HeaderHost          string = "host"
+	HeaderCreated       string = "(created)"
+	HeaderExpires       string = "(expires)"
 )
 
+// defaultAuthScheme is the scheme of an Authorization header carrying a
+// signature
+const defaultAuthScheme = "Signature"
+
+// requestOptions alter the way header values are read from a request
+type requestOptions struct {
+	// xPrefixAliases lists the headers for which the "X-" prefix is
+	// optional, eg "request-id" also matches "X-Request-Id" and vice versa
+	xPrefixAliases []string
+	// canonicalTarget normalizes the path of the (request-target)
+	canonicalTarget bool
+	// canonicalizers override CanonicalizeTrim per lowercase header name
+	canonicalizers map[string]Canonicalizer
+	// defaultHeaders are signed when the headers parameter is missing, nil
+	// means "date"
+	defaultHeaders []string
+	// requireHeadersParameter rejects signatures without headers parameter
+	requireHeadersParameter bool
+	// format restricts the accepted signature format
+	format SignatureFormat
+	// label selects the RFC 9421 signature, the first one when empty
+	label string
+	// authScheme is the scheme of the Authorization header, "Signature"
+	// when empty
+	authScheme string
+	// maxSignatures is the most signatures of a request which are parsed,
+	// DefaultMaxSignatures when 0 and any number when negative
+	maxSignatures int
+	// lenientTimestamps accepts RFC 3339 created and expires parameters
+	lenientTimestamps bool
+}
+
+// DefaultMaxSignatures is the most signatures of a request which are parsed
+// and verified, eg one of the client and a few of gateways
+const DefaultMaxSignatures = 5
+
+// checkSignatureCount fails with ErrTooManySignatures when a request carries
+// more than maxSignatures signatures
+func (o requestOptions) checkSignatureCount(n int) error {
+	limit := o.maxSignatures
+	if limit == 0 {
+		limit = DefaultMaxSignatures
+	}
+	if limit > 0 && n > limit {
+		return ErrTooManySignatures
+	}
+	return nil
+}
+
 // FromRequest takes the signature string from the HTTP-Request
 // both Signature and Authorization http headers are supported.
 func (s *SignatureParameters) FromRequest(r *http.Request) error {
+	return s.fromMessage(RequestMessage(r), requestOptions{})
+}
+
+func (s *SignatureParameters) fromMessage(m Message, opts requestOptions) error {
+	if err := s.parseSignatureHeader(m, opts); err != nil {
+		return err
+	}
+	if err := s.parseMessage(m, opts); err != nil {
+		return err
+	}
+
+	// todo: check if all required headers are available
+	return nil
+}
+
+// SignaturesFromRequest parses every Signature header of the request, eg
+// one added by the client and one by a gateway, in the order of the headers.
+// The Authorization header only carries a single signature, it is used when
+// there is no Signature header. Requests carrying more than
+// DefaultMaxSignatures fail with ErrTooManySignatures.
+func SignaturesFromRequest(r *http.Request) ([]SignatureParameters, error) {
+	return signaturesFromMessage(RequestMessage(r), requestOptions{})
+}
+
+func signaturesFromMessage(m Message, opts requestOptions) ([]SignatureParameters, error) {
+	if opts.format != FormatCavage && len(m.Header(HeaderSignatureInput)) > 0 {
+		return rfc9421SignaturesFromMessage(m, opts)
+	}
+
+	values := m.Header("Signature")
+	if err := opts.checkSignatureCount(len(values)); err != nil {
+		return nil, err
+	}
+	if len(values) < 2 {
+		s := SignatureParameters{}
+		if err := s.fromMessage(m, opts); err != nil {
+			return nil, err
+		}
+		return []SignatureParameters{s}, nil
+	}
+
+	signatures := make([]SignatureParameters, len(values))
+	for i, value := range values {
+		if err := signatures[i].parseSignatureString(value, opts); err != nil {
+			return nil, err
+		}
+		if err := signatures[i].parseMessage(m, opts); err != nil {
+			return nil, err
+		}
+	}
+	return signatures, nil
+}
+
+// parseSignatureHeader parses the signature parameters from the Signature
+// or Authorization header, without loading the signed header values
+func (s *SignatureParameters) parseSignatureHeader(m Message, opts requestOptions) error {
+	if opts.format != FormatCavage && len(m.Header(HeaderSignatureInput)) > 0 {
+		return s.parseRFC9421(m, opts.label)
+	}
+	if opts.format == FormatRFC9421 {
+		return ErrNoSignatureHeader
+	}
+
 	var httpSignatureString string
-	if sig, ok := r.Header["Signature"]; ok {
+	if sig := m.Header("Signature"); len(sig) > 0 {
 		httpSignatureString = sig[0]
 	} else {
-		if h, ok := r.Header["Authorization"]; ok {
-			httpSignatureString = strings.TrimPrefix(h[0], "Signature ")
-		} else {
-			return errors.New(ErrorNoSignatureHeaderFoundInRequest)
+		h := m.Header("Authorization")
+		if len(h) == 0 {
+			return ErrNoSignatureHeader
+		}
+		var hasScheme bool
+		if httpSignatureString, hasScheme = trimAuthScheme(h[0], opts.authScheme); !hasScheme {
+			return ErrNoSignatureHeader
 		}
 	}
-	if err := s.parseSignatureString(httpSignatureString); err != nil {
-		return err
+	return s.parseSignatureString(httpSignatureString, opts)
+}
+
+// trimAuthScheme returns the parameters of the Authorization header value
+// and whether it uses scheme, which is case insensitive. Without scheme the
+// "Signature" scheme is removed when present, and the value is taken as is
+// otherwise.
+func trimAuthScheme(value string, scheme string) (string, bool) {
+	lenient := scheme == ""
+	if lenient {
+		scheme = defaultAuthScheme
 	}
-	if err := s.ParseRequest(r); err != nil {
-		return err
+	if len(value) <= len(scheme) || !strings.EqualFold(value[:len(scheme)], scheme) || value[len(scheme)] != ' ' {
+		return value, lenient
 	}
+	return strings.TrimLeft(value[len(scheme):], " "), true
+}
 
-	// todo: check if all required headers are available
-	return nil
+// requestHost returns the host of a request: r.Host, which is what a client
+// sends and what a server received, or r.URL.Host for a request built
+// without it
+func requestHost(r *http.Request) string {
+	if host := strings.TrimSpace(r.Host); host != "" {
+		return host
+	}
+	if r.URL != nil {
+		return strings.TrimSpace(r.URL.Host)
+	}
+	return ""
+}
+
+// SignableComponents returns the headers and components which can be
+// signed for the request: the available draft-cavage pseudo-headers,
+// (request-target) and (created), and host, then the available RFC 9421
+// derived components, eg "@method", "@path" and an "@query-param;name=..."
+// per query parameter, followed by the lowercase names of the headers
+// present on the request in alphabetical order. The pseudo-headers in
+// parentheses are draft-cavage only, the "@" components RFC 9421 only.
+// (expires) is left out, it needs Signer.ExpiresIn, which covers it
+// already. The Signature, Signature-Input and Authorization headers carry
+// the signature itself and are left out, like the hop-by-hop headers the
+// signer refuses.
+func SignableComponents(r *http.Request) []string {
+	m := RequestMessage(r)
+	components := []string{}
+	if _, err := requestTargetLine(m, requestOptions{}); err == nil {
+		components = append(components, HeaderRequestTarget)
+	}
+	// the signer sets the created parameter
+	components = append(components, HeaderCreated)
+	if requestHost(r) != "" {
+		components = append(components, HeaderHost)
+	}
+
+	derived := append(append([]string{}, derivedComponents...), queryParamComponents(m)...)
+	for _, component := range derived {
+		if _, err := componentValue(m, component, requestOptions{}); err == nil {
+			components = append(components, component)
+		}
+	}
+
+	headers := []string{}
+	for header := range r.Header {
+		header = strings.ToLower(header)
+		if header != "signature" && header != HeaderSignatureInput && header != "authorization" && checkHeaderName(header) == nil {
+			headers = append(headers, header)
+		}
+	}
+	sort.Strings(headers)
+
+	return append(components, headers...)
+}
+
+// StripSignature removes all signatures from the request, eg before a
+// verified request is forwarded to a backend. The Signature and
+// Signature-Input headers and Authorization headers using the Signature
+// scheme are removed, other Authorization headers are kept. Use
+// Verifier.StripSignature for a verifier with another AuthScheme.
+func StripSignature(r *http.Request) {
+	stripSignature(r, "")
+}
+
+// stripSignature removes the signature headers and the Authorization
+// headers using scheme, "Signature" when empty, from the request, see
+// StripSignature
+func stripSignature(r *http.Request, scheme string) {
+	if scheme == "" {
+		scheme = defaultAuthScheme
+	}
+	r.Header.Del("Signature")
+	r.Header.Del(HeaderSignatureInput)
+
+	var kept []string
+	for _, value := range r.Header["Authorization"] {
+		if _, hasScheme := trimAuthScheme(value, scheme); !hasScheme {
+			kept = append(kept, value)
+		}
+	}
+	if len(kept) == 0 {
+		r.Header.Del("Authorization")
+	} else {
+		r.Header["Authorization"] = kept
+	}
 }
 
 // FromConfig takes the string configuration and fills the
 // SignatureParameters struct
 func (s *SignatureParameters) FromConfig(keyId string, algorithm string, headers []string) error {
 	if len(keyId) == 0 {
-		return errors.New(ErrorNoKeyIDConfigured)
+		return ErrNoKeyIDConfigured
 	}
 	if len(algorithm) == 0 {
-		return errors.New(ErrorNoAlgorithmConfigured)
+		return ErrNoAlgorithmConfigured
 	}
 	s.KeyID = keyId
 
@@ -66,11 +288,11 @@ func (s *SignatureParameters) FromConfig(keyId string, algorithm string, headers
 	s.Algorithm = alg
 
 	if len(headers) == 0 {
-		s.Headers = HeaderList{"date": ""}
+		s.Headers = HeaderList{{Name: "date"}}
 	} else {
 		s.Headers = HeaderList{}
 		for _, header := range headers {
-			s.Headers[header] = ""
+			s.Headers = append(s.Headers, HeaderField{Name: componentName(header)})
 		}
 	}
 
@@ -80,138 +302,465 @@ func (s *SignatureParameters) FromConfig(keyId string, algorithm string, headers
 // ParseRequest extracts the header fields from the request required
 // by the `headers` parameter in the configuration
 func (s *SignatureParameters) ParseRequest(r *http.Request) error {
+	return s.parseMessage(RequestMessage(r), requestOptions{})
+}
+
+func (s *SignatureParameters) parseMessage(m Message, opts requestOptions) error {
+	if errs := s.loadHeaders(m, opts); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// loadHeaders fills in the values of all headers from the message and
+// returns an error for every header which could not be loaded
+func (s *SignatureParameters) loadHeaders(m Message, opts requestOptions) []error {
 	if len(s.Headers) == 0 {
-		return errors.New(ErrorNoHeadersConfigLoaded)
+		return []error{ErrNoHeadersConfigLoaded}
+	}
+	if s.signatureInput != "" {
+		return s.loadComponents(m, opts)
 	}
-	for header := range s.Headers {
-		switch header {
+	var errs []error
+	for i, header := range s.Headers {
+		switch header.Name {
 		case "(request-target)":
-			if tl, err := requestTargetLine(r); err == nil {
-				s.Headers[header] = strings.TrimSpace(tl)
+			if tl, err := requestTargetLine(m, opts); err == nil {
+				s.Headers[i].Value = strings.TrimSpace(tl)
 			} else {
-				return err
+				errs = append(errs, err)
+			}
+		case "(created)":
+			if s.Created != 0 {
+				s.Headers[i].Value = strconv.FormatInt(s.Created, 10)
+			} else {
+				errs = append(errs, ErrMissingCreated)
+			}
+		case "(expires)":
+			if s.Expires != 0 {
+				s.Headers[i].Value = strconv.FormatInt(s.Expires, 10)
+			} else {
+				errs = append(errs, ErrMissingExpires)
 			}
 		case "host":
-			if host := r.URL.Host; host != "" {
-				s.Headers[header] = strings.TrimSpace(host)
+			if host := messageHost(m); host != "" {
+				s.Headers[i].Value = host
 			} else {
-				return errors.New(ErrorMissingRequiredHeader + " 'host'")
+				errs = append(errs, &MissingHeaderError{Header: "host"})
 			}
 		default:
-			// If there are multiple headers with the same name, add them all.
-			if len(r.Header[http.CanonicalHeaderKey(header)]) > 0 {
-				var trimmedValues []string
-				for _, value := range r.Header[http.CanonicalHeaderKey(header)] {
-					trimmedValues = append(trimmedValues, strings.TrimSpace(value))
-				}
-				s.Headers[header] = strings.Join(trimmedValues, ", ")
+			if err := checkHeaderName(header.Name); err != nil {
+				errs = append(errs, err)
+			} else if value, ok := headerValue(m, header.Name, opts); ok {
+				s.Headers[i].Value = value
 			} else {
-				return fmt.Errorf("%s '%s'", ErrorMissingRequiredHeader, header)
+				errs = append(errs, &MissingHeaderError{Header: header.Name})
 			}
 		}
 	}
+	return errs
+}
+
+// hopByHopHeaders are consumed or rewritten by proxies and by net/http,
+// the value the verifier sees can differ from the one the client signed
+var hopByHopHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"te":                true,
+	"trailer":           true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// checkHeaderName refuses to sign or verify a header which could be spoofed:
+// a name in parentheses which isn't a known pseudo-header, which could be
+// confused with one, and hop-by-hop headers
+func checkHeaderName(header string) error {
+	if strings.HasPrefix(header, "(") {
+		return fmt.Errorf("%w '%s'", ErrUnknownPseudoHeader, header)
+	}
+	if hopByHopHeaders[strings.ToLower(header)] {
+		return fmt.Errorf("%w '%s'", ErrHopByHopHeader, header)
+	}
 	return nil
 }
 
+// headerValue returns the canonicalized value of header, and false when the
+// message doesn't have the header
+func headerValue(m Message, header string, opts requestOptions) (string, bool) {
+	values := m.Header(header)
+	if len(values) == 0 && opts.isXPrefixAlias(header) {
+		values = m.Header(xPrefixAlias(header))
+	}
+	if len(values) == 0 {
+		return "", false
+	}
+	// If there are multiple headers with the same name, add them all, by
+	// default trimmed and joined with ", " as the spec requires.
+	return opts.canonicalizer(header)(values), true
+}
+
+// defaultHeaderList returns the headers signed when the headers parameter
+// is missing
+func (o requestOptions) defaultHeaderList() HeaderList {
+	if o.defaultHeaders == nil {
+		return HeaderList{{Name: HeaderDate}}
+	}
+	headers := HeaderList{}
+	for _, header := range o.defaultHeaders {
+		headers = append(headers, HeaderField{Name: strings.ToLower(header)})
+	}
+	return headers
+}
+
+func (o requestOptions) canonicalizer(header string) Canonicalizer {
+	if canonicalize, ok := o.canonicalizers[strings.ToLower(header)]; ok {
+		return canonicalize
+	}
+	return CanonicalizeTrim
+}
+
+func (o requestOptions) isXPrefixAlias(header string) bool {
+	name := strings.TrimPrefix(strings.ToLower(header), "x-")
+	for _, alias := range o.xPrefixAliases {
+		if strings.TrimPrefix(strings.ToLower(alias), "x-") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// xPrefixAlias adds the "X-" prefix to header, or strips it when present
+func xPrefixAlias(header string) string {
+	if strings.HasPrefix(strings.ToLower(header), "x-") {
+		return header[2:]
+	}
+	return "x-" + header
+}
+
+// escapeQuoted escapes quotes and backslashes in a parameter value
+func escapeQuoted(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// parseSignatureParameters scans the encoded signature parameters and calls
+// fn with the name and value of each, in order. Parameters are separated by
+// commas, values are either quoted, with quotes and backslashes inside the
+// value escaped with a backslash, or integers, like created=1402170695.
+// Whitespace is allowed around the commas and equals signs, anything else
+// between the parameters makes the header malformed. Values without escapes
+// are substrings of in, a well-formed header is scanned without allocating.
+func parseSignatureParameters(in string, fn func(name, value string, quoted bool) error) error {
+	i := skipWhitespace(in, 0)
+	if i == len(in) {
+		return nil
+	}
+	for {
+		start := i
+		for i < len(in) && isParameterNameChar(in[i]) {
+			i++
+		}
+		name := in[start:i]
+		if name == "" {
+			return ErrMalformedSignatureHeader
+		}
+
+		i = skipWhitespace(in, i)
+		if i == len(in) || in[i] != '=' {
+			return ErrMalformedSignatureHeader
+		}
+		i = skipWhitespace(in, i+1)
+
+		var value string
+		quoted := i < len(in) && in[i] == '"'
+		if quoted {
+			var err error
+			if value, i, err = scanQuoted(in, i+1); err != nil {
+				return err
+			}
+		} else {
+			start = i
+			for i < len(in) && in[i] >= '0' && in[i] <= '9' {
+				i++
+			}
+			if start == i {
+				return ErrMalformedSignatureHeader
+			}
+			value = in[start:i]
+		}
+		if err := fn(name, value, quoted); err != nil {
+			return err
+		}
+
+		i = skipWhitespace(in, i)
+		if i == len(in) {
+			return nil
+		}
+		if in[i] != ',' {
+			return ErrMalformedSignatureHeader
+		}
+		i = skipWhitespace(in, i+1)
+	}
+}
+
+// scanQuoted returns the unescaped quoted value starting at i, just after
+// the opening quote, and the index after the closing quote
+func scanQuoted(in string, i int) (string, int, error) {
+	start := i
+	for ; i < len(in); i++ {
+		switch in[i] {
+		case '"':
+			return in[start:i], i + 1, nil
+		case '\\':
+			return unescapeQuoted(in, start)
+		}
+	}
+	// unterminated quoted value
+	return "", 0, ErrMalformedSignatureHeader
+}
+
+// unescapeQuoted is the slow path of scanQuoted for values with escapes
+func unescapeQuoted(in string, i int) (string, int, error) {
+	var b strings.Builder
+	for ; i < len(in); i++ {
+		switch in[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(in) {
+				return "", 0, ErrMalformedSignatureHeader
+			}
+		}
+		b.WriteByte(in[i])
+	}
+	return "", 0, ErrMalformedSignatureHeader
+}
+
+func isParameterNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// parseTimestamp parses the value of the created or expires parameter, a
+// Unix timestamp, or an RFC 3339 date-time when lenient
+func parseTimestamp(value string, lenient bool) (int64, error) {
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err == nil || !lenient {
+		return timestamp, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// skipWhitespace returns the index of the first non whitespace character in
+// in from i on, the header may be folded over several lines
+func skipWhitespace(in string, i int) int {
+	for i < len(in) && strings.IndexByte(" \t\r\n", in[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
 // FromString creates a new Signature from its encoded form,
 // eg `keyId="a",algorithm="b",headers="c",signature="d"`
-func (s *SignatureParameters) parseSignatureString(in string) error {
-	var key, value string
+func (s *SignatureParameters) parseSignatureString(in string, opts requestOptions) error {
 	*s = SignatureParameters{}
-	signatureRegex := regexp.MustCompile(`(\w+)="([^"]*)"`)
-
-	for _, m := range signatureRegex.FindAllStringSubmatch(in, -1) {
-		key = m[1]
-		value = m[2]
+	// seen holds a bit per known parameter, a parameter given twice makes
+	// the signature ambiguous
+	var seen uint
+	err := parseSignatureParameters(in, func(key, value string, quoted bool) error {
+		bit, ok := signatureParameterBits[key]
+		if !ok {
+			// ignore unknown parameters
+			return nil
+		}
+		if seen&bit != 0 {
+			return fmt.Errorf("%w '%s'", ErrDuplicateSignatureParameter, key)
+		}
+		seen |= bit
+		// created and expires are integers, the others quoted strings.
+		// Lenient timestamps may be quoted date-times.
+		isTimestamp := key == "created" || key == "expires"
+		if quoted == isTimestamp && !(isTimestamp && opts.lenientTimestamps) {
+			return fmt.Errorf("%w '%s'", ErrInvalidSignatureParameter, key)
+		}
 
-		if key == "keyId" {
+		switch key {
+		case "keyId":
 			s.KeyID = value
-		} else if key == "algorithm" {
+		case "algorithm":
 			alg, err := algorithmFromString(value)
 			if err != nil {
 				return err
 			}
 			s.Algorithm = alg
-		} else if key == "headers" {
+		case "headers":
 			s.Headers.ParseString(value)
-		} else if key == "signature" {
+		case "signature":
 			s.Signature = value
+		case "created", "expires":
+			timestamp, err := parseTimestamp(value, opts.lenientTimestamps)
+			if err != nil {
+				return fmt.Errorf("%w '%s'", ErrInvalidSignatureParameter, key)
+			}
+			if key == "created" {
+				s.Created = timestamp
+			} else {
+				s.Expires = timestamp
+			}
 		}
-		// ignore unknown parameters
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	if len(s.Headers) == 0 {
-		s.Headers = HeaderList{"date": ""}
+		if opts.requireHeadersParameter {
+			return ErrMissingHeaders
+		}
+		s.Headers = opts.defaultHeaderList()
 	}
 
 	if len(s.Signature) == 0 {
-		return errors.New(ErrorMissingSignatureParameterSignature)
+		return ErrMissingSignature
 	}
 
 	if len(s.KeyID) == 0 {
-		return errors.New(ErrorMissingSignatureParameterKeyId)
+		return ErrMissingKeyID
 	}
 
 	if s.Algorithm == nil {
-		return errors.New(ErrorMissingSignatureParameterAlgorithm)
+		return ErrMissingAlgorithm
 	}
 
 	return nil
 }
 
-// String returns the encoded form of the Signature
+// signatureParameterBits numbers the known signature parameters for the
+// duplicate check of parseSignatureString
+var signatureParameterBits = map[string]uint{
+	"keyId":     1 << 0,
+	"algorithm": 1 << 1,
+	"headers":   1 << 2,
+	"signature": 1 << 3,
+	"created":   1 << 4,
+	"expires":   1 << 5,
+}
+
+// hTTPSignatureString returns the encoded form of the Signature. The
+// parameters are always emitted in the same canonical order, some verifiers
+// depend on it:
+//
+//	keyId, algorithm, created, expires, headers, signature
 func (s SignatureParameters) hTTPSignatureString(signature string) string {
-	str := fmt.Sprintf(
-		`keyId="%s",algorithm="%s"`,
-		s.KeyID,
-		s.Algorithm.Name,
-	)
+	params := []string{
+		fmt.Sprintf(`keyId="%s"`, escapeQuoted(s.KeyID)),
+		fmt.Sprintf(`algorithm="%s"`, s.Algorithm.Name),
+	}
+
+	if s.Created != 0 {
+		params = append(params, fmt.Sprintf(`created=%d`, s.Created))
+	}
+	if s.Expires != 0 {
+		params = append(params, fmt.Sprintf(`expires=%d`, s.Expires))
+	}
 
 	if len(s.Headers) > 0 {
-		str += fmt.Sprintf(`,headers="%s"`, s.Headers.toHeadersString())
+		params = append(params, fmt.Sprintf(`headers="%s"`, escapeQuoted(s.Headers.toHeadersString())))
 	}
 
-	str += fmt.Sprintf(`,signature="%s"`, signature)
+	params = append(params, fmt.Sprintf(`signature="%s"`, escapeQuoted(signature)))
 
-	return str
+	return strings.Join(params, ",")
+}
+
+// Covers reports whether the signature covers every header, compared case
+// insensitively, eg to require after verifying that a signature covers
+// "(request-target)", "host" and "digest"
+func (s SignatureParameters) Covers(headers ...string) bool {
+	for _, header := range headers {
+		if _, ok := s.Headers.Get(header); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// signedCreated reports whether the signature carries a created parameter
+// which is signed: the signature parameters of RFC 9421 are always signed,
+// draft-cavage signatures only sign it when they cover (created)
+func (s SignatureParameters) signedCreated() bool {
+	return s.Created != 0 && (s.signatureInput != "" || s.Covers(HeaderCreated))
 }
 
 func (s SignatureParameters) calculateSignature(keyB64 string) (string, error) {
-	signingString, err := s.Headers.signingString()
+	byteKey, err := base64.StdEncoding.DecodeString(keyB64)
 	if err != nil {
 		return "", err
 	}
-	byteKey, err := base64.StdEncoding.DecodeString(keyB64)
+	return s.calculateSignatureKey(byteKey)
+}
+
+func (s SignatureParameters) calculateSignatureKey(key []byte) (string, error) {
+	return s.calculateSignatureWith(keySignFunc(key))
+}
+
+func (s SignatureParameters) calculateSignatureWith(sign signFunc) (string, error) {
+	signingString, err := s.signingString()
 	if err != nil {
 		return "", err
 	}
 
-	signature, err := s.Algorithm.Sign(&byteKey, []byte(signingString))
+	signature, err := sign(s.Algorithm, []byte(signingString))
 	if err != nil {
 		return "", err
 	}
 
-	return base64.StdEncoding.EncodeToString(*signature), err
+	return base64.StdEncoding.EncodeToString(signature), err
+}
+
+// signFunc signs the message with the algorithm, eg with a raw key or with a
+// crypto.Signer
+type signFunc func(alg *Algorithm, message []byte) ([]byte, error)
+
+func keySignFunc(key []byte) signFunc {
+	return func(alg *Algorithm, message []byte) ([]byte, error) {
+		signature, err := alg.Sign(&key, message)
+		if err != nil {
+			return nil, err
+		}
+		return *signature, nil
+	}
 }
 
 // Verify verifies this signature for the given base64 encodedkey
 func (s SignatureParameters) Verify(keyBase64 string) (bool, error) {
-	signingString, err := s.Headers.signingString()
+	byteKey, err := base64.StdEncoding.DecodeString(keyBase64)
 	if err != nil {
 		return false, err
 	}
+	return s.VerifyKey(byteKey)
+}
 
-	byteKey, err := base64.StdEncoding.DecodeString(keyBase64)
+// VerifyKey verifies this signature for the given raw key, see KeyBytes for
+// parsed keys
+func (s SignatureParameters) VerifyKey(key []byte) (bool, error) {
+	signingString, err := s.signingString()
 	if err != nil {
 		return false, err
 	}
 
 	byteSignature, err := base64.StdEncoding.DecodeString(s.Signature)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("%w 'signature'", ErrInvalidSignatureParameter)
 	}
 
-	result, err := s.Algorithm.Verify(&byteKey, []byte(signingString), &byteSignature)
+	result, err := s.Algorithm.Verify(&key, []byte(signingString), &byteSignature)
 	if err != nil {
 		return false, err
 	}
@@ -219,56 +768,124 @@ func (s SignatureParameters) Verify(keyBase64 string) (bool, error) {
 	return result, nil
 }
 
-// HeaderList contains headers
-type HeaderList map[string]string
+// HeaderField is a signed header with its value
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// HeaderList contains the signed headers. The order matters: the signing
+// string lists the headers in the order of the `headers` parameter.
+type HeaderList []HeaderField
 
 // ParseString constructs a headerlist from the 'headers' string
 func (h *HeaderList) ParseString(list string) {
-	*h = HeaderList{}
-	list = strings.TrimSpace(list)
-	headers := strings.Split(strings.ToLower(string(list)), " ")
-	for _, header := range headers {
-		// init header map with empty string
-		(*h)[header] = ""
+	*h = make(HeaderList, 0, strings.Count(list, " ")+1)
+	for i := 0; i < len(list); {
+		i = skipWhitespace(list, i)
+		start := i
+		for i < len(list) && strings.IndexByte(" \t\r\n", list[i]) < 0 {
+			i++
+		}
+		if start < i {
+			// init header with empty value
+			*h = append(*h, HeaderField{Name: strings.ToLower(list[start:i])})
+		}
+	}
+}
+
+// Get returns the value of header, and false when it is not in the list
+func (h HeaderList) Get(header string) (string, bool) {
+	header = strings.ToLower(header)
+	for _, field := range h {
+		if field.Name == header {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Names returns the header names in order
+func (h HeaderList) Names() []string {
+	names := make([]string, 0, len(h))
+	for _, field := range h {
+		names = append(names, field.Name)
 	}
+	return names
 }
 
 func (h HeaderList) toHeadersString() string {
-	// todo return strings.Join(h, " ")
-	list := ""
-	for header := range h {
-		list += " " + strings.ToLower(header)
+	return strings.Join(h.Names(), " ")
+}
+
+// signingString returns the signed data: the signature base of an RFC 9421
+// signature, the signing string of the headers otherwise
+func (s SignatureParameters) signingString() (string, error) {
+	if s.signatureInput != "" {
+		return s.signatureBase(), nil
 	}
-	return list
+	return s.Headers.signingString()
 }
 
 func (h HeaderList) signingString() (string, error) {
 	signingList := []string{}
 
-	for header, value := range h {
-		headerString := fmt.Sprintf("%s: %s", header, value)
+	for _, field := range h {
+		headerString := fmt.Sprintf("%s: %s", field.Name, field.Value)
 		signingList = append(signingList, headerString)
 	}
 
 	return strings.Join(signingList, "\n"), nil
 }
 
-func requestTargetLine(req *http.Request) (string, error) {
-	if req.URL == nil {
-		return "", errors.New(ErrorURLNotInRequest)
+// requestTargetLine returns the (request-target) value of the message.
+// When opts.canonicalTarget is set the path is normalized first, see
+// canonicalPath.
+func requestTargetLine(m Message, opts requestOptions) (string, error) {
+	u, err := messageURL(m)
+	if err != nil {
+		return "", err
+	}
+	if len(m.Method()) == 0 {
+		return "", ErrMethodNotInRequest
+	}
+	method := strings.ToLower(m.Method())
+
+	// asterisk-form, eg "OPTIONS * HTTP/1.1"
+	if u.Path == "*" || u.Opaque == "*" {
+		return method + " *", nil
+	}
+
+	// origin-form, also when the URL was parsed in absolute-form
+	target := (&url.URL{Path: u.Path, RawPath: u.RawPath}).EscapedPath()
+	if opts.canonicalTarget {
+		target = canonicalPath(target)
 	}
-	if len(req.Method) == 0 {
-		return "", errors.New(ErrorMethodNotInRequest)
+	if target == "" {
+		target = "/"
 	}
+	if u.ForceQuery || u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return fmt.Sprintf("%s %s", method, target), nil
+}
 
-	path := req.URL.Path
-	method := strings.ToLower(req.Method)
-	return fmt.Sprintf("%s %s", method, path), nil
+// canonicalPath resolves "." and ".." segments and collapses duplicate
+// slashes, so ambiguous representations of a path can't be used to smuggle
+// a request past a signature. A trailing slash is kept, and ".." never
+// climbs above the root: "/a/./b" and "/a//b" become "/a/b", "/a/../b"
+// becomes "/b".
+func canonicalPath(p string) string {
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
 }
 
 func headerLine(req *http.Request, header string) (string, error) {
-	if value := req.Header.Get(header); value != "" {
+	if value, ok := headerValue(RequestMessage(req), header, requestOptions{}); ok {
 		return fmt.Sprintf("%s: %s", header, value), nil
 	}
-	return "", fmt.Errorf("%s '%s'", ErrorMissingRequiredHeader, header)
+	return "", &MissingHeaderError{Header: header}
 }
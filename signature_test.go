@@ -1,9 +1,11 @@
 package httpsignatures
 
 import (
+	"bufio"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +27,7 @@ func TestConfigParserNotRequiredDateHeader(t *testing.T) {
 	var s SignatureParameters
 	err := s.FromConfig("Test", "hmac-sha256", []string{"(request-target)", "host"})
 	assert.Nil(t, err) // It's okay to not require the date header for the signature
-	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{"(request-target)": "", "host": ""}}
+	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{{"(request-target)", ""}, {"host", ""}}}
 	assert.Equal(t, sigParam, s)
 }
 
@@ -34,7 +36,7 @@ func TestConfigParserMissingDateHeader(t *testing.T) {
 	err := s.FromConfig("Test", "hmac-sha256", nil) // the date header will be implicitly required
 	assert.Nil(t, err)
 
-	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{"date": ""}}
+	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{{"date", ""}}}
 	assert.Equal(t, sigParam, s)
 
 	r := &http.Request{
@@ -43,8 +45,9 @@ func TestConfigParserMissingDateHeader(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 	err = s.ParseRequest(r) // it is not okay to have no date header when required
@@ -62,8 +65,9 @@ func TestRequestParserMissingSignatureShouldFail(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
@@ -81,8 +85,9 @@ func TestRequestParserMissingAlgorithmShouldFail(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
@@ -100,8 +105,9 @@ func TestRequestParserMissingKeyIdShouldFail(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
@@ -110,7 +116,7 @@ func TestRequestParserMissingKeyIdShouldFail(t *testing.T) {
 	assert.EqualError(t, err, ErrorMissingSignatureParameterKeyId)
 }
 
-func TestRequestParserDualHeaderShouldPickLastOne(t *testing.T) {
+func TestRequestParserDualHeaderShouldFail(t *testing.T) {
 	const authHeader string = `keyId="Test",algorithm="hmac-sha256",signature="fffff",signature="abcde"`
 	r := &http.Request{
 		Header: http.Header{
@@ -119,16 +125,15 @@ func TestRequestParserDualHeaderShouldPickLastOne(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
 	var s SignatureParameters
 	err := s.FromRequest(r)
-	assert.Nil(t, err)
-	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{"date": testDate}, Signature: "abcde"}
-	assert.Equal(t, sigParam, s)
+	assert.ErrorIs(t, err, ErrDuplicateSignatureParameter)
 }
 
 func TestRequestParserMissingDateHeader(t *testing.T) {
@@ -140,8 +145,9 @@ func TestRequestParserMissingDateHeader(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
@@ -149,7 +155,7 @@ func TestRequestParserMissingDateHeader(t *testing.T) {
 	err := s.FromRequest(r)
 	assert.Nil(t, err)
 	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256,
-		Headers: HeaderList{"(request-target)": "post /foo?param=value&pet=dog", "host": "example.com"}, Signature: "fffff"}
+		Headers: HeaderList{{"(request-target)", "post /foo?param=value&pet=dog"}, {"host", "example.com"}}, Signature: "fffff"}
 	assert.Equal(t, sigParam, s)
 }
 
@@ -163,15 +169,16 @@ func TestRequestParserInvalidKeyShouldBeIgnored(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
 	var s SignatureParameters
 	err := s.FromRequest(r)
 	assert.Nil(t, err)
-	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{"date": testDate}, Signature: "fffff"}
+	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{{"date", testDate}}, Signature: "fffff"}
 	assert.Equal(t, sigParam, s)
 }
 
@@ -187,8 +194,9 @@ func TestRequestParserLoadHeaderMissingDateHeader(t *testing.T) {
 		},
 		Method: http.MethodPost,
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
@@ -219,7 +227,7 @@ func TestParseRequestWithNoHostShouldFail(t *testing.T) {
 		Method: http.MethodPost,
 	}
 
-	_, err := requestTargetLine(r)
+	_, err := requestTargetLine(RequestMessage(r), requestOptions{})
 	assert.EqualError(t, err, ErrorURLNotInRequest)
 }
 
@@ -230,11 +238,474 @@ func TestParseRequestWithNoMethodShouldFail(t *testing.T) {
 			"Authorization": []string{DefaultTestAuthHeader},
 		},
 		URL: &url.URL{
-			Host: "example.com",
-			Path: "/foo?param=value&pet=dog",
+			Host:     "example.com",
+			Path:     "/foo",
+			RawQuery: "param=value&pet=dog",
 		},
 	}
 
-	_, err := requestTargetLine(r)
+	_, err := requestTargetLine(RequestMessage(r), requestOptions{})
 	assert.EqualError(t, err, ErrorMethodNotInRequest)
 }
+
+func TestRequestTargetLineCanonicalPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		canonical string
+	}{
+		{"/a/./b", "/a/b"},
+		{"/a//b", "/a/b"},
+		{"/a/../b", "/b"},
+		{"/a/b/", "/a/b/"},
+		{"/../a", "/a"},
+		{"", "/"},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{Path: test.path},
+		}
+
+		tl, err := requestTargetLine(RequestMessage(r), requestOptions{})
+		assert.Nil(t, err)
+		if test.path == "" {
+			// an empty path is "/" in origin-form
+			assert.Equal(t, "get /", tl)
+		} else {
+			assert.Equal(t, "get "+test.path, tl)
+		}
+
+		tl, err = requestTargetLine(RequestMessage(r), requestOptions{canonicalTarget: true})
+		assert.Nil(t, err)
+		assert.Equal(t, "get "+test.canonical, tl)
+	}
+}
+
+func TestRequestParserEscapedQuotes(t *testing.T) {
+	const authHeader string = `keyId="my \"quoted\" key\\",algorithm="hmac-sha256",signature="fffff"`
+	r := &http.Request{
+		Header: http.Header{
+			"Date":      []string{testDate},
+			"Signature": []string{authHeader},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+	sigParam := SignatureParameters{KeyID: `my "quoted" key\`, Algorithm: algorithmHmacSha256, Headers: HeaderList{{"date", testDate}}, Signature: "fffff"}
+	assert.Equal(t, sigParam, s)
+}
+
+func TestRequestParserMalformedParameters(t *testing.T) {
+	for _, authHeader := range []string{
+		// unescaped quote inside the value
+		`keyId="Test"bob",algorithm="hmac-sha256",signature="fffff"`,
+		// no comma between the parameters
+		`keyId="a"garbagealgorithm="hmac-sha256",signature="fffff"`,
+		// unterminated quoted value
+		`keyId="Test",algorithm="hmac-sha256",signature="fffff`,
+		`keyId="Test",algorithm="hmac-sha256",signature="fffff\"`,
+		// trailing garbage
+		`keyId="Test",algorithm="hmac-sha256",signature="fffff" bob`,
+		`keyId="Test",algorithm="hmac-sha256",signature="fffff",`,
+		// missing name or value
+		`keyId="Test",="hmac-sha256",signature="fffff"`,
+		`keyId="Test",algorithm=,signature="fffff"`,
+		`keyId="Test",algorithm hmac-sha256,signature="fffff"`,
+	} {
+		r := &http.Request{
+			Header: http.Header{
+				"Date":      []string{testDate},
+				"Signature": []string{authHeader},
+			},
+		}
+
+		var s SignatureParameters
+		err := s.FromRequest(r)
+		assert.EqualError(t, err, ErrorMalformedSignatureHeader, authHeader)
+	}
+}
+
+func TestRequestParserWhitespaceAroundParameters(t *testing.T) {
+	const authHeader string = ` keyId = "Test" ,algorithm= "hmac-sha256",	created =1402170695 ,
+		signature ="fffff" `
+	r := &http.Request{
+		Header: http.Header{
+			"Date":      []string{testDate},
+			"Signature": []string{authHeader},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+	sigParam := SignatureParameters{KeyID: "Test", Algorithm: algorithmHmacSha256, Headers: HeaderList{{"date", testDate}}, Signature: "fffff", Created: 1402170695}
+	assert.Equal(t, sigParam, s)
+}
+
+func TestRequestParserCommaInValue(t *testing.T) {
+	const authHeader string = `keyId="a,b=\"c\"",algorithm="hmac-sha256",signature="fffff"`
+	r := &http.Request{
+		Header: http.Header{
+			"Date":      []string{testDate},
+			"Signature": []string{authHeader},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `a,b="c"`, s.KeyID)
+	assert.Equal(t, "fffff", s.Signature)
+}
+
+func TestRequestParserParameterTypes(t *testing.T) {
+	for _, authHeader := range []string{
+		`keyId=123,algorithm="hmac-sha256",signature="fffff"`,
+		`keyId="Test",algorithm="hmac-sha256",created="1402170695",signature="fffff"`,
+	} {
+		var s SignatureParameters
+		err := s.parseSignatureString(authHeader, requestOptions{})
+		assert.ErrorIs(t, err, ErrInvalidSignatureParameter, authHeader)
+	}
+
+	// unknown parameters are ignored, also when repeated
+	var s SignatureParameters
+	err := s.parseSignatureString(`keyId="Test",nonce=1,algorithm="hmac-sha256",nonce="a",signature="fffff"`, requestOptions{})
+	assert.Nil(t, err)
+}
+
+func BenchmarkParseSignatureString(b *testing.B) {
+	const authHeader string = `keyId="Test",algorithm="hmac-sha256",created=1402170695,headers="(request-target) host date digest",signature="QeLjxk7wkpwCqj3VMRhZ5J5u6smDy5p0eSxUjOzoUDM="`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s SignatureParameters
+		if err := s.parseSignatureString(authHeader, requestOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzParseSignatureString(f *testing.F) {
+	for _, seed := range []string{
+		`keyId="Test",algorithm="hmac-sha256",headers="(request-target) date",signature="fffff"`,
+		`keyId="my \"quoted\" key\\",algorithm="hmac-sha256",created=1402170695,signature="fffff"`,
+		` keyId = "a,b" ,algorithm= "rsa-sha256",	expires =1 ,signature ="fffff" `,
+		`keyId="Test",algorithm="hmac-sha256",signature="fffff",signature="abcde"`,
+		`keyId="Test",algorithm="hmac-sha256",headers="a\"b",signature="f\\"`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		var s SignatureParameters
+		if err := s.parseSignatureString(in, requestOptions{}); err != nil {
+			return
+		}
+		// the encoded form parses to the same parameters
+		var parsed SignatureParameters
+		if err := parsed.parseSignatureString(s.hTTPSignatureString(s.Signature), requestOptions{}); err != nil {
+			t.Fatalf("parsing the encoded form of %q: %v", in, err)
+		}
+		if parsed.KeyID != s.KeyID || parsed.Created != s.Created || parsed.Expires != s.Expires || len(parsed.Headers) != len(s.Headers) {
+			t.Fatalf("%q parses to %+v, its encoded form to %+v", in, s, parsed)
+		}
+	})
+}
+
+func TestRequestParserSpoofableHeaders(t *testing.T) {
+	for header, expected := range map[string]error{
+		"(request-target2)": ErrUnknownPseudoHeader,
+		"(date)":            ErrUnknownPseudoHeader,
+		"connection":        ErrHopByHopHeader,
+		"Transfer-Encoding": ErrHopByHopHeader,
+	} {
+		r := &http.Request{
+			Header: http.Header{
+				"Date":              []string{testDate},
+				"Connection":        []string{"close"},
+				"Transfer-Encoding": []string{"chunked"},
+				"Signature":         []string{`keyId="Test",algorithm="hmac-sha256",headers="date ` + header + `",signature="fffff"`},
+			},
+		}
+
+		var s SignatureParameters
+		err := s.FromRequest(r)
+		assert.ErrorIs(t, err, expected, header)
+
+		err = NewSigner(AlgorithmHmacSha256, "date", header).SignRequest(r, testKeyID, testKey)
+		assert.ErrorIs(t, err, expected, header)
+
+		rfc9421 := NewSigner(AlgorithmHmacSha256, header)
+		rfc9421.Format = FormatRFC9421
+		err = rfc9421.SignRequest(r, testKeyID, testKey)
+		assert.ErrorIs(t, err, expected, header)
+	}
+}
+
+func TestSignatureStringEscapesKeyID(t *testing.T) {
+	s := SignatureParameters{KeyID: `my "quoted" key\`, Algorithm: algorithmHmacSha256, Headers: HeaderList{{"date", testDate}}}
+	str := s.hTTPSignatureString("fffff")
+
+	var parsed SignatureParameters
+	err := parsed.parseSignatureString(str, requestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, s.KeyID, parsed.KeyID)
+}
+
+func TestStripSignature(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date":            []string{testDate},
+			"Signature":       []string{testSignature, testSignature},
+			"Signature-Input": []string{`sig1=("date");keyid="Test"`},
+			"Authorization":   []string{"Signature " + testSignature, "Bearer token", "signature " + testSignature},
+		},
+	}
+
+	StripSignature(r)
+	assert.Equal(t, http.Header{
+		"Date":          []string{testDate},
+		"Authorization": []string{"Bearer token"},
+	}, r.Header)
+}
+
+func TestStripSignatureOnlyAuthorization(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Authorization": []string{"Signature " + testSignature},
+		},
+	}
+
+	StripSignature(r)
+	assert.Equal(t, http.Header{}, r.Header)
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.EqualError(t, err, ErrorNoSignatureHeaderFoundInRequest)
+}
+
+func TestVerifierStripSignature(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature":       []string{testSignature},
+			"Signature-Input": []string{`sig1=("date");keyid="Test"`},
+			"Authorization":   []string{"HTTPSig " + testSignature, "Signature " + testSignature, "Bearer token"},
+		},
+	}
+
+	v := NewVerifier(keyLookUp, -1)
+	v.AuthScheme = "HTTPSig"
+	v.StripSignature(r)
+	assert.Equal(t, http.Header{
+		"Authorization": []string{"Signature " + testSignature, "Bearer token"},
+	}, r.Header)
+}
+
+func TestSignableComponents(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Set("X-Request-Id", "42")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Signature "+testSignature)
+	// hop-by-hop headers are refused by the signer
+	r.Header.Set("Connection", "keep-alive")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("TE", "trailers")
+
+	assert.Equal(t,
+		[]string{
+			"(request-target)", "(created)", "host",
+			"@method", "@target-uri", "@authority", "@scheme", "@request-target", "@path", "@query",
+			"content-type", "date", "x-request-id",
+		},
+		SignableComponents(r),
+	)
+}
+
+func TestSignableComponentsQueryParams(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo?param=Value&Pet=dog&tag=a&tag=b&a%20b=c", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Signature-Input", `sig1=("@method");keyid="Test"`)
+	r.Header.Set("Signature", "sig1=:dGVzdA==:")
+	r.Header.Set("Connection", "close")
+
+	components := SignableComponents(r)
+	assert.Contains(t, components, `@query-param;name="Pet"`)
+	assert.Contains(t, components, `@query-param;name="param"`)
+	assert.Contains(t, components, `@query-param;name="a%20b"`)
+	// a repeated parameter can't be signed
+	assert.NotContains(t, components, `@query-param;name="tag"`)
+	assert.NotContains(t, components, HeaderSignatureInput)
+	assert.NotContains(t, components, "signature")
+
+	// every component is signable in its format
+	var cavage, rfc9421 []string
+	for _, component := range components {
+		if !strings.HasPrefix(component, "@") {
+			cavage = append(cavage, component)
+		}
+		if !strings.HasPrefix(component, "(") {
+			rfc9421 = append(rfc9421, component)
+		}
+	}
+	signer := NewSignerWithOptions(testKeyID, []byte(testKey), AlgorithmHmacSha256, WithHeaders(cavage...))
+	assert.Nil(t, signer.Sign(r))
+	signer = NewSignerWithOptions(testKeyID, []byte(testKey), AlgorithmHmacSha256, WithHeaders(rfc9421...))
+	signer.Format = FormatRFC9421
+	signer.Label = "sig2"
+	assert.Nil(t, signer.Sign(r))
+}
+
+func TestSignableComponentsWithoutURL(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	assert.Equal(t, []string{"(created)", "date"}, SignableComponents(r))
+}
+
+func TestRequestParserCreatedExpires(t *testing.T) {
+	const authHeader string = `keyId="Test",algorithm="hmac-sha256",created=1402170695,expires=1402170995,headers="(created) (expires) (request-target)",signature="fffff"`
+	r := &http.Request{
+		Header: http.Header{
+			"Signature": []string{authHeader},
+		},
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: "/foo"},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1402170695), s.Created)
+	assert.Equal(t, int64(1402170995), s.Expires)
+
+	signingString, err := s.Headers.signingString()
+	assert.Nil(t, err)
+	assert.Equal(t, "(created): 1402170695\n(expires): 1402170995\n(request-target): get /foo", signingString)
+
+	assert.Equal(t, `keyId="Test",algorithm="hmac-sha256",created=1402170695,expires=1402170995,headers="(created) (expires) (request-target)",signature="fffff"`,
+		s.hTTPSignatureString("fffff"))
+}
+
+func TestRequestParserMissingCreated(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature": []string{`keyId="Test",algorithm="hmac-sha256",headers="(created)",signature="fffff"`},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.EqualError(t, err, ErrorMissingSignatureParameterCreated)
+
+	r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",headers="(expires)",signature="fffff"`)
+	err = s.FromRequest(r)
+	assert.EqualError(t, err, ErrorMissingSignatureParameterExpires)
+}
+
+func TestRequestParserInvalidCreated(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature": []string{`keyId="Test",algorithm="hmac-sha256",created="yesterday",signature="fffff"`},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.EqualError(t, err, ErrorInvalidSignatureParameter+" 'created'")
+}
+
+func TestRequestParserDuplicateHeaderIsJoined(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature":       []string{`keyId="Test",algorithm="hmac-sha256",headers="date x-forwarded-for",signature="fffff"`},
+			"Date":            []string{testDate},
+			"X-Forwarded-For": []string{" 10.0.0.1", "192.168.0.1 ", "\t172.16.0.1"},
+		},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+	signingString, err := s.Headers.signingString()
+	assert.Nil(t, err)
+	assert.Equal(t, "date: "+testDate+"\nx-forwarded-for: 10.0.0.1, 192.168.0.1, 172.16.0.1", signingString)
+
+	// a signature over the joined values verifies
+	r.Header.Del("Signature")
+	err = NewSigner("hmac-sha256", "date", "x-forwarded-for").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	r.Header["X-Forwarded-For"] = []string{"10.0.0.1", "192.168.0.1", "172.16.0.1"}
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestRequestTargetLineForms(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		line   string
+	}{
+		// origin-form
+		{http.MethodGet, "/foo?param=value&pet=dog", "get /foo?param=value&pet=dog"},
+		{http.MethodGet, "/foo?", "get /foo?"},
+		{http.MethodGet, "/a%2Fb/c%20d", "get /a%2Fb/c%20d"},
+		// absolute-form, eg a request to a proxy
+		{http.MethodPost, "http://example.com/foo?param=value", "post /foo?param=value"},
+		{http.MethodGet, "https://user@example.com:8443", "get /"},
+		// asterisk-form
+		{http.MethodOptions, "*", "options *"},
+	}
+
+	for _, test := range tests {
+		u, err := url.ParseRequestURI(test.target)
+		assert.Nil(t, err, test.target)
+		r := &http.Request{Method: test.method, URL: u}
+
+		tl, err := requestTargetLine(RequestMessage(r), requestOptions{})
+		assert.Nil(t, err, test.target)
+		assert.Equal(t, test.line, tl, test.target)
+	}
+}
+
+func TestRequestTargetLineFromServer(t *testing.T) {
+	for target, line := range map[string]string{
+		"OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n":                          "options *",
+		"GET http://example.com/foo?bar=baz HTTP/1.1\r\nHost: example.com\r\n\r\n": "get /foo?bar=baz",
+	} {
+		r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(target)))
+		assert.Nil(t, err)
+
+		tl, err := requestTargetLine(RequestMessage(r), requestOptions{canonicalTarget: true})
+		assert.Nil(t, err)
+		assert.Equal(t, line, tl)
+	}
+}
+
+func TestSignatureCovers(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature": []string{`keyId="Test",algorithm="hmac-sha256",headers="(request-target) Host date",signature="fffff"`},
+			"Date":      []string{testDate},
+		},
+		Method: http.MethodPost,
+		URL:    &url.URL{Host: "example.com", Path: "/foo"},
+	}
+
+	var s SignatureParameters
+	err := s.FromRequest(r)
+	assert.Nil(t, err)
+
+	assert.True(t, s.Covers())
+	assert.True(t, s.Covers(HeaderRequestTarget))
+	assert.True(t, s.Covers("(Request-Target)", "HOST", "Date"))
+	assert.False(t, s.Covers("request-target"))
+	assert.False(t, s.Covers(HeaderRequestTarget, "digest"))
+}
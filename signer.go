@@ -1,99 +1,448 @@
 package httpsignatures
 
 import (
-	"errors"
+	"crypto"
+	"encoding/base64"
 	"net/http"
 	"time"
 )
 
-type signer struct {
+// Signer signs requests with the configured algorithm, covering the
+// configured headers
+type Signer struct {
 	algorithm string
 	headers   []string
+	keyID     string
+	keyB64    string
+	key       []byte
+
+	cryptoSigner crypto.Signer
+
+	// Keys, when set, holds the keys of the keyId: Sign signs with the
+	// newest valid key and its algorithm instead of the key of the signer,
+	// so keys can be rotated without creating a new signer
+	Keys KeySet
+
+	// UseAuthorization makes Sign add the signature to the Authorization
+	// header instead of the Signature header
+	UseAuthorization bool
+	// AuthScheme is the scheme of the Authorization header, "Signature"
+	// when empty. Verifiers expecting another scheme need the same setting.
+	AuthScheme string
+
+	// CanonicalTarget normalizes the path of the (request-target) before
+	// signing, see canonicalPath. The verifier needs the same setting.
+	CanonicalTarget bool
+	// Canonicalizers override the canonicalization of the values of a
+	// header, by lowercase header name. The verifier needs the same setting.
+	Canonicalizers map[string]Canonicalizer
+	// ExpiresIn sets the expires parameter to this long after signing.
+	// Draft-cavage signatures cover (expires) when it isn't covered yet, an
+	// uncovered expires parameter could be changed by anyone.
+	ExpiresIn time.Duration
+	// DigestAlgorithms, eg "SHA-256", make the signer compute the Digest and
+	// Content-Digest headers of the body before signing, see AddDigests.
+	// When neither is covered, digest is added to the signed headers of
+	// draft-cavage signatures and content-digest to the components of RFC
+	// 9421 signatures.
+	DigestAlgorithms []string
+	// Format selects the signature format, FormatRFC9421 signs with the
+	// Signature-Input and Signature headers of RFC 9421, both with Sign and
+	// AuthRequest. FormatAuto and FormatCavage sign draft-cavage signatures.
+	Format SignatureFormat
+	// Label is the RFC 9421 signature label, "sig1" by default
+	Label string
+	// Nonce is sent as the nonce parameter of RFC 9421 signatures, usually
+	// set per request with WithNonce. draft-cavage has no nonce.
+	Nonce string
+	// AddDate makes Sign set the Date header to the current time when the
+	// request has none
+	AddDate bool
+	// Observer, when set, is notified of every signature Sign creates
+	Observer Observer
+	// Clock returns the current time for the Date header and the created
+	// and expires parameters, time.Now when nil
+	Clock func() time.Time
+	// Hs2019 signs with the algorithm of the signer but sends
+	// algorithm="hs2019", the verifier derives the algorithm from the key.
+	// RFC 9421 signatures leave out the alg parameter instead.
+	Hs2019 bool
+	// DeterministicECDSA derives the nonce of ECDSA signatures from the key
+	// and the signing string (RFC 6979) instead of using a random one, so
+	// the same request is always signed the same, eg for reproducible
+	// tests. Verifiers can't tell the difference. It doesn't apply to a
+	// crypto.Signer.
+	DeterministicECDSA bool
+}
+
+// SignerOption configures a signer created with NewSignerWithOptions, or
+// a single signature made with Sign
+type SignerOption func(s *Signer)
+
+// WithCryptoSigner makes Sign sign with signer instead of the key, see
+// SignRequestSigner
+func WithCryptoSigner(signer crypto.Signer) SignerOption {
+	return func(s *Signer) {
+		s.cryptoSigner = signer
+	}
+}
+
+// WithKeySet signs with the newest valid key of keys, see Signer.Keys
+func WithKeySet(keys KeySet) SignerOption {
+	return func(s *Signer) {
+		s.Keys = keys
+	}
+}
+
+// WithHeaders signs headers, "date" when none are configured
+func WithHeaders(headers ...string) SignerOption {
+	return func(s *Signer) {
+		s.headers = headers
+	}
+}
+
+// WithDate sets the Date header of requests which have none before signing
+func WithDate() SignerOption {
+	return func(s *Signer) {
+		s.AddDate = true
+	}
+}
+
+// WithDigest adds the Digest and Content-Digest headers of the body before
+// signing, with SHA-256 when no algorithms are given, see DigestAlgorithms
+func WithDigest(algorithms ...string) SignerOption {
+	return func(s *Signer) {
+		if len(algorithms) == 0 {
+			algorithms = []string{"SHA-256"}
+		}
+		s.DigestAlgorithms = algorithms
+	}
+}
+
+// WithCreated signs the (created) timestamp, besides "date" when no headers
+// are configured
+func WithCreated() SignerOption {
+	return func(s *Signer) {
+		headers := s.headers
+		if len(headers) == 0 {
+			headers = []string{HeaderDate}
+		}
+		// don't append to the headers of the signer Sign copied
+		s.headers = append(headers[:len(headers):len(headers)], HeaderCreated)
+	}
+}
+
+// WithExpiresIn sets the expires parameter to d after signing and signs the
+// (expires) timestamp, see Signer.ExpiresIn
+func WithExpiresIn(d time.Duration) SignerOption {
+	return func(s *Signer) {
+		s.ExpiresIn = d
+	}
+}
+
+// WithNonce sends nonce as the nonce parameter of RFC 9421 signatures, see
+// Signer.Nonce
+func WithNonce(nonce string) SignerOption {
+	return func(s *Signer) {
+		s.Nonce = nonce
+	}
+}
+
+// WithAuthorization makes Sign add the signature to the Authorization
+// header instead of the Signature header
+func WithAuthorization() SignerOption {
+	return func(s *Signer) {
+		s.UseAuthorization = true
+	}
+}
+
+// WithAuthScheme makes Sign add the signature to the Authorization header
+// with scheme instead of "Signature", eg for APIs mandating their own scheme
+func WithAuthScheme(scheme string) SignerOption {
+	return func(s *Signer) {
+		s.UseAuthorization = true
+		s.AuthScheme = scheme
+	}
+}
+
+// WithHs2019 sends algorithm="hs2019" instead of the algorithm name, see
+// Signer.Hs2019
+func WithHs2019() SignerOption {
+	return func(s *Signer) {
+		s.Hs2019 = true
+	}
+}
+
+// WithDeterministicECDSA signs ECDSA signatures deterministically, see
+// Signer.DeterministicECDSA
+func WithDeterministicECDSA() SignerOption {
+	return func(s *Signer) {
+		s.DeterministicECDSA = true
+	}
 }
 
 // NewSigner adds an algorithm to the signer algorithms
-func NewSigner(algorithm string, headers ...string) *signer {
-	return &signer{
+func NewSigner(algorithm string, headers ...string) *Signer {
+	return &Signer{
 		algorithm: algorithm,
 		headers:   headers,
 	}
 }
 
+// NewKeySigner creates a signer which signs with the base64 encoded key
+// belonging to keyID, see Sign
+func NewKeySigner(keyID string, algorithm string, keyB64 string, headers ...string) *Signer {
+	return &Signer{
+		algorithm: algorithm,
+		headers:   headers,
+		keyID:     keyID,
+		keyB64:    keyB64,
+	}
+}
+
+// NewSignerWithOptions creates a signer which signs with the raw key
+// belonging to keyID, see Sign. The options are applied in order, eg
+//
+//	NewSignerWithOptions(keyID, key, AlgorithmEd25519,
+//		WithHeaders("(request-target)", "host"), WithDate(), WithCreated())
+func NewSignerWithOptions(keyID string, key []byte, algorithm string, opts ...SignerOption) *Signer {
+	s := &Signer{
+		algorithm: algorithm,
+		keyID:     keyID,
+		key:       key,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sign adds a http signature with the key of the signer to the Signature
+// HTTP Header, or the Authorization header when UseAuthorization is set.
+// Every configured header must be set on the request before signing.
+//
+// The options override the configuration of the signer for this request
+// only, eg for an API requiring other headers:
+//
+//	signer.Sign(r, WithHeaders("(request-target)", "date", "digest"), WithExpiresIn(30*time.Second))
+func (s Signer) Sign(r *http.Request, opts ...SignerOption) error {
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if s.Observer == nil {
+		return s.sign(r)
+	}
+
+	s.Observer.OnSignStart(r)
+	start := time.Now()
+	err := s.sign(r)
+	s.Observer.OnSignDone(r, SignatureEvent{
+		KeyID:     s.keyID,
+		Algorithm: s.algorithm,
+		Duration:  time.Since(start),
+		Err:       err,
+	})
+	return err
+}
+
+// sign signs the request, the algorithm of a key of Keys becomes the
+// algorithm of s
+func (s *Signer) sign(r *http.Request) error {
+	if s.AddDate && r.Header.Get("Date") == "" {
+		r.Header.Set("Date", s.now().UTC().Format(http.TimeFormat))
+	}
+
+	sign, err := s.keySignFunc()
+	if err != nil {
+		return err
+	}
+	return s.signRequest(r, s.keyID, sign, s.UseAuthorization)
+}
+
+// keySignFunc returns the signing function of the key of the signer. The
+// newest valid key of Keys is used, and its algorithm becomes the algorithm
+// of the signer.
+func (s *Signer) keySignFunc() (signFunc, error) {
+	if s.Keys != nil {
+		keys, err := s.Keys.LookUpKeys(s.keyID)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := newestKey(keys, s.now())
+		if !ok && len(keys) == 0 {
+			return nil, &UnknownKeyError{KeyID: s.keyID}
+		}
+		if !ok {
+			return nil, ErrKeyNotValid
+		}
+		s.algorithm = key.Algorithm
+		return s.rawKeySignFunc(key.Key), nil
+	}
+
+	if s.cryptoSigner != nil {
+		return cryptoSignFunc(s.cryptoSigner), nil
+	}
+
+	key := s.key
+	if key == nil {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(s.keyB64); err != nil {
+			return nil, err
+		}
+	}
+	return s.rawKeySignFunc(key), nil
+}
+
+// rawKeySignFunc returns the signing function of the raw key, which signs
+// deterministically when the signer has DeterministicECDSA and the
+// algorithm supports it
+func (s Signer) rawKeySignFunc(key []byte) signFunc {
+	if !s.DeterministicECDSA {
+		return keySignFunc(key)
+	}
+	return func(alg *Algorithm, message []byte) ([]byte, error) {
+		sign, ok := deterministicSigners[alg]
+		if !ok {
+			return keySignFunc(key)(alg, message)
+		}
+		signature, err := sign(&key, message)
+		if err != nil {
+			return nil, err
+		}
+		return *signature, nil
+	}
+}
+
 // SignRequest adds a http signature to the Signature: HTTP Header
-func (s signer) SignRequest(r *http.Request, keyID string, keyB64 string) error {
-	signature, err := s.createHTTPSignatureString(r, keyID, keyB64)
+func (s Signer) SignRequest(r *http.Request, keyID string, keyB64 string) error {
+	key, err := base64.StdEncoding.DecodeString(keyB64)
 	if err != nil {
 		return err
 	}
+	return s.SignRequestKey(r, keyID, key)
+}
 
-	r.Header.Add("Signature", signature)
-	return nil
+// SignRequestKey adds a http signature using the raw key to the Signature:
+// HTTP Header, see KeyBytes for parsed keys
+func (s Signer) SignRequestKey(r *http.Request, keyID string, key []byte) error {
+	return s.signRequest(r, keyID, s.rawKeySignFunc(key), false)
 }
 
 // AuthRequest adds a http signature to the Authorization: HTTP Header
-func (s signer) AuthRequest(r *http.Request, keyID string, keyB64 string) error {
-	signature, err := s.createHTTPSignatureString(r, keyID, keyB64)
+func (s Signer) AuthRequest(r *http.Request, keyID string, keyB64 string) error {
+	key, err := base64.StdEncoding.DecodeString(keyB64)
 	if err != nil {
 		return err
 	}
+	return s.AuthRequestKey(r, keyID, key)
+}
 
-	r.Header.Add("Authorization", "Signature "+signature)
-	return nil
+// AuthRequestKey adds a http signature using the raw key to the
+// Authorization: HTTP Header, see KeyBytes for parsed keys
+func (s Signer) AuthRequestKey(r *http.Request, keyID string, key []byte) error {
+	return s.signRequest(r, keyID, s.rawKeySignFunc(key), true)
 }
 
-func (s signer) createHTTPSignatureString(r *http.Request, keyID string, keyB64 string) (string, error) {
+// signRequest adds the signature to the Authorization header when
+// authorization is set, the Signature header otherwise
+func (s Signer) signRequest(r *http.Request, keyID string, sign signFunc, authorization bool) error {
 	sig := SignatureParameters{}
 	if err := sig.FromConfig(keyID, s.algorithm, s.headers); err != nil {
-		return "", err
+		return err
+	}
+	header := HeaderDigest
+	if s.Format == FormatRFC9421 {
+		header = HeaderContentDigest
+	}
+	if err := s.addDigests(r, &sig, header); err != nil {
+		return err
+	}
+
+	added, err := s.signatureHeaders(RequestMessage(r), sig, sign, authorization)
+	if err != nil {
+		return err
+	}
+	for name, values := range added {
+		r.Header[name] = append(r.Header[name], values...)
+	}
+	return nil
+}
+
+// signatureHeaders signs the headers of sig of the message and returns the
+// headers carrying the signature: the Signature or Authorization header, or
+// the Signature-Input and Signature headers of RFC 9421
+func (s Signer) signatureHeaders(m Message, sig SignatureParameters, sign signFunc, authorization bool) (http.Header, error) {
+	if s.Format == FormatRFC9421 {
+		return s.signRFC9421(m, sig, sign)
+	}
+	signature, err := s.createHTTPSignatureString(m, sig, sign)
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization {
+		scheme := s.AuthScheme
+		if scheme == "" {
+			scheme = defaultAuthScheme
+		}
+		return http.Header{"Authorization": {scheme + " " + signature}}, nil
 	}
+	return http.Header{"Signature": {signature}}, nil
+}
 
-	if err := sig.ParseRequest(r); err != nil {
+func (s Signer) createHTTPSignatureString(m Message, sig SignatureParameters, sign signFunc) (string, error) {
+	now := s.now()
+	if _, ok := sig.Headers.Get(HeaderCreated); ok {
+		sig.Created = now.Unix()
+	}
+	if s.ExpiresIn > 0 {
+		sig.Expires = now.Add(s.ExpiresIn).Unix()
+		if !sig.Covers(HeaderExpires) {
+			sig.Headers = append(sig.Headers, HeaderField{Name: HeaderExpires})
+		}
+	}
+
+	if err := sig.parseMessage(m, s.requestOptions()); err != nil {
 		return "", err
 	}
 
-	signature, err := sig.calculateSignature(keyB64)
+	signature, err := sig.calculateSignatureWith(sign)
 	if err != nil {
 		return "", err
 	}
 
+	if s.Hs2019 {
+		sig.Algorithm = algorithmHs2019
+	}
 	return sig.hTTPSignatureString(signature), nil
 }
 
-// VerifyRequest verifies the signature added to the request and returns true if it is OK
-func VerifyRequest(r *http.Request, keyLookUp func(keyID string) (string, error), allowedClockSkew int, headers ...string) (bool, error) {
-	sig := SignatureParameters{}
-
-	if err := sig.FromRequest(r); err != nil {
-		return false, err
+// addDigests sets the digest headers of the body when DigestAlgorithms are
+// configured, and covers header, the digest header of the signature format,
+// when the signature covers neither digest header
+func (s Signer) addDigests(r *http.Request, sig *SignatureParameters, header string) error {
+	if len(s.DigestAlgorithms) == 0 {
+		return nil
 	}
-
-	for _, header := range headers {
-		if sig.Headers[header] == "" {
-			return false, errors.New(ErrorRequiredHeaderNotInHeaderList)
-		}
+	if err := AddDigests(r, s.DigestAlgorithms...); err != nil {
+		return err
+	}
+	if !sig.Covers(HeaderDigest) && !sig.Covers(HeaderContentDigest) {
+		sig.Headers = append(sig.Headers, HeaderField{Name: header})
 	}
+	return nil
+}
 
-	if allowedClockSkew > -1 {
-		if allowedClockSkew == 0 {
-			return false, errors.New(ErrorYouProbablyMisconfiguredAllowedClockSkew)
-		}
-		// check if difference between date and date.Now exceeds allowedClockSkew
-		if date := sig.Headers["date"]; len(date) != 0 {
-			if hdrDate, err := time.Parse(time.RFC1123, date); err == nil {
-				if (int)(time.Since(hdrDate).Seconds()) > (allowedClockSkew) {
-					return false, errors.New(ErrorAllowedClockskewExceeded)
-				}
-			} else {
-				return false, err
-			}
-
-		} else {
-			return false, errors.New(ErrorDateHeaderIsMissingForClockSkewComparison)
-		}
+func (s Signer) requestOptions() requestOptions {
+	return requestOptions{
+		canonicalTarget: s.CanonicalTarget,
+		canonicalizers:  s.Canonicalizers,
 	}
-	key, err := keyLookUp(sig.KeyID)
-	if err != nil {
-		return false, err
+}
+
+func (s Signer) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
 	}
-	return sig.Verify(key)
+	return time.Now()
 }
@@ -1,9 +1,11 @@
 package httpsignatures
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,6 +34,8 @@ const (
 // Signing
 
 func TestSignSha1(t *testing.T) {
+	defer enableSHA1()()
+
 	r := &http.Request{
 		Header: http.Header{
 			"Date": []string{"Thu, 05 Jan 2012 21:31:40 GMT"},
@@ -48,7 +52,7 @@ func TestSignSha1(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, testKeyID, s.KeyID)
 	assert.Equal(t, algorithmHmacSha1, s.Algorithm)
-	assert.Equal(t, HeaderList{"date": "Thu, 05 Jan 2012 21:31:40 GMT"}, s.Headers)
+	assert.Equal(t, HeaderList{{"date", "Thu, 05 Jan 2012 21:31:40 GMT"}}, s.Headers)
 	assert.Equal(t,
 		"06tbjUif0/069JeDM7gWFUOjz04=",
 		s.Signature,
@@ -72,7 +76,7 @@ func TestSignSha256(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, testKeyID, s.KeyID)
 	assert.Equal(t, algorithmHmacSha256, s.Algorithm)
-	assert.Equal(t, HeaderList{"date": "Thu, 05 Jan 2012 21:31:40 GMT"}, s.Headers)
+	assert.Equal(t, HeaderList{{"date", "Thu, 05 Jan 2012 21:31:40 GMT"}}, s.Headers)
 	assert.Equal(t,
 		"QgoCZTOayhvFBl1QLXmFOZIVMXC0Dujs5ODsYVruDPI=",
 		s.Signature,
@@ -97,7 +101,7 @@ func TestValidEd25119RequestIsValid(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, ed25519TestPublicKey, s.KeyID)
 	assert.Equal(t, algorithmEd25519, s.Algorithm)
-	assert.Equal(t, HeaderList{"date": "Thu, 05 Jan 2012 21:31:40 GMT"}, s.Headers)
+	assert.Equal(t, HeaderList{{"date", "Thu, 05 Jan 2012 21:31:40 GMT"}}, s.Headers)
 	assert.Equal(t,
 		ed25519TestSignature,
 		s.Signature,
@@ -119,7 +123,7 @@ func TestSignSha256OmitHeaderLeadingTrailingWhitespace(t *testing.T) {
 	var s SignatureParameters
 	err = s.FromRequest(r)
 	assert.Nil(t, err)
-	assert.Equal(t, HeaderList{"date": "Thu, 05 Jan 2012 21:31:40 GMT"}, s.Headers)
+	assert.Equal(t, HeaderList{{"date", "Thu, 05 Jan 2012 21:31:40 GMT"}}, s.Headers)
 	assert.Equal(t,
 		"QgoCZTOayhvFBl1QLXmFOZIVMXC0Dujs5ODsYVruDPI=",
 		s.Signature,
@@ -143,11 +147,13 @@ func TestSignSha256DoubleHeaderField(t *testing.T) {
 	var s SignatureParameters
 	err = s.FromRequest(r)
 	assert.Nil(t, err)
-	assert.Equal(t, HeaderList{"date": "Thu, 05 Jan 2012 21:31:40 GMT",
-		"cache-control": "max-age=60, must-revalidate"}, s.Headers)
+	assert.Equal(t, HeaderList{{"cache-control", "max-age=60, must-revalidate"},
+		{"date", "Thu, 05 Jan 2012 21:31:40 GMT"}}, s.Headers)
 }
 
 func TestSignWithMissingDateHeader(t *testing.T) {
+	defer enableSHA1()()
+
 	r := &http.Request{
 		Header: http.Header{},
 	}
@@ -157,6 +163,8 @@ func TestSignWithMissingDateHeader(t *testing.T) {
 }
 
 func TestSignWithMissingHeader(t *testing.T) {
+	defer enableSHA1()()
+
 	r := &http.Request{
 		Header: http.Header{
 			"Date": []string{"Thu, 05 Jan 2012 21:31:40 GMT"},
@@ -241,3 +249,325 @@ func TestVerifyRequiredHeaderList(t *testing.T) {
 	_, err = VerifyRequest(r, keyLookUp, -1, "date")
 	assert.Nil(t, err)
 }
+
+func TestSignatureParameterOrder(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Equal(t,
+		`keyId="Test",algorithm="hmac-sha256",headers="date",signature="`+testSha256Hash+`"`,
+		r.Header.Get("Signature"),
+	)
+}
+
+func TestSignSha1RejectedByDefault(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	err := DefaultSha1Signer.SignRequest(r, testKeyID, testKey)
+	assert.EqualError(t, err, ErrorSHA1AlgorithmNotAllowed)
+
+	r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha1",signature="`+testSha1Hash+`"`)
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSHA1AlgorithmNotAllowed)
+
+	defer enableSHA1()()
+	res, err = VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSignPreservesHeaderOrder(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo?param=value", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	signer := NewSigner("hmac-sha256", "(request-target)", "host", "date", "digest")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Contains(t, r.Header.Get("Signature"), `,headers="(request-target) host date digest",`)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, HeaderList{
+		{"(request-target)", "post /foo?param=value"},
+		{"host", "example.com"},
+		{"date", testDate},
+		{"digest", testBodyDigest},
+	}, s.Headers)
+
+	signingString, err := s.Headers.signingString()
+	assert.Nil(t, err)
+	assert.Equal(t, "(request-target): post /foo?param=value\nhost: example.com\ndate: "+testDate+"\ndigest: "+testBodyDigest, signingString)
+
+	// the round trip verifies every time
+	for i := 0; i < 10; i++ {
+		res, err := VerifyRequest(r, keyLookUp, -1)
+		assert.True(t, res)
+		assert.Nil(t, err)
+	}
+}
+
+func TestSignRepeatedHeaderName(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	// a header listed twice gets a line at each position
+	signer := NewSigner("hmac-sha256", "date", "host", "date")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	assert.Contains(t, r.Header.Get("Signature"), `,headers="date host date",`)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	signingString, err := s.Headers.signingString()
+	assert.Nil(t, err)
+	assert.Equal(t, "date: "+testDate+"\nhost: example.com\ndate: "+testDate, signingString)
+
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSignMultipleHeaderValues(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Add("X-Forwarded-For", "192.0.2.1")
+	r.Header.Add("X-Forwarded-For", " 198.51.100.7 ")
+
+	signer := NewSigner("hmac-sha256", "date", "x-forwarded-for")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	value, _ := s.Headers.Get("x-forwarded-for")
+	assert.Equal(t, "192.0.2.1, 198.51.100.7", value)
+
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// every value is signed, not only the first
+	r.Header["X-Forwarded-For"][1] = "203.0.113.9"
+	res, err = VerifyRequest(r, keyLookUp, -1)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestKeySignerRoundTrip(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "(request-target)", "host", "date", "digest")
+	err = signer.Sign(r)
+	assert.Nil(t, err)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"(request-target)", "host", "date", "digest"}, s.Headers.Names())
+	res, err := s.Verify(testKey)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestKeySignerAuthorization(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey)
+	signer.UseAuthorization = true
+	err := signer.Sign(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", r.Header.Get("Signature"))
+	assert.Equal(t, `Signature keyId="Test",algorithm="hmac-sha256",headers="date",signature="`+testSha256Hash+`"`, r.Header.Get("Authorization"))
+}
+
+func TestSignerWithOptions(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	signer := NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256,
+		WithHeaders("(request-target)", "date"),
+		WithDate(),
+		WithDigest(),
+		WithCreated(),
+		WithExpiresIn(time.Minute),
+	)
+	err = signer.Sign(r)
+	assert.Nil(t, err)
+
+	assert.NotEqual(t, "", r.Header.Get("Date"))
+	assert.Equal(t, testBodyDigest, r.Header.Get("Digest"))
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"(request-target)", "date", "(created)", "digest", "(expires)"}, s.Headers.Names())
+	assert.Equal(t, int64(60), s.Expires-s.Created)
+
+	v := NewVerifier(keyLookUp, 300)
+	v.CheckDigest = true
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the expires parameter is covered, it can't be extended
+	signature := r.Header.Get("Signature")
+	r.Header.Set("Signature", strings.Replace(signature, fmt.Sprintf("expires=%d", s.Expires), fmt.Sprintf("expires=%d", s.Expires+3600), 1))
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestSignerWithOptionsAuthorization(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	err = NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256, WithDate(), WithAuthorization()).Sign(r)
+	assert.Nil(t, err)
+
+	// an existing date is kept
+	assert.Equal(t, `Signature keyId="Test",algorithm="hmac-sha256",headers="date",signature="`+testSha256Hash+`"`, r.Header.Get("Authorization"))
+}
+
+func TestSignerWithCreatedDefaultHeaders(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	r := &http.Request{Header: http.Header{"Date": []string{testDate}}}
+	err = NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256, WithCreated()).Sign(r)
+	assert.Nil(t, err)
+	var s SignatureParameters
+	assert.Nil(t, s.FromRequest(r))
+	assert.Equal(t, []string{"date", "(created)"}, s.Headers.Names())
+
+	// per request too
+	r = &http.Request{Header: http.Header{"Date": []string{testDate}}}
+	err = NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey).Sign(r, WithCreated())
+	assert.Nil(t, err)
+	assert.Nil(t, s.FromRequest(r))
+	assert.Equal(t, []string{"date", "(created)"}, s.Headers.Names())
+
+	// the date is still signed
+	r.Header.Set("Date", "Thu, 05 Jan 2014 21:31:40 GMT")
+	res, err := NewVerifier(keyLookUp, -1).VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestSignerAuthScheme(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	err = NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256, WithAuthScheme("HMAC-Signature")).Sign(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `HMAC-Signature keyId="Test",algorithm="hmac-sha256",headers="date",signature="`+testSha256Hash+`"`, r.Header.Get("Authorization"))
+	assert.Equal(t, "", r.Header.Get("Signature"))
+
+	v := NewVerifier(keyLookUp, -1)
+	v.AuthScheme = "hmac-signature"
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// another scheme is not a signature
+	v.AuthScheme = "Signature"
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrNoSignatureHeader, err)
+}
+
+func TestSignerPerRequestOptions(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	headers := make([]string, 1, 2)
+	headers[0] = "date"
+	signer := NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256, WithHeaders(headers...))
+	signer.Clock = func() time.Time { return time.Unix(1402170695, 0) }
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = signer.Sign(r, WithHeaders("(request-target)", "date"), WithExpiresIn(30*time.Second))
+	assert.Nil(t, err)
+	sig := SignatureParameters{}
+	assert.Nil(t, sig.FromRequest(r))
+	assert.Equal(t, []string{"(request-target)", "date", "(expires)"}, sig.Headers.Names())
+	assert.Equal(t, int64(1402170725), sig.Expires)
+
+	// the options don't change the signer
+	r = &http.Request{Header: http.Header{"Date": []string{testDate}}}
+	err = signer.Sign(r, WithCreated())
+	assert.Nil(t, err)
+	assert.Nil(t, sig.FromRequest(r))
+	assert.Equal(t, []string{"date", "(created)"}, sig.Headers.Names())
+
+	r = &http.Request{Header: http.Header{"Date": []string{testDate}}}
+	err = signer.Sign(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `keyId="Test",algorithm="hmac-sha256",headers="date",signature="`+testSha256Hash+`"`, r.Header.Get("Signature"))
+	assert.Equal(t, []string{"date", ""}, headers[:2])
+}
+
+func TestSignerNonce(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	signer := NewSignerWithOptions(testKeyID, key, AlgorithmHmacSha256, WithHeaders("@method"))
+	signer.Format = FormatRFC9421
+	signer.Clock = func() time.Time { return time.Unix(1618884473, 0) }
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	err = signer.Sign(r, WithNonce("b3k2pp5k7z-50gnwp.yemd"))
+	assert.Nil(t, err)
+	assert.Equal(t, `sig1=("@method");created=1618884473;nonce="b3k2pp5k7z-50gnwp.yemd";keyid="Test";alg="hmac-sha256"`, r.Header.Get("Signature-Input"))
+
+	ok, err := VerifyRequest(r, keyLookUp, -1)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+}
+
+func TestKeySignerMissingHeader(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	err = NewKeySigner(testKeyID, "hmac-sha256", testKey, "date", "digest").Sign(r)
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'digest'")
+	assert.Equal(t, "", r.Header.Get("Signature"))
+}
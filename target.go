@@ -0,0 +1,99 @@
+package httpsignatures
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TargetFunc returns the URL the client addressed, when it differs from
+// the URL of the request the verifier sees, eg behind a reverse proxy which
+// rewrites the path or host. The scheme, host, path and query of the URL are
+// used for the (request-target) and host headers and for the RFC 9421
+// derived components. An empty scheme or host keeps the one of the request.
+type TargetFunc func(r *http.Request) (*url.URL, error)
+
+// ForwardedTarget takes the target from the X-Forwarded-Proto,
+// X-Forwarded-Host and X-Forwarded-Prefix headers set by a proxy, the
+// prefix being the part of the path the proxy stripped. Only use it when
+// every request passes a proxy which sets or removes these headers, a
+// client could set them otherwise.
+func ForwardedTarget(r *http.Request) (*url.URL, error) {
+	target := *r.URL
+	if proto := firstForwarded(r.Header.Get("X-Forwarded-Proto")); proto != "" {
+		target.Scheme = proto
+	}
+	if host := firstForwarded(r.Header.Get("X-Forwarded-Host")); host != "" {
+		target.Host = host
+	}
+	if prefix := firstForwarded(r.Header.Get("X-Forwarded-Prefix")); prefix != "" {
+		target = joinPath(target, strings.TrimSuffix(prefix, "/"))
+	}
+	return &target, nil
+}
+
+// StripPathPrefix returns a TargetFunc which removes prefix from the path,
+// for a proxy which adds prefix to the path the client signed. Paths without
+// the prefix are kept.
+func StripPathPrefix(prefix string) TargetFunc {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(r *http.Request) (*url.URL, error) {
+		target := *r.URL
+		path := target.EscapedPath()
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return &target, nil
+		}
+		stripped, err := url.Parse(strings.TrimPrefix(path, prefix))
+		if err != nil {
+			return nil, err
+		}
+		target.Path, target.RawPath = stripped.Path, stripped.RawPath
+		if target.Path == "" {
+			target.Path = "/"
+		}
+		return &target, nil
+	}
+}
+
+// firstForwarded returns the first value of a comma separated forwarded
+// header, which is the one set by the proxy closest to the client
+func firstForwarded(value string) string {
+	return strings.TrimSpace(strings.SplitN(value, ",", 2)[0])
+}
+
+// joinPath returns target with prefix in front of its path
+func joinPath(target url.URL, prefix string) url.URL {
+	joined, err := url.Parse(prefix + target.EscapedPath())
+	if err != nil {
+		return target
+	}
+	target.Path, target.RawPath = joined.Path, joined.RawPath
+	return target
+}
+
+// targetRequest returns a copy of the request addressed to the URL of
+// target, or the request itself when target is nil
+func targetRequest(r *http.Request, target TargetFunc) (*http.Request, error) {
+	if target == nil || r.URL == nil {
+		return r, nil
+	}
+	u, err := target(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t := *r
+	if u.Scheme == "" {
+		u.Scheme = r.URL.Scheme
+	}
+	if u.Host == "" {
+		u.Host = r.URL.Host
+	}
+	if u.Host == "" {
+		// the server side URL has no host
+		u.Host = r.Host
+	}
+	t.URL = u
+	t.Host = u.Host
+	return &t, nil
+}
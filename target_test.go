@@ -0,0 +1,88 @@
+package httpsignatures
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// proxiedRequest signs a request to clientURL and returns the request the
+// origin receives at originURL, with the signature headers and headers
+func proxiedRequest(t *testing.T, signer *Signer, clientURL, originURL string, headers map[string]string) *http.Request {
+	r, err := http.NewRequest(http.MethodGet, clientURL, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	assert.Nil(t, signer.Sign(r))
+
+	origin := httptest.NewRequest(http.MethodGet, originURL, nil)
+	for name, values := range r.Header {
+		origin.Header[name] = values
+	}
+	for name, value := range headers {
+		origin.Header.Set(name, value)
+	}
+	return origin
+}
+
+func TestVerifyForwardedTarget(t *testing.T) {
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "host", "date")
+	r := proxiedRequest(t, signer, "https://api.example.com/api/foo?param=value", "http://backend:8080/foo?param=value", map[string]string{
+		"X-Forwarded-Proto":  "https",
+		"X-Forwarded-Host":   "api.example.com, proxy.example.com",
+		"X-Forwarded-Prefix": "/api/",
+	})
+
+	v := NewVerifier(keyLookUp, -1)
+	res, err := v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	v.Target = ForwardedTarget
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// the request itself is kept
+	assert.Equal(t, "/foo", r.URL.Path)
+	assert.Equal(t, "backend:8080", r.Host)
+}
+
+func TestVerifyForwardedTargetRFC9421(t *testing.T) {
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "@target-uri", "date")
+	signer.Format = FormatRFC9421
+	r := proxiedRequest(t, signer, "https://api.example.com/foo", "http://backend:8080/foo", map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "api.example.com",
+	})
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Target = ForwardedTarget
+	_, err := v.Verify(r)
+	assert.Nil(t, err)
+}
+
+func TestVerifyStripPathPrefix(t *testing.T) {
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "date")
+	r := proxiedRequest(t, signer, "http://example.com/foo%2Fbar?param=value", "http://example.com/v1/foo%2Fbar?param=value", nil)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Target = StripPathPrefix("/v1/")
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	strip := StripPathPrefix("/v1")
+	for path, expected := range map[string]string{
+		"/v1/foo": "/foo",
+		"/v1":     "/",
+		"/v10":    "/v10",
+		"/foo":    "/foo",
+	} {
+		u, err := strip(httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, u.Path, path)
+	}
+}
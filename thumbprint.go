@@ -0,0 +1,109 @@
+package httpsignatures
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Thumbprint computes the RFC 7638 JWK thumbprint of a public key: the
+// base64url encoded SHA-256 hash of the required JWK members in
+// lexicographic order. RSA, EC (P-256, P-384, P-521) and OKP (Ed25519) keys
+// are supported.
+func Thumbprint(publicKey crypto.PublicKey) (string, error) {
+	var jwk string
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			base64URL(big.NewInt(int64(key.E)).Bytes()), base64URL(key.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			key.Curve.Params().Name, base64URL(key.X.FillBytes(make([]byte, size))), base64URL(key.Y.FillBytes(make([]byte, size))))
+	case ed25519.PublicKey:
+		jwk = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64URL(key))
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+
+	sum := sha256.Sum256([]byte(jwk))
+	return base64URL(sum[:]), nil
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ThumbprintKeyStore resolves keyIds which are the RFC 7638 thumbprint of
+// the public key. It is a KeySet binding every key to the algorithms of its
+// key type, used as the KeyStore of a verifier it refuses eg hmac-sha256
+// signatures keyed with a public key.
+type ThumbprintKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string][]StoredKey
+}
+
+// NewThumbprintKeyStore creates an empty key store
+func NewThumbprintKeyStore() *ThumbprintKeyStore {
+	return &ThumbprintKeyStore{keys: map[string][]StoredKey{}}
+}
+
+// Add indexes the public key by its thumbprint and returns the thumbprint
+func (s *ThumbprintKeyStore) Add(publicKey crypto.PublicKey) (string, error) {
+	thumbprint, err := Thumbprint(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// PKIX for Ed25519 keys too, a raw key can't be told from a secret
+	key, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	var keys []StoredKey
+	for _, algorithm := range keyTypeAlgorithms(publicKey) {
+		keys = append(keys, StoredKey{Key: key, Algorithm: algorithm})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[thumbprint] = keys
+	return thumbprint, nil
+}
+
+// LookUpKey returns the DER encoded PKIX public key with thumbprint keyID
+// and the first algorithm of its key type, ed25519 for Ed25519 keys
+func (s *ThumbprintKeyStore) LookUpKey(keyID string) ([]byte, string, error) {
+	keys, _ := s.LookUpKeys(keyID)
+	if len(keys) == 0 {
+		return nil, "", nil
+	}
+	return keys[0].Key, keys[0].Algorithm, nil
+}
+
+// LookUpKeys returns the DER encoded PKIX public key with thumbprint keyID
+// once for every algorithm of its key type
+func (s *ThumbprintKeyStore) LookUpKeys(keyID string) ([]StoredKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]StoredKey(nil), s.keys[keyID]...), nil
+}
+
+// KeyLookUp returns the base64 encoded DER encoded PKIX public key with
+// thumbprint keyID. It can be used as the key look up of a Verifier, which
+// doesn't bind the key to its algorithm, see LookUpKey.
+func (s *ThumbprintKeyStore) KeyLookUp(keyID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if keys, ok := s.keys[keyID]; ok {
+		return base64.StdEncoding.EncodeToString(keys[0].Key), nil
+	}
+	return "", &UnknownKeyError{KeyID: keyID}
+}
@@ -0,0 +1,110 @@
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"testing"
+)
+
+func TestThumbprintRSA(t *testing.T) {
+	// example from RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	assert.Nil(t, err)
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	thumbprint, err := Thumbprint(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
+
+func TestThumbprintOKP(t *testing.T) {
+	// example from RFC 8037 appendix A.3
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	assert.Nil(t, err)
+
+	thumbprint, err := Thumbprint(ed25519.PublicKey(x))
+	assert.Nil(t, err)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", thumbprint)
+}
+
+func TestThumbprintEC(t *testing.T) {
+	// the P-256 key of RFC 7515 appendix A.3, thumbprint computed as in
+	// RFC 7638 section 3.1
+	x, err := base64.RawURLEncoding.DecodeString("f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU")
+	assert.Nil(t, err)
+	y, err := base64.RawURLEncoding.DecodeString("x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0")
+	assert.Nil(t, err)
+	thumbprint, err := Thumbprint(&ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)})
+	assert.Nil(t, err)
+	assert.Equal(t, "oKIywvGUpTVTyxMQ3bwIIeQUudfr_CkLMjCE19ECD-U", thumbprint)
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.Nil(t, err)
+
+		thumbprint, err := Thumbprint(&key.PublicKey)
+		assert.Nil(t, err)
+		assert.Equal(t, 43, len(thumbprint))
+
+		again, err := Thumbprint(&key.PublicKey)
+		assert.Nil(t, err)
+		assert.Equal(t, thumbprint, again)
+	}
+}
+
+func TestThumbprintUnsupportedKey(t *testing.T) {
+	_, err := Thumbprint([]byte(testKey))
+	assert.Equal(t, ErrUnsupportedKeyType, err)
+}
+
+func TestThumbprintKeyStore(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	store := NewThumbprintKeyStore()
+	keyID, err := store.Add(pub)
+	assert.Nil(t, err)
+
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	signer := NewSigner("ed25519")
+	err = signer.SignRequest(r, keyID, base64.StdEncoding.EncodeToString(priv))
+	assert.Nil(t, err)
+
+	res, err := VerifyRequest(r, store.KeyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v := NewVerifier(nil, -1)
+	v.KeyStore = store
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	_, err = store.KeyLookUp("unknown")
+	assert.EqualError(t, err, ErrorUnknownKeyID)
+	key, algorithm, err := store.LookUpKey(keyID)
+	assert.Nil(t, err)
+	assert.Equal(t, AlgorithmEd25519, algorithm)
+	parsed, err := x509.ParsePKIXPublicKey(key)
+	assert.Nil(t, err)
+	assert.Equal(t, pub, parsed)
+
+	// an HMAC signature keyed with the public key
+	r.Header.Del("Signature")
+	assert.Nil(t, NewSigner(AlgorithmHmacSha256).SignRequestKey(r, keyID, pub))
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+}
@@ -0,0 +1,85 @@
+package httpsignatures
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SigningTransport is a http.RoundTripper which signs every request before
+// passing it to Base. It can be plugged into any http.Client.
+type SigningTransport struct {
+	// Base sends the signed requests, http.DefaultTransport when nil
+	Base http.RoundTripper
+
+	signer *Signer
+}
+
+// NewSigningTransport creates a transport signing the headers of every
+// request with the base64 encoded key
+func NewSigningTransport(keyID string, algorithm string, keyB64 string, headers ...string) *SigningTransport {
+	return &SigningTransport{
+		signer: NewKeySigner(keyID, algorithm, keyB64, headers...),
+	}
+}
+
+// NewSignerTransport creates a transport signing every request with signer,
+// which must be created with NewKeySigner, eg to set DigestAlgorithms
+func NewSignerTransport(signer *Signer) *SigningTransport {
+	return &SigningTransport{
+		signer: signer,
+	}
+}
+
+// RoundTrip signs a copy of the request, setting the Date header when it is
+// missing, and sends it. When the signer covers a digest header the request
+// doesn't have, the Digest and Content-Digest headers of the body are added.
+// The request of the caller is not modified.
+func (t *SigningTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	signed := r.Clone(r.Context())
+	if signed.Header == nil {
+		signed.Header = http.Header{}
+	}
+	if signed.Header.Get("Date") == "" {
+		signed.Header.Set("Date", t.signer.now().UTC().Format(http.TimeFormat))
+	}
+
+	err := t.addDigests(signed)
+	if err == nil {
+		err = t.signer.Sign(signed)
+	}
+	if err != nil {
+		// a RoundTripper must always close the body
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+
+	return t.base().RoundTrip(signed)
+}
+
+// addDigests adds the digest headers covered by the signer which are
+// missing from the request
+func (t *SigningTransport) addDigests(r *http.Request) error {
+	if len(t.signer.DigestAlgorithms) > 0 {
+		// added by the signer
+		return nil
+	}
+	for _, header := range t.signer.headers {
+		header = strings.ToLower(header)
+		if header != HeaderDigest && header != HeaderContentDigest {
+			continue
+		}
+		if r.Header.Get(header) == "" {
+			return AddDigests(r)
+		}
+	}
+	return nil
+}
+
+func (t *SigningTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
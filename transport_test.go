@@ -0,0 +1,141 @@
+package httpsignatures
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSigningTransport(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: NewSigningTransport(testKeyID, "hmac-sha256", testKey, "(request-target)", "date"),
+	}
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/foo", nil)
+	assert.Nil(t, err)
+	resp, err := client.Do(r)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	// the request of the caller is not signed in place
+	assert.Equal(t, "", r.Header.Get("Signature"))
+	assert.Equal(t, "", r.Header.Get("Date"))
+
+	assert.NotEqual(t, "", received.Header.Get("Date"))
+	assert.Contains(t, received.Header.Get("Signature"), `headers="(request-target) date"`)
+	res, err := VerifyRequest(received, keyLookUp, -1, "(request-target)", "date")
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSigningTransportKeepsDate(t *testing.T) {
+	var received *http.Request
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		received = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	transport := NewSigningTransport(testKeyID, "hmac-sha256", testKey)
+	transport.Base = base
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	_, err = transport.RoundTrip(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, testDate, received.Header.Get("Date"))
+	res, err := VerifyRequest(received, keyLookUp, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSigningTransportSignError(t *testing.T) {
+	transport := NewSigningTransport(testKeyID, "hmac-sha256", testKey, "content-type")
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Error("unsigned request sent")
+		return nil, nil
+	})
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(r)
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'content-type'")
+}
+
+func TestSigningTransportAddsDigest(t *testing.T) {
+	var received *http.Request
+	transport := NewSigningTransport(testKeyID, "hmac-sha256", testKey, "date", "digest")
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		received = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", r.Header.Get("Digest"))
+	assert.Equal(t, testBodyDigest, received.Header.Get("Digest"))
+	v := NewVerifier(keyLookUp, -1, "digest")
+	v.CheckDigest = true
+	res, err := v.VerifyRequest(received)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestSignerTransport(t *testing.T) {
+	var received *http.Request
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "date")
+	signer.DigestAlgorithms = []string{"SHA-512"}
+	transport := NewSignerTransport(signer)
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		received = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "SHA-512="+testBodySha512, received.Header.Get("Digest"))
+	assert.Contains(t, received.Header.Get("Signature"), `headers="date digest"`)
+}
+
+func TestSignerTransportRFC9421Digest(t *testing.T) {
+	var received *http.Request
+	signer := NewKeySigner(testKeyID, "hmac-sha256", testKey, "@method", "content-digest")
+	signer.Format = FormatRFC9421
+	signer.DigestAlgorithms = []string{"SHA-256"}
+	transport := NewSignerTransport(signer)
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		received = r
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, testBodyContentDigest, received.Header.Get("Content-Digest"))
+	v := NewVerifier(keyLookUp, -1, "content-digest")
+	v.CheckDigest = true
+	res, err := v.VerifyRequest(received)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,734 @@
+package httpsignatures
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Verifier holds the policy used to verify signed requests
+type Verifier struct {
+	// KeyLookUp returns the base64 encoded key belonging to keyID, an empty
+	// key is reported as *UnknownKeyError
+	KeyLookUp func(keyID string) (string, error)
+	// KeyResolver, when set, is used instead of KeyLookUp and also receives
+	// the algorithm of the signature, eg to pick a key from a JWKS
+	KeyResolver KeyResolver
+	// RawKeyLookUp, when set, is used instead of KeyResolver and KeyLookUp
+	// and returns the raw key, see KeyBytes for parsed keys
+	RawKeyLookUp KeyLookupFunc
+	// KeyStore, when set, is used instead of the key look ups, and rejects
+	// signatures with another algorithm than the key is bound to with
+	// ErrAlgorithmKeyMismatch
+	KeyStore KeyStore
+	// AllowedClockSkew is the maximum difference in seconds between the
+	// signed date header and the verifier clock, set to -1 to disable the
+	// check. A signed created parameter, of RFC 9421 signatures or
+	// draft-cavage signatures covering (created), is used instead of the
+	// date header, which eg a proxy may have rewritten. Exceeding it is
+	// reported as *ClockSkewError.
+	AllowedClockSkew int
+	// RequiredHeaders must all be covered by the signature, eg
+	// "(request-target)", "date" and "digest", so a signature stripped down
+	// to covering only the date header is rejected
+	RequiredHeaders []string
+	// RequireExactHeaders, when set, must match the signed headers exactly:
+	// signatures covering more or fewer headers are rejected
+	RequireExactHeaders []string
+	// MinSignedHeaders rejects signatures covering fewer headers, regardless
+	// of which headers they are
+	MinSignedHeaders int
+	// XPrefixAliases lists headers for which the "X-" prefix is optional,
+	// eg while migrating from "X-Request-Id" to "Request-Id" a signature
+	// over either name verifies when the request carries the other one
+	XPrefixAliases []string
+	// CanonicalTarget normalizes the path of the (request-target) before
+	// verifying, see canonicalPath. The signer needs the same setting.
+	CanonicalTarget bool
+	// Canonicalizers override the canonicalization of the values of a
+	// header, by lowercase header name. The signer needs the same setting.
+	Canonicalizers map[string]Canonicalizer
+	// DefaultHeaders are the headers a signature without headers parameter
+	// covers, "date" when nil. Set RequireHeadersParameter to reject such
+	// signatures instead: an attacker who strips the headers parameter
+	// would otherwise get away with a signature covering only the default.
+	DefaultHeaders          []string
+	RequireHeadersParameter bool
+	// TLSClientKeyID binds the signature to the transport identity: when set
+	// it returns the keyId expected for the TLS client certificate of the
+	// request, and requests without a client certificate or signed with
+	// another keyId are rejected
+	TLSClientKeyID func(cert *x509.Certificate) string
+	// ValidateTimestamps rejects signatures whose expires parameter is in the
+	// past, or whose created parameter is in the future, allowing for
+	// TimestampSkew of clock difference. NewVerifier enables it.
+	ValidateTimestamps bool
+	TimestampSkew      time.Duration
+	// Clock returns the current time, time.Now when nil
+	Clock func() time.Time
+	// CheckDigest checks the body against the Digest and Content-Digest
+	// headers after the signature verified, when the signature covers one
+	CheckDigest bool
+	// StreamDigest makes CheckDigest check the body while the next handler
+	// reads it instead of buffering it first, see StreamDigest. A mismatch
+	// is then returned by r.Body.Read instead of by the verifier.
+	StreamDigest bool
+	// Target returns the URL the client signed when a proxy in front of the
+	// verifier rewrote it, see ForwardedTarget and StripPathPrefix. Its
+	// scheme and host override the ones reconstructed from the request for
+	// the "@target-uri", "@scheme" and "@authority" components, eg behind a
+	// TLS terminating proxy. The request itself is not modified.
+	Target TargetFunc
+	// Observer, when set, is notified of every request the verifier checks
+	Observer Observer
+	// AuthScheme is the scheme of the Authorization header carrying the
+	// signature, case insensitive, "Signature" when empty
+	AuthScheme string
+	// MaxBodyMemory is the number of body bytes VerifyRequestStrict and
+	// CheckDigest buffer in memory before spilling to a temporary file, 0
+	// means 1MB
+	MaxBodyMemory int64
+	// MaxBody is the largest body VerifyRequestStrict and CheckDigest read,
+	// larger ones fail with ErrBodyTooLarge. 0 means DefaultMaxBody, a
+	// negative value any size.
+	MaxBody int64
+	// MaxSignatures is the most signatures VerifyAny and VerifyAll verify,
+	// requests carrying more fail with ErrTooManySignatures before any is
+	// verified. 0 means DefaultMaxSignatures, a negative value any number.
+	MaxSignatures int
+	// LenientTimestamps accepts quoted RFC 3339 date-times, eg
+	// created="2021-04-20T02:07:55Z", besides Unix timestamps for the
+	// created and expires parameters of draft-cavage signatures, for
+	// clients which don't follow the draft. The signing string holds the
+	// Unix timestamp.
+	LenientTimestamps bool
+	// Format selects the signature formats accepted: FormatAuto verifies the
+	// RFC 9421 signature when the request has a Signature-Input header and
+	// falls back to draft-cavage otherwise
+	Format SignatureFormat
+	// SignatureLabel selects the RFC 9421 signature to verify, the first
+	// one when empty
+	SignatureLabel string
+	// Realm is sent in the WWW-Authenticate challenge of Middleware
+	Realm string
+	// ReplayCache, when set, rejects signatures which were accepted before
+	// with ErrSignatureReplayed
+	ReplayCache ReplayCache
+	// RejectAlgorithmConfusion rejects HMAC signatures when the looked up key
+	// is a PEM or DER encoded public key, so a client can't sign with the
+	// public key of an asymmetric algorithm as HMAC secret. Raw Ed25519
+	// public keys look like any 32 byte secret: bind them to ed25519 with a
+	// KeyStore, eg MemoryKeyStore, which rejects the signatures of other
+	// algorithms by itself. NewVerifier enables it.
+	RejectAlgorithmConfusion bool
+}
+
+const defaultMaxBodyMemory = 1 << 20
+
+// KeyResolver returns the base64 encoded key belonging to keyID, for a
+// signature with algorithm. It reports an unknown keyID with an empty key or
+// an error wrapping ErrUnknownKeyID.
+type KeyResolver func(keyID string, algorithm string) (string, error)
+
+// KeyLookupFunc returns the raw key belonging to keyID, eg fetched from a
+// database or a cache at verification time. It reports an unknown keyID with
+// an empty key or an error wrapping ErrUnknownKeyID.
+type KeyLookupFunc func(keyID string) ([]byte, error)
+
+// NewVerifier creates a verifier which requires headers to be signed. It
+// rejects expired signatures, and signatures created in the future.
+func NewVerifier(keyLookUp func(keyID string) (string, error), allowedClockSkew int, headers ...string) *Verifier {
+	return &Verifier{
+		KeyLookUp:          keyLookUp,
+		AllowedClockSkew:   allowedClockSkew,
+		RequiredHeaders:    headers,
+		ValidateTimestamps: true,
+
+		RejectAlgorithmConfusion: true,
+	}
+}
+
+// NewKeyVerifier creates a verifier which looks up raw keys with keyLookUp
+// and requires headers to be signed, see NewVerifier
+func NewKeyVerifier(keyLookUp KeyLookupFunc, allowedClockSkew int, headers ...string) *Verifier {
+	v := NewVerifier(nil, allowedClockSkew, headers...)
+	v.RawKeyLookUp = keyLookUp
+	return v
+}
+
+// VerifyRequest verifies the signature added to the request and returns true if it is OK
+func VerifyRequest(r *http.Request, keyLookUp func(keyID string) (string, error), allowedClockSkew int, headers ...string) (bool, error) {
+	return NewVerifier(keyLookUp, allowedClockSkew, headers...).VerifyRequest(r)
+}
+
+// VerifyRequestWithResolver verifies the signature added to the request,
+// looking up the key of the parsed keyId and algorithm with resolver, and
+// returns true if it is OK. An unknown key is reported as *UnknownKeyError.
+func VerifyRequestWithResolver(r *http.Request, resolver KeyResolver, allowedClockSkew int, headers ...string) (bool, error) {
+	v := NewVerifier(nil, allowedClockSkew, headers...)
+	v.KeyResolver = resolver
+	return v.VerifyRequest(r)
+}
+
+// VerifyRequest verifies the signature added to the request against the
+// verifier policy and returns true if it is OK
+func (v Verifier) VerifyRequest(r *http.Request) (bool, error) {
+	_, ok, err := v.verifyRequest(r, v.checks(), v.checkDigest(r))
+	return ok, err
+}
+
+// Verify verifies the signature added to the request against the verifier
+// policy and describes the verified signature, eg the keyId to authorize
+func (v Verifier) Verify(r *http.Request) (*VerifyResult, error) {
+	sig, ok, err := v.verifyRequest(r, v.checks(), v.checkDigest(r))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSignatureMismatch
+	}
+
+	result := newVerifyResult(sig)
+	if v.CheckDigest && (sig.Covers(HeaderDigest) || sig.Covers(HeaderContentDigest)) {
+		// a streamed body is only checked once the next handler read it
+		result.DigestVerified = !v.StreamDigest
+		result.DigestPending = v.StreamDigest
+	}
+	return result, nil
+}
+
+// VerifyComplete verifies the request like VerifyRequest and additionally
+// requires the signature to cover every security relevant part of the
+// request: the method and path through (request-target), the host, and the
+// body through a digest header when the request has a body. The error
+// names the first field which is not covered.
+func (v Verifier) VerifyComplete(r *http.Request) (bool, error) {
+	_, ok, err := v.verifyRequest(r, append(v.checks(), checkCompleteCoverage), v.checkDigest(r))
+	return ok, err
+}
+
+// VerifyRequestStrict is the secure default for verifying a request in one
+// call. On top of the verifier policy it requires a signed Digest or
+// Content-Digest header when the request has a body, and checks every
+// digest header present against the body before the ReplayCache remembers
+// the signature. The body is read once, and remains readable for the next
+// handler.
+func (v Verifier) VerifyRequestStrict(r *http.Request) (*VerifyResult, error) {
+	// all digests are checked, whether signed or not
+	digestVerified := false
+	checkDigest := func(sig SignatureParameters) error {
+		if len(r.Header[http.CanonicalHeaderKey(HeaderDigest)]) == 0 && len(r.Header[http.CanonicalHeaderKey(HeaderContentDigest)]) == 0 {
+			return nil
+		}
+		if err := VerifyDigestLimit(r, v.maxBodyMemory(), v.MaxBody); err != nil {
+			return err
+		}
+		digestVerified = true
+		return nil
+	}
+	sig, ok, err := v.verifyRequest(r, append(v.checks(), checkDigestCoverage), checkDigest)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSignatureMismatch
+	}
+
+	result := newVerifyResult(sig)
+	result.DigestVerified = digestVerified
+	return result, nil
+}
+
+// VerifyResult describes a verified request
+type VerifyResult struct {
+	// KeyID is the keyId of the verified signature
+	KeyID string
+	// Algorithm is the name of the signature algorithm
+	Algorithm string
+	// Headers are the headers covered by the signature
+	Headers []string
+	// DigestVerified is set when the body was checked against its digest
+	DigestVerified bool
+	// DigestPending is set instead when StreamDigest checks the body while
+	// it is read: reading it to the end fails with ErrDigestMismatch when
+	// it doesn't match
+	DigestPending bool
+	// Created and Expires are the created and expires parameters of the
+	// signature, zero when it has none
+	Created time.Time
+	Expires time.Time
+}
+
+func newVerifyResult(sig SignatureParameters) *VerifyResult {
+	result := &VerifyResult{
+		KeyID:     sig.KeyID,
+		Algorithm: sig.Algorithm.Name,
+		Headers:   sig.Headers.Names(),
+	}
+	if sig.Created != 0 {
+		result.Created = time.Unix(sig.Created, 0)
+	}
+	if sig.Expires != 0 {
+		result.Expires = time.Unix(sig.Expires, 0)
+	}
+	return result
+}
+
+func (v Verifier) verifyRequest(r *http.Request, checks []func(r *http.Request, sig SignatureParameters) error, checkDigest func(sig SignatureParameters) error) (SignatureParameters, bool, error) {
+	if v.Observer == nil {
+		return v.verifyRequestUnobserved(r, checks, checkDigest)
+	}
+
+	v.Observer.OnVerifyStart(r)
+	start := time.Now()
+	sig, ok, err := v.verifyRequestUnobserved(r, checks, checkDigest)
+	v.observeVerify(r, sig, ok, err, time.Since(start))
+	return sig, ok, err
+}
+
+// observeVerify notifies the observer of a verification
+func (v Verifier) observeVerify(r *http.Request, sig SignatureParameters, ok bool, err error, duration time.Duration) {
+	if err == nil && !ok {
+		err = ErrSignatureMismatch
+	}
+	event := SignatureEvent{KeyID: sig.KeyID, Duration: duration, Err: err}
+	if sig.Algorithm != nil {
+		event.Algorithm = sig.Algorithm.Name
+	}
+	v.Observer.OnVerifyDone(r, event)
+}
+
+func (v Verifier) verifyRequestUnobserved(r *http.Request, checks []func(r *http.Request, sig SignatureParameters) error, checkDigest func(sig SignatureParameters) error) (SignatureParameters, bool, error) {
+	sig := SignatureParameters{}
+
+	t, err := targetRequest(r, v.Target)
+	if err != nil {
+		return sig, false, err
+	}
+	if err := sig.fromMessage(RequestMessage(t), v.requestOptions()); err != nil {
+		return sig, false, err
+	}
+
+	ok, err := v.verifyChecked(r, sig, checks, checkDigest)
+	return sig, ok, err
+}
+
+func (v Verifier) verifyParsed(r *http.Request, sig SignatureParameters, checks []func(r *http.Request, sig SignatureParameters) error) (bool, error) {
+	return v.verifyChecked(r, sig, checks, v.checkDigest(r))
+}
+
+// checkDigest returns the CheckDigest check of the body of r, nil without
+// CheckDigest
+func (v Verifier) checkDigest(r *http.Request) func(sig SignatureParameters) error {
+	if !v.CheckDigest {
+		return nil
+	}
+	return func(sig SignatureParameters) error {
+		if !sig.Covers(HeaderDigest) && !sig.Covers(HeaderContentDigest) {
+			return nil
+		}
+		if v.StreamDigest {
+			return StreamDigest(r)
+		}
+		return VerifyDigestLimit(r, v.maxBodyMemory(), v.MaxBody)
+	}
+}
+
+// verifyChecked runs the checks on the parsed signature of r, which is nil
+// for a Message, and verifies it. checkDigest, when set, checks the body
+// before the signature is remembered by the replay cache, so a request with
+// a tampered body can't use up a valid signature.
+func (v Verifier) verifyChecked(r *http.Request, sig SignatureParameters, checks []func(r *http.Request, sig SignatureParameters) error, checkDigest func(sig SignatureParameters) error) (bool, error) {
+	for _, check := range checks {
+		if err := check(r, sig); err != nil {
+			return false, err
+		}
+	}
+
+	ok, err := v.verifySignature(sig)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	if checkDigest != nil {
+		if err := checkDigest(sig); err != nil {
+			return false, err
+		}
+	}
+
+	// only accepted signatures are remembered
+	if err := v.checkReplay(sig); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VerifyAny verifies every signature of a request carrying several
+// Signature headers against the verifier policy, and returns the first one
+// which verifies. Signatures by keyIds the key look up doesn't know are
+// skipped, so it succeeds when at least one signature by an allowed keyId is
+// valid. When none verifies the error of the first signature is returned.
+func (v Verifier) VerifyAny(r *http.Request) (SignatureParameters, error) {
+	if v.Observer == nil {
+		return v.verifyAny(r)
+	}
+
+	v.Observer.OnVerifyStart(r)
+	start := time.Now()
+	sig, err := v.verifyAny(r)
+	v.observeVerify(r, sig, err == nil, err, time.Since(start))
+	return sig, err
+}
+
+func (v Verifier) verifyAny(r *http.Request) (SignatureParameters, error) {
+	t, err := targetRequest(r, v.Target)
+	if err != nil {
+		return SignatureParameters{}, err
+	}
+	signatures, err := signaturesFromMessage(RequestMessage(t), v.requestOptions())
+	if err != nil {
+		return SignatureParameters{}, err
+	}
+
+	var firstErr error
+	for _, sig := range signatures {
+		ok, err := v.verifyParsed(r, sig, v.checks())
+		if ok && err == nil {
+			return sig, nil
+		}
+		if err == nil {
+			err = ErrSignatureMismatch
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return SignatureParameters{}, firstErr
+}
+
+// SignatureResult is the outcome of verifying one of the signatures of a
+// request
+type SignatureResult struct {
+	// Parameters of the signature, eg its keyId
+	Parameters SignatureParameters
+	// Err is nil when the signature verified
+	Err error
+}
+
+// VerifyAll verifies every signature of a request, eg one added by a
+// gateway and one by the origin, each against its own key and the verifier
+// policy, and returns a result per signature in the order of the headers.
+// The error is only set when the signatures can't be parsed.
+func (v Verifier) VerifyAll(r *http.Request) ([]SignatureResult, error) {
+	t, err := targetRequest(r, v.Target)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := signaturesFromMessage(RequestMessage(t), v.requestOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SignatureResult, len(signatures))
+	for i, sig := range signatures {
+		ok, err := v.verifyParsed(r, sig, v.checks())
+		if err == nil && !ok {
+			err = ErrSignatureMismatch
+		}
+		results[i] = SignatureResult{Parameters: sig, Err: err}
+	}
+	return results, nil
+}
+
+// VerifyDiagnose runs the same checks as VerifyRequest, but instead of
+// stopping at the first failure it returns every problem it finds. It
+// returns nil when the request verifies.
+func (v Verifier) VerifyDiagnose(r *http.Request) []error {
+	sig := SignatureParameters{}
+
+	// without signature parameters there is nothing left to check
+	if err := sig.parseSignatureHeader(RequestMessage(r), v.requestOptions()); err != nil {
+		return []error{err}
+	}
+
+	t, err := targetRequest(r, v.Target)
+	if err != nil {
+		return []error{err}
+	}
+	errs := sig.loadHeaders(RequestMessage(t), v.requestOptions())
+	headersLoaded := len(errs) == 0
+
+	for _, check := range v.checks() {
+		if err := check(r, sig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// the signing string can only be built when all headers are loaded
+	if headersLoaded {
+		if _, err := v.verifySignature(sig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// StripSignature removes all signatures from the request like the
+// StripSignature function, the Authorization headers it removes are the
+// ones using the AuthScheme of the verifier
+func (v Verifier) StripSignature(r *http.Request) {
+	stripSignature(r, v.AuthScheme)
+}
+
+// checks returns the policy checks on the request and its parsed signature
+func (v Verifier) checks() []func(r *http.Request, sig SignatureParameters) error {
+	return []func(r *http.Request, sig SignatureParameters) error{
+		v.checkHeaders,
+		v.checkClockSkew,
+		v.checkTimestamps,
+		v.checkTLSClient,
+	}
+}
+
+func (v Verifier) verifySignature(sig SignatureParameters) (bool, error) {
+	if set, ok := v.KeyStore.(KeySet); ok {
+		return v.verifyKeySet(set, sig)
+	}
+	key, algorithm, err := v.lookUpKey(sig)
+	if err != nil {
+		return false, err
+	}
+	return v.verifyKey(sig, key, algorithm)
+}
+
+// verifyKey verifies the signature with the raw key, bound to algorithm
+// when it is not empty
+func (v Verifier) verifyKey(sig SignatureParameters, key []byte, algorithm string) (bool, error) {
+	var err error
+	if sig.Algorithm == algorithmHs2019 {
+		if sig.Algorithm, err = hs2019Algorithm(key, algorithm); err != nil {
+			return false, err
+		}
+	}
+	// a key bound to an HMAC algorithm by a key store is a secret
+	if v.RejectAlgorithmConfusion && algorithm == "" && isHmacAlgorithm(sig.Algorithm.Name) && isPublicKey(key) {
+		return false, ErrAlgorithmKeyMismatch
+	}
+	return sig.VerifyKey(key)
+}
+
+// lookUpKey returns the raw key for the keyId of the signature, and the
+// algorithm the key is bound to when it is known
+func (v Verifier) lookUpKey(sig SignatureParameters) ([]byte, string, error) {
+	if v.KeyStore != nil {
+		return v.lookUpPinnedKey(sig)
+	}
+	if v.RawKeyLookUp != nil {
+		key, err := v.RawKeyLookUp(sig.KeyID)
+		if err == nil && len(key) == 0 {
+			err = &UnknownKeyError{KeyID: sig.KeyID}
+		}
+		return key, "", err
+	}
+
+	var keyB64 string
+	var err error
+	if v.KeyResolver != nil {
+		keyB64, err = v.KeyResolver(sig.KeyID, sig.Algorithm.Name)
+	} else {
+		keyB64, err = v.KeyLookUp(sig.KeyID)
+	}
+	if err == nil && keyB64 == "" {
+		err = &UnknownKeyError{KeyID: sig.KeyID}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return nil, "", ErrInvalidKeyEncoding
+	}
+	return key, "", nil
+}
+
+// UnknownKeyError is returned when no key is found for the keyId of a
+// signature, so callers can tell unknown clients apart from bad signatures
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return ErrorUnknownKeyID
+}
+
+func (e *UnknownKeyError) Unwrap() error {
+	return ErrUnknownKeyID
+}
+
+func (v Verifier) requestOptions() requestOptions {
+	return requestOptions{
+		xPrefixAliases:          v.XPrefixAliases,
+		canonicalTarget:         v.CanonicalTarget,
+		canonicalizers:          v.Canonicalizers,
+		defaultHeaders:          v.DefaultHeaders,
+		requireHeadersParameter: v.RequireHeadersParameter,
+		format:                  v.Format,
+		label:                   v.SignatureLabel,
+		authScheme:              v.AuthScheme,
+		maxSignatures:           v.MaxSignatures,
+		lenientTimestamps:       v.LenientTimestamps,
+	}
+}
+
+func (v Verifier) checkHeaders(r *http.Request, sig SignatureParameters) error {
+	for _, header := range v.RequiredHeaders {
+		// a covered header may have an empty value
+		if _, ok := sig.Headers.Get(header); !ok {
+			return ErrRequiredHeaderNotSigned
+		}
+	}
+
+	if len(sig.Headers) < v.MinSignedHeaders {
+		return ErrTooFewSignedHeaders
+	}
+
+	if v.RequireExactHeaders != nil {
+		exact := map[string]bool{}
+		for _, header := range v.RequireExactHeaders {
+			exact[strings.ToLower(header)] = true
+		}
+		signed := map[string]bool{}
+		for _, header := range sig.Headers {
+			if !exact[header.Name] {
+				return ErrSignedHeadersMismatch
+			}
+			signed[header.Name] = true
+		}
+		if len(signed) != len(exact) {
+			return ErrSignedHeadersMismatch
+		}
+	}
+	return nil
+}
+
+func (v Verifier) checkClockSkew(r *http.Request, sig SignatureParameters) error {
+	if v.AllowedClockSkew > -1 {
+		if v.AllowedClockSkew == 0 {
+			return ErrMisconfiguredClockSkew
+		}
+		if sig.signedCreated() {
+			return v.checkSkew(time.Unix(sig.Created, 0))
+		}
+		// check if difference between date and date.Now exceeds allowedClockSkew
+		if date, _ := sig.Headers.Get("date"); len(date) != 0 {
+			if hdrDate, err := time.Parse(time.RFC1123, date); err == nil {
+				return v.checkSkew(hdrDate)
+			} else {
+				return ErrInvalidDateHeader
+			}
+
+		} else {
+			return ErrMissingDateHeader
+		}
+	}
+	return nil
+}
+
+// checkSkew returns a *ClockSkewError when date is further from the verifier
+// clock than AllowedClockSkew
+func (v Verifier) checkSkew(date time.Time) error {
+	skew := v.now().Sub(date)
+	if skew < 0 {
+		skew = -skew
+	}
+	if (int)(skew.Seconds()) > (v.AllowedClockSkew) {
+		return &ClockSkewError{Date: date, Skew: v.now().Sub(date)}
+	}
+	return nil
+}
+
+// ClockSkewError is returned when the signed Date header, or the signed
+// created parameter, is further from the verifier clock than
+// AllowedClockSkew, in the past or in the future. It wraps
+// ErrClockSkewExceeded.
+type ClockSkewError struct {
+	// Date is the signed date or creation time
+	Date time.Time
+	// Skew is how far the verifier clock is ahead of Date, negative for a
+	// date in the future
+	Skew time.Duration
+}
+
+func (e *ClockSkewError) Error() string {
+	return ErrorAllowedClockskewExceeded
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return ErrClockSkewExceeded
+}
+
+func (v Verifier) checkTimestamps(r *http.Request, sig SignatureParameters) error {
+	if !v.ValidateTimestamps {
+		return nil
+	}
+	now := v.now()
+	if sig.Expires != 0 && now.After(time.Unix(sig.Expires, 0).Add(v.TimestampSkew)) {
+		return ErrSignatureExpired
+	}
+	if sig.Created != 0 && time.Unix(sig.Created, 0).After(now.Add(v.TimestampSkew)) {
+		return ErrSignatureCreatedInTheFuture
+	}
+	return nil
+}
+
+func (v Verifier) maxBodyMemory() int64 {
+	if v.MaxBodyMemory == 0 {
+		return defaultMaxBodyMemory
+	}
+	return v.MaxBodyMemory
+}
+
+func (v Verifier) now() time.Time {
+	if v.Clock != nil {
+		return v.Clock()
+	}
+	return time.Now()
+}
+
+func (v Verifier) checkTLSClient(r *http.Request, sig SignatureParameters) error {
+	if v.TLSClientKeyID == nil {
+		return nil
+	}
+	if r == nil || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ErrNoTLSClientCertificate
+	}
+	if v.TLSClientKeyID(r.TLS.PeerCertificates[0]) != sig.KeyID {
+		return ErrKeyIDTLSClientMismatch
+	}
+	return nil
+}
+
+func checkCompleteCoverage(r *http.Request, sig SignatureParameters) error {
+	for _, header := range []string{HeaderRequestTarget, HeaderHost} {
+		if _, ok := sig.Headers.Get(header); !ok {
+			return fmt.Errorf("%w '%s'", ErrCriticalFieldNotSigned, header)
+		}
+	}
+	return checkDigestCoverage(r, sig)
+}
+
+// checkDigestCoverage requires a signed digest header for requests with a body
+func checkDigestCoverage(r *http.Request, sig SignatureParameters) error {
+	if r.Body != nil && r.ContentLength != 0 {
+		_, digest := sig.Headers.Get(HeaderDigest)
+		_, contentDigest := sig.Headers.Get(HeaderContentDigest)
+		if !digest && !contentDigest {
+			return fmt.Errorf("%w '%s'", ErrCriticalFieldNotSigned, HeaderDigest)
+		}
+	}
+	return nil
+}
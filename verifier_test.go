@@ -0,0 +1,1045 @@
+package httpsignatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyRequireExactHeaders(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+
+	v.RequireExactHeaders = []string{"Date"}
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// fewer headers than signed
+	v.RequireExactHeaders = []string{}
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignedHeadersDoNotMatchRequiredSet)
+
+	// more headers than signed
+	v.RequireExactHeaders = []string{"(request-target)", "date"}
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorSignedHeadersDoNotMatchRequiredSet)
+
+	// same size, different headers
+	v.RequireExactHeaders = []string{"host"}
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorSignedHeadersDoNotMatchRequiredSet)
+}
+
+func TestVerifyRequiredHeaders(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Set("X-Empty", "")
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	required := []string{"(request-target)", "Date", "Digest"}
+
+	// coverage stripped down to the date header
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	res, err := VerifyRequest(r, keyLookUp, -1, required...)
+	assert.False(t, res)
+	assert.ErrorIs(t, err, ErrRequiredHeaderNotSigned)
+
+	// a covered header with an empty value counts
+	r.Header.Del("Signature")
+	err = NewSigner(AlgorithmHmacSha256, "(request-target)", "date", "digest", "x-empty").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	res, err = VerifyRequest(r, keyLookUp, -1, append(required, "x-empty")...)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyXPrefixAliases(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Set("X-Request-Id", "42")
+
+	// signed before the rename
+	signer := NewSigner("hmac-sha256", "x-request-id")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	// the request is forwarded with the new header name
+	r.Header.Set("Request-Id", "42")
+	r.Header.Del("X-Request-Id")
+
+	v := NewVerifier(keyLookUp, -1)
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'x-request-id'")
+
+	v.XPrefixAliases = []string{"Request-Id"}
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyXPrefixAliasesUnprefixedSignature(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Request-Id", "42")
+
+	signer := NewSigner("hmac-sha256", "request-id")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	r.Header.Set("X-Request-Id", "42")
+	r.Header.Del("Request-Id")
+
+	v := NewVerifier(keyLookUp, -1)
+	v.XPrefixAliases = []string{"x-request-id"}
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// aliases only apply to the configured headers
+	v.XPrefixAliases = []string{"x-correlation-id"}
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorMissingRequiredHeader+" 'request-id'")
+}
+
+func TestVerifyCanonicalTarget(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/a/./b", nil)
+	assert.Nil(t, err)
+
+	signer := NewSigner("hmac-sha256", "(request-target)")
+	signer.CanonicalTarget = true
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.CanonicalTarget = true
+
+	// equivalent representations verify
+	for _, path := range []string{"/a/./b", "/a//b", "/a/b", "/a/c/../b"} {
+		r.URL.Path = path
+		res, err := v.VerifyRequest(r)
+		assert.True(t, res, path)
+		assert.Nil(t, err, path)
+	}
+
+	// a different path does not
+	r.URL.Path = "/a/../b"
+	res, err := v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyDiagnoseValidRequest(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	errs := NewVerifier(keyLookUp, -1, "date").VerifyDiagnose(r)
+	assert.Nil(t, errs)
+}
+
+func TestVerifyDiagnoseReportsAllFailures(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{"Thu, 05 Jan 2012 21:31:40 GMT"},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	// tampered header, outdated date and a required header which is not signed
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+
+	errs := NewVerifier(keyLookUp, 300, "(request-target)").VerifyDiagnose(r)
+	assert.Equal(t, 3, len(errs))
+	assert.EqualError(t, errs[0], ErrorRequiredHeaderNotInHeaderList)
+	assert.EqualError(t, errs[1], ErrorAllowedClockskewExceeded)
+	assert.EqualError(t, errs[2], ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyDiagnoseMissingHeaders(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Signature": []string{`keyId="Test",algorithm="hmac-sha256",headers="date digest",signature="fffff"`},
+		},
+	}
+
+	errs := NewVerifier(keyLookUp, -1).VerifyDiagnose(r)
+	assert.Equal(t, 2, len(errs))
+	assert.Contains(t, errs, &MissingHeaderError{Header: "date"})
+	assert.Contains(t, errs, &MissingHeaderError{Header: "digest"})
+}
+
+func TestVerifyDiagnoseWithoutSignature(t *testing.T) {
+	errs := NewVerifier(keyLookUp, -1).VerifyDiagnose(&http.Request{Header: http.Header{}})
+	assert.Equal(t, 1, len(errs))
+	assert.EqualError(t, errs[0], ErrorNoSignatureHeaderFoundInRequest)
+}
+
+func TestVerifyTLSClientKeyID(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.TLSClientKeyID = func(cert *x509.Certificate) string {
+		return cert.Subject.CommonName
+	}
+
+	// plain http
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorNoTLSClientCertificate)
+
+	// TLS without client certificate
+	r.TLS = &tls.ConnectionState{}
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorNoTLSClientCertificate)
+
+	// client certificate of another key
+	r.TLS.PeerCertificates = []*x509.Certificate{{Subject: pkix.Name{CommonName: "Other"}}}
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorKeyIDDoesNotMatchTLSClientCertificate)
+
+	r.TLS.PeerCertificates = []*x509.Certificate{{Subject: pkix.Name{CommonName: testKeyID}}}
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyCompleteCoverage(t *testing.T) {
+	tests := []struct {
+		headers []string
+		body    string
+		err     string
+	}{
+		{[]string{"date"}, "", ErrorCriticalFieldNotSigned + " '(request-target)'"},
+		{[]string{"(request-target)"}, "", ErrorCriticalFieldNotSigned + " 'host'"},
+		{[]string{"(request-target)", "host"}, "hello", ErrorCriticalFieldNotSigned + " 'digest'"},
+	}
+
+	for _, test := range tests {
+		var body io.Reader
+		if len(test.body) > 0 {
+			body = strings.NewReader(test.body)
+		}
+		r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", body)
+		assert.Nil(t, err)
+		r.Header.Set("Date", testDate)
+
+		signer := NewSigner("hmac-sha256", test.headers...)
+		err = signer.SignRequest(r, testKeyID, testKey)
+		assert.Nil(t, err)
+
+		res, err := NewVerifier(keyLookUp, -1).VerifyComplete(r)
+		assert.False(t, res)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestVerifyCompleteServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// server side r.URL only holds the path, the host is in r.Host
+		assert.Empty(t, r.URL.Host)
+		ok, err := NewVerifier(keyLookUp, -1).VerifyComplete(r)
+		assert.True(t, ok)
+		assert.Nil(t, err)
+	}))
+	defer server.Close()
+
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	assert.Nil(t, NewSigner(AlgorithmHmacSha256, "(request-target)", "host", "date").SignRequest(r, testKeyID, testKey))
+	resp, err := server.Client().Do(r)
+	assert.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestVerifyCompleteRejectsInvalidSignature(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",headers="(request-target) host",signature="AAAA"`)
+
+	res, err := NewVerifier(keyLookUp, -1).VerifyComplete(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyMinSignedHeaders(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.MinSignedHeaders = 1
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v.MinSignedHeaders = 2
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorTooFewSignedHeaders)
+}
+
+func TestVerifyRequestStrict(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	signer := NewSigner("hmac-sha256", "digest")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	result, err := NewVerifier(keyLookUp, -1, "digest").VerifyRequestStrict(r)
+	assert.Nil(t, err)
+	assert.Equal(t, &VerifyResult{
+		KeyID:          testKeyID,
+		Algorithm:      "hmac-sha256",
+		Headers:        []string{"digest"},
+		DigestVerified: true,
+	}, result)
+
+	// the body is still available
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, testBody, string(body))
+}
+
+func TestVerifyRequestStrictTamperedBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	err = AddDigests(r)
+	assert.Nil(t, err)
+
+	signer := NewSigner("hmac-sha256", "digest")
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	r.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "mallory"}`))
+	result, err := NewVerifier(keyLookUp, -1).VerifyRequestStrict(r)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, ErrorDigestDoesNotMatch)
+}
+
+func TestVerifyRequestStrictRequiresDigest(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(testBody))
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	result, err := NewVerifier(keyLookUp, -1).VerifyRequestStrict(r)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, ErrorCriticalFieldNotSigned+" 'digest'")
+}
+
+func TestVerifyRequestStrictWithoutBody(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	result, err := NewVerifier(keyLookUp, -1).VerifyRequestStrict(r)
+	assert.Nil(t, err)
+	assert.False(t, result.DigestVerified)
+
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	result, err = NewVerifier(keyLookUp, -1).VerifyRequestStrict(r)
+	assert.Nil(t, result)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyCreatedExpires(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+
+	signer := NewSigner("hmac-sha256", "(created)", "(expires)", "(request-target)")
+	signer.ExpiresIn = 5 * time.Minute
+	err = signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	created := time.Unix(s.Created, 0)
+	assert.Equal(t, s.Created+300, s.Expires)
+
+	now := created
+	v := NewVerifier(keyLookUp, -1)
+	v.ValidateTimestamps = true
+	v.TimestampSkew = 10 * time.Second
+	v.Clock = func() time.Time { return now }
+
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	// within the skew
+	now = created.Add(5*time.Minute + 10*time.Second)
+	_, err = v.VerifyRequest(r)
+	assert.Nil(t, err)
+
+	now = created.Add(5*time.Minute + 11*time.Second)
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorSignatureExpired)
+
+	now = created.Add(-10 * time.Second)
+	_, err = v.VerifyRequest(r)
+	assert.Nil(t, err)
+
+	now = created.Add(-11 * time.Second)
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorSignatureCreatedInTheFuture)
+
+	// timestamps are only validated when enabled
+	v.ValidateTimestamps = false
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyClockSkewUsesClock(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	date, err := time.Parse(time.RFC1123, testDate)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, 300)
+	v.Clock = func() time.Time { return date.Add(300 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	assert.Nil(t, err)
+
+	v.Clock = func() time.Time { return date.Add(301 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	assert.EqualError(t, err, ErrorAllowedClockskewExceeded)
+}
+
+func TestVerifyClockSkewFutureDate(t *testing.T) {
+	r := &http.Request{
+		Header: http.Header{
+			"Date": []string{testDate},
+		},
+	}
+	err := DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	date, err := time.Parse(time.RFC1123, testDate)
+	assert.Nil(t, err)
+
+	v := NewVerifier(keyLookUp, 300)
+	v.Clock = func() time.Time { return date.Add(-300 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	assert.Nil(t, err)
+
+	v.Clock = func() time.Time { return date.Add(-301 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrClockSkewExceeded)
+	var skewErr *ClockSkewError
+	if assert.True(t, errors.As(err, &skewErr)) {
+		assert.Equal(t, date, skewErr.Date)
+		assert.Equal(t, -301*time.Second, skewErr.Skew)
+	}
+}
+
+func TestVerifyClockSkewCreated(t *testing.T) {
+	created := time.Unix(1618884473, 0)
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "(created)")
+	signer.Clock = func() time.Time { return created }
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, signer.Sign(r))
+
+	// the proxy adds a Date the client didn't sign
+	r.Header.Set("Date", testDate)
+	v := NewVerifier(keyLookUp, 300)
+	v.Clock = func() time.Time { return created.Add(300 * time.Second) }
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v.Clock = func() time.Time { return created.Add(301 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	var skewErr *ClockSkewError
+	if assert.True(t, errors.As(err, &skewErr)) {
+		assert.Equal(t, created, skewErr.Date)
+	}
+
+	// a created parameter which is not covered is no freshness source
+	r.Header.Set("Signature", strings.Replace(r.Header.Get("Signature"), `headers="(request-target) (created)"`, `headers="(request-target)"`, 1))
+	_, err = v.VerifyRequest(r)
+	assert.Equal(t, ErrMissingDateHeader, err)
+}
+
+func TestVerifyClockSkewCreatedRFC9421(t *testing.T) {
+	created := time.Unix(1618884473, 0)
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "@method", "@path")
+	signer.Format = FormatRFC9421
+	signer.Clock = func() time.Time { return created }
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, signer.Sign(r))
+
+	v := NewVerifier(keyLookUp, 300)
+	v.Clock = func() time.Time { return created.Add(300 * time.Second) }
+	res, err := v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v.Clock = func() time.Time { return created.Add(301 * time.Second) }
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrClockSkewExceeded)
+}
+
+func TestVerifyLenientTimestamps(t *testing.T) {
+	created := time.Unix(1618884473, 0)
+	signer := NewKeySigner(testKeyID, AlgorithmHmacSha256, testKey, "(request-target)", "(created)", "(expires)")
+	signer.Clock = func() time.Time { return created }
+	signer.ExpiresIn = time.Minute
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, signer.Sign(r))
+	signature := r.Header.Get("Signature")
+
+	v := NewVerifier(keyLookUp, 300)
+	v.Clock = func() time.Time { return created.Add(30 * time.Second) }
+	for _, rfc3339 := range []bool{false, true} {
+		r.Header.Set("Signature", signature)
+		if rfc3339 {
+			r.Header.Set("Signature", strings.NewReplacer(
+				"created=1618884473", `created="2021-04-20T02:07:53Z"`,
+				"expires=1618884533", `expires="2021-04-20T04:08:53+02:00"`,
+			).Replace(signature))
+		}
+
+		// strict by default
+		v.LenientTimestamps = false
+		res, err := v.VerifyRequest(r)
+		if rfc3339 {
+			assert.False(t, res)
+			assert.ErrorIs(t, err, ErrInvalidSignatureParameter)
+		} else {
+			assert.True(t, res)
+			assert.Nil(t, err)
+		}
+
+		v.LenientTimestamps = true
+		res, err = v.VerifyRequest(r)
+		assert.True(t, res)
+		assert.Nil(t, err)
+
+		// the freshness checks use the parsed timestamps
+		expired := *v
+		expired.Clock = func() time.Time { return created.Add(61 * time.Second) }
+		_, err = expired.VerifyRequest(r)
+		assert.Equal(t, ErrSignatureExpired, err)
+		skewed := *v
+		skewed.Clock = func() time.Time { return created.Add(-301 * time.Second) }
+		skewed.ValidateTimestamps = false
+		_, err = skewed.VerifyRequest(r)
+		assert.ErrorIs(t, err, ErrClockSkewExceeded)
+	}
+
+	v.LenientTimestamps = true
+	r.Header.Set("Signature", strings.Replace(signature, "created=1618884473", `created="yesterday"`, 1))
+	_, err = v.VerifyRequest(r)
+	assert.ErrorIs(t, err, ErrInvalidSignatureParameter)
+}
+
+func TestVerifyRequestWithResolver(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	var resolved []string
+	resolver := func(keyID string, algorithm string) (string, error) {
+		resolved = append(resolved, keyID, algorithm)
+		if keyID != testKeyID {
+			return "", nil
+		}
+		return testKey, nil
+	}
+
+	res, err := VerifyRequestWithResolver(r, resolver, -1)
+	assert.True(t, res)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{testKeyID, AlgorithmHmacSha256}, resolved)
+
+	r.Header.Del("Signature")
+	err = DefaultSha256Signer.SignRequest(r, "Other", testKey)
+	assert.Nil(t, err)
+	res, err = VerifyRequestWithResolver(r, resolver, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorUnknownKeyID)
+	var unknown *UnknownKeyError
+	if assert.True(t, errors.As(err, &unknown)) {
+		assert.Equal(t, "Other", unknown.KeyID)
+	}
+
+	// other resolver errors are returned as is
+	resolverErr := errors.New("database unavailable")
+	res, err = VerifyRequestWithResolver(r, func(string, string) (string, error) {
+		return "", resolverErr
+	}, -1)
+	assert.False(t, res)
+	assert.Equal(t, resolverErr, err)
+}
+
+func TestKeyVerifier(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	rawKey, err := base64.StdEncoding.DecodeString(testKey)
+	assert.Nil(t, err)
+	keys := map[string][]byte{testKeyID: rawKey}
+	v := NewKeyVerifier(func(keyID string) ([]byte, error) {
+		return keys[keyID], nil
+	}, -1)
+
+	result, err := v.Verify(r)
+	assert.Nil(t, err)
+	assert.Equal(t, &VerifyResult{
+		KeyID:     testKeyID,
+		Algorithm: AlgorithmHmacSha256,
+		Headers:   []string{"date"},
+	}, result)
+
+	r.Header.Del("Signature")
+	err = DefaultSha256Signer.SignRequest(r, "Other", testKey)
+	assert.Nil(t, err)
+	result, err = v.Verify(r)
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestKeyVerifierLookupError(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	lookupErr := errors.New("database unavailable")
+	v := NewKeyVerifier(func(keyID string) ([]byte, error) {
+		return nil, lookupErr
+	}, -1)
+	_, err = v.Verify(r)
+	assert.Equal(t, lookupErr, err)
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	for _, publicKey := range [][]byte{publicKeyPem, der} {
+		// the public key is no secret, anyone can sign with it as HMAC key
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		assert.Nil(t, err)
+		r.Header.Set("Date", testDate)
+		err = NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, publicKey)
+		assert.Nil(t, err)
+
+		v := NewKeyVerifier(func(keyID string) ([]byte, error) { return publicKey, nil }, -1)
+		res, err := v.VerifyRequest(r)
+		assert.False(t, res)
+		assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+
+		v.RejectAlgorithmConfusion = false
+		res, err = v.VerifyRequest(r)
+		assert.True(t, res)
+		assert.Nil(t, err)
+	}
+}
+
+func TestVerifyRejectsForgedHmacWithRawPublicKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	publicKey := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+
+	// forged by anyone who knows the published public key
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, publicKey)
+	assert.Nil(t, err)
+
+	res, err := NewVerifier(func(keyID string) (string, error) {
+		return base64.StdEncoding.EncodeToString(publicKey), nil
+	}, -1).VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+
+	// a raw Ed25519 public key is bound to its algorithm by a key store
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	r, err = http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, edPublicKey)
+	assert.Nil(t, err)
+	store := NewMemoryKeyStore()
+	assert.Nil(t, store.Add(testKeyID, AlgorithmEd25519, edPublicKey))
+	v := NewVerifier(nil, -1)
+	v.KeyStore = store
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.Equal(t, ErrAlgorithmKeyMismatch, err)
+}
+
+func TestVerifyHmac32ByteSecret(t *testing.T) {
+	for _, secret := range [][]byte{
+		[]byte("a secret of exactly 32 bytes!!!!"),
+		DeriveSecret([]byte("master"), testKeyID),
+	} {
+		assert.Len(t, secret, 32)
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		assert.Nil(t, err)
+		r.Header.Set("Date", testDate)
+		err = NewSigner(AlgorithmHmacSha256).SignRequestKey(r, testKeyID, secret)
+		assert.Nil(t, err)
+
+		res, err := NewVerifier(func(keyID string) (string, error) {
+			return base64.StdEncoding.EncodeToString(secret), nil
+		}, -1).VerifyRequest(r)
+		assert.True(t, res)
+		assert.Nil(t, err)
+
+		res, err = NewKeyVerifier(func(keyID string) ([]byte, error) {
+			return secret, nil
+		}, -1).VerifyRequest(r)
+		assert.True(t, res)
+		assert.Nil(t, err)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	result, err := NewVerifier(keyLookUp, -1).Verify(r)
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestVerifyRequestEmptyKey(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, "")
+	assert.Nil(t, err)
+
+	res, err := VerifyRequest(r, func(string) (string, error) { return "", nil }, -1)
+	assert.False(t, res)
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
+
+func TestVerifyErrorsIs(t *testing.T) {
+	signed := func() *http.Request {
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		assert.Nil(t, err)
+		r.Header.Set("Date", testDate)
+		err = NewSigner("hmac-sha256", "date", "host").SignRequest(r, testKeyID, testKey)
+		assert.Nil(t, err)
+		return r
+	}
+
+	for _, test := range []struct {
+		name   string
+		tamper func(r *http.Request)
+		err    error
+	}{
+		{"no signature", func(r *http.Request) { r.Header.Del("Signature") }, ErrNoSignatureHeader},
+		{"malformed", func(r *http.Request) { r.Header.Set("Signature", `keyId="Test`) }, ErrMalformedSignatureHeader},
+		{"missing keyId", func(r *http.Request) { r.Header.Set("Signature", `algorithm="hmac-sha256",signature="AAAA"`) }, ErrMissingKeyID},
+		{"missing algorithm", func(r *http.Request) { r.Header.Set("Signature", `keyId="Test",signature="AAAA"`) }, ErrMissingAlgorithm},
+		{"unknown algorithm", func(r *http.Request) { r.Header.Set("Signature", `keyId="Test",algorithm="rot13",signature="AAAA"`) }, ErrUnknownAlgorithm},
+		{"missing header", func(r *http.Request) { r.Header.Del("Date") }, ErrMissingRequiredHeader},
+		{"mismatch", func(r *http.Request) { r.Host = "example.org" }, ErrSignatureMismatch},
+		{"signature encoding", func(r *http.Request) {
+			r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",headers="date host",signature="not base64"`)
+		}, ErrInvalidSignatureParameter},
+	} {
+		r := signed()
+		test.tamper(r)
+		res, err := VerifyRequest(r, keyLookUp, -1)
+		assert.False(t, res, test.name)
+		assert.True(t, errors.Is(err, test.err), test.name)
+	}
+
+	r := signed()
+	r.Header.Del("Date")
+	_, err := VerifyRequest(r, keyLookUp, -1)
+	var missing *MissingHeaderError
+	if assert.True(t, errors.As(err, &missing)) {
+		assert.Equal(t, "date", missing.Header)
+	}
+
+	_, err = VerifyRequest(signed(), func(string) (string, error) { return "", nil }, -1)
+	assert.True(t, errors.Is(err, ErrUnknownKeyID))
+
+	_, err = VerifyRequest(signed(), func(string) (string, error) { return "not base64", nil }, -1)
+	assert.Equal(t, ErrInvalidKeyEncoding, err)
+	assert.Equal(t, http.StatusInternalServerError, ErrorHTTPStatus(err))
+
+	r = signed()
+	r.Header.Set("Date", "yesterday")
+	_, err = VerifyRequest(r, keyLookUp, 300)
+	assert.Equal(t, ErrInvalidDateHeader, err)
+}
+
+func TestVerifyAnyMultipleSignatures(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	// the gateway signs with a key we don't know, the client with a known one
+	err = NewSigner("hmac-sha256", "date").SignRequest(r, "Gateway", "R2F0ZXdheUtleQ==")
+	assert.Nil(t, err)
+	err = NewSigner("hmac-sha256", "(request-target)", "date").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	signatures, err := SignaturesFromRequest(r)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(signatures)) {
+		assert.Equal(t, "Gateway", signatures[0].KeyID)
+		assert.Equal(t, testKeyID, signatures[1].KeyID)
+		assert.Equal(t, HeaderList{{"(request-target)", "get /foo"}, {"date", testDate}}, signatures[1].Headers)
+	}
+
+	v := NewVerifier(nil, -1)
+	v.KeyResolver = func(keyID string, algorithm string) (string, error) {
+		if keyID == testKeyID {
+			return testKey, nil
+		}
+		return "", nil
+	}
+	sig, err := v.VerifyAny(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testKeyID, sig.KeyID)
+
+	// no signature by a known key
+	r.Header["Signature"] = r.Header["Signature"][:1]
+	r.Header.Add("Signature", r.Header.Get("Signature"))
+	_, err = v.VerifyAny(r)
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
+
+func TestVerifyAll(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	// the gateway and the client each sign with their own key
+	err = NewSigner("hmac-sha256", "date").SignRequest(r, "Gateway", "R2F0ZXdheUtleQ==")
+	assert.Nil(t, err)
+	err = NewSigner("hmac-sha256", "(request-target)", "date").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	err = NewSigner("hmac-sha256", "date").SignRequest(r, "Unknown", testKey)
+	assert.Nil(t, err)
+
+	keys := map[string]string{testKeyID: testKey, "Gateway": "R2F0ZXdheUtleQ=="}
+	v := NewVerifier(nil, -1)
+	v.KeyResolver = func(keyID string, algorithm string) (string, error) {
+		return keys[keyID], nil
+	}
+	results, err := v.VerifyAll(r)
+	assert.Nil(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, "Gateway", results[0].Parameters.KeyID)
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, testKeyID, results[1].Parameters.KeyID)
+		assert.Nil(t, results[1].Err)
+		assert.Equal(t, "Unknown", results[2].Parameters.KeyID)
+		assert.ErrorIs(t, results[2].Err, ErrUnknownKeyID)
+	}
+
+	// a key mismatch only fails its own signature
+	keys["Gateway"] = testKey
+	results, err = v.VerifyAll(r)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, results[0].Err, ErrSignatureMismatch)
+	assert.Nil(t, results[1].Err)
+}
+
+func TestVerifyAllMaxSignatures(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	for i := 0; i < DefaultMaxSignatures+1; i++ {
+		assert.Nil(t, NewSigner("hmac-sha256", "date").SignRequest(r, testKeyID, testKey))
+	}
+
+	lookUps := 0
+	v := NewVerifier(func(keyID string) (string, error) {
+		lookUps++
+		return testKey, nil
+	}, -1)
+	_, err = v.VerifyAll(r)
+	assert.Equal(t, ErrTooManySignatures, err)
+	_, err = v.VerifyAny(r)
+	assert.Equal(t, ErrTooManySignatures, err)
+	_, err = SignaturesFromRequest(r)
+	assert.Equal(t, ErrTooManySignatures, err)
+	assert.Equal(t, 0, lookUps)
+
+	v.MaxSignatures = -1
+	results, err := v.VerifyAll(r)
+	assert.Nil(t, err)
+	assert.Len(t, results, DefaultMaxSignatures+1)
+
+	// RFC 9421 signatures count the same
+	r.Header.Del("Signature")
+	signer := NewSigner("hmac-sha256", "@method")
+	signer.Format = FormatRFC9421
+	for i := 0; i < 3; i++ {
+		signer.Label = fmt.Sprintf("sig%d", i)
+		assert.Nil(t, signer.SignRequest(r, testKeyID, testKey))
+	}
+	v.MaxSignatures = 2
+	_, err = v.VerifyAll(r)
+	assert.Equal(t, ErrTooManySignatures, err)
+	v.MaxSignatures = 3
+	results, err = v.VerifyAll(r)
+	assert.Nil(t, err)
+	assert.Len(t, results, 3)
+}
+
+func TestVerifyAnyTamperedSignature(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	r.Header.Add("Signature", `keyId="Test",algorithm="hmac-sha256",signature="AAAA"`)
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	sig, err := NewVerifier(keyLookUp, -1).VerifyAny(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testSha256Hash, sig.Signature)
+
+	r.Header.Set("Date", "Thu, 05 Jan 2012 21:31:41 GMT")
+	_, err = NewVerifier(keyLookUp, -1).VerifyAny(r)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+}
+
+func TestVerifyDefaultHeaders(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Date", testDate)
+	err = NewSigner("hmac-sha256", "(request-target)", "date").SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+
+	// strip the headers parameter from the signature
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",signature="`+s.Signature+`"`)
+
+	// the signature doesn't cover the default "date" alone
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureDdoNotMatch)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.DefaultHeaders = []string{"(request-target)", "Date"}
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+
+	v.RequireHeadersParameter = true
+	res, err = v.VerifyRequest(r)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorMissingSignatureParameterHeaders)
+	assert.True(t, errors.Is(err, ErrMissingHeaders))
+
+	// with the headers parameter the strict verifier accepts the signature
+	r.Header.Del("Signature")
+	err = DefaultSha256Signer.SignRequest(r, testKeyID, testKey)
+	assert.Nil(t, err)
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}
+
+func TestVerifyRequestRejectsExpiredSignature(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Signature", `keyId="Test",algorithm="hmac-sha256",created=1325799100,expires=1325799400,headers="(created) (expires) (request-target)",signature="AAAA"`)
+
+	var s SignatureParameters
+	err = s.FromRequest(r)
+	assert.Nil(t, err)
+	signature, err := s.calculateSignature(testKey)
+	assert.Nil(t, err)
+	r.Header.Set("Signature", s.hTTPSignatureString(signature))
+
+	// expired in 2012
+	res, err := VerifyRequest(r, keyLookUp, -1)
+	assert.False(t, res)
+	assert.EqualError(t, err, ErrorSignatureExpired)
+
+	v := NewVerifier(keyLookUp, -1)
+	v.Clock = func() time.Time { return time.Unix(1325799200, 0) }
+	res, err = v.VerifyRequest(r)
+	assert.True(t, res)
+	assert.Nil(t, err)
+}